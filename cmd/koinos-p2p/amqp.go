@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// amqpPasswordEnv is the environment variable from which the AMQP password is read
+// when no password file is given
+const amqpPasswordEnv = "KOINOS_AMQP_PASSWORD"
+
+// composeAMQPURL adds a password read from passwordFile, or failing that from the
+// KOINOS_AMQP_PASSWORD environment variable, to the credentials of amqpURL.
+// If neither source is set, amqpURL is returned unchanged.
+func composeAMQPURL(amqpURL string, passwordFile string) (string, error) {
+	var password string
+
+	if passwordFile != "" {
+		data, err := ioutil.ReadFile(passwordFile)
+		if err != nil {
+			return "", fmt.Errorf("could not read AMQP password file: %w", err)
+		}
+		password = strings.TrimSpace(string(data))
+	} else if env, ok := os.LookupEnv(amqpPasswordEnv); ok {
+		password = env
+	} else {
+		return amqpURL, nil
+	}
+
+	u, err := url.Parse(amqpURL)
+	if err != nil {
+		return "", fmt.Errorf("could not parse AMQP URL: %w", urlParseReason(err))
+	}
+
+	username := ""
+	if u.User != nil {
+		username = u.User.Username()
+	}
+	u.User = url.UserPassword(username, password)
+
+	return u.String(), nil
+}
+
+// redactAMQPURL returns amqpURL with any password replaced, for logging
+func redactAMQPURL(amqpURL string) string {
+	u, err := url.Parse(amqpURL)
+	if err != nil {
+		return "<invalid AMQP URL>"
+	}
+
+	return u.Redacted()
+}
+
+// urlParseReason strips the URL, which may contain credentials, from a url.Parse error
+func urlParseReason(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+
+	return err
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/koinos/koinos-p2p/internal/node"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
+)
+
+func runCheckPeer(ctx context.Context, peerAddr string, dialTimeout time.Duration, w io.Writer) error {
+	addrInfo, err := peer.AddrInfoFromString(peerAddr)
+	if err != nil {
+		return fmt.Errorf("invalid peer address %s: %w", peerAddr, err)
+	}
+
+	host, err := libp2p.New(libp2p.NoListenAddrs)
+	if err != nil {
+		return fmt.Errorf("could not create host: %w", err)
+	}
+	defer host.Close()
+
+	start := time.Now()
+	if err := node.ConnectWithTimeout(ctx, host, addrInfo, dialTimeout); err != nil {
+		return fmt.Errorf("could not connect to peer %s: %w", addrInfo.ID, err)
+	}
+	connectTime := time.Since(start)
+
+	fmt.Fprintf(w, "Connected to peer %s in %s\n", addrInfo.ID, connectTime.Round(time.Millisecond))
+
+	pingCtx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+
+	if result := <-ping.Ping(pingCtx, host, addrInfo.ID); result.Error != nil {
+		fmt.Fprintf(w, "Latency: unavailable (%s)\n", result.Error)
+	} else {
+		fmt.Fprintf(w, "Latency: %s\n", result.RTT.Round(time.Microsecond))
+	}
+
+	protocols, err := host.Peerstore().GetProtocols(addrInfo.ID)
+	if err != nil {
+		return fmt.Errorf("could not get protocols of peer %s: %w", addrInfo.ID, err)
+	}
+	sort.Strings(protocols)
+
+	fmt.Fprintln(w, "Protocols:")
+	for _, protocol := range protocols {
+		fmt.Fprintf(w, "  %s\n", protocol)
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/network"
+)
+
+func TestCheckPeer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	h.SetStreamHandler("/koinos/test/1.0.0", func(s network.Stream) { s.Close() })
+
+	peerAddr := fmt.Sprintf("%s/p2p/%s", h.Addrs()[0], h.ID())
+
+	var out bytes.Buffer
+	if err := runCheckPeer(ctx, peerAddr, time.Second*5, &out); err != nil {
+		t.Fatalf("Expected check to succeed, was %s", err)
+	}
+
+	output := out.String()
+	if !strings.Contains(output, "Connected to peer "+h.ID().Pretty()) {
+		t.Errorf("Expected output to report the connection, was %s", output)
+	}
+	if !strings.Contains(output, "Latency: ") {
+		t.Errorf("Expected output to report latency, was %s", output)
+	}
+	if !strings.Contains(output, "/koinos/test/1.0.0") {
+		t.Errorf("Expected output to report the peer's protocols, was %s", output)
+	}
+
+	h.Close()
+
+	if err := runCheckPeer(ctx, peerAddr, time.Second, &out); err == nil {
+		t.Error("Expected check of a closed peer to fail")
+	}
+
+	if err := runCheckPeer(ctx, "/ip4/127.0.0.1/tcp/8888", time.Second, &out); err == nil {
+		t.Error("Expected check of an address without a peer ID to fail")
+	}
+
+	// A peer that never completes the handshake fails the check once the dial timeout passes
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				_, _ = ioutil.ReadAll(conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	stalledAddr := fmt.Sprintf("/ip4/127.0.0.1/tcp/%v/p2p/%s", listener.Addr().(*net.TCPAddr).Port, h.ID())
+	start := time.Now()
+	if err := runCheckPeer(ctx, stalledAddr, time.Millisecond*200, &out); err == nil {
+		t.Error("Expected check of a stalled peer to fail")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second*2 {
+		t.Errorf("Expected check of a stalled peer to give up after the dial timeout, took %s", elapsed)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/koinos/koinos-log-golang"
+	"github.com/koinos/koinos-p2p/internal/options"
+)
+
+// loadCheckpointFile reads checkpoints from a file with one height:blockid per line.
+// Blank lines and lines starting with # are ignored, and malformed lines are logged and skipped.
+func loadCheckpointFile(filename string) ([]options.Checkpoint, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not open checkpoint file: %w", err)
+	}
+	defer file.Close()
+
+	checkpoints := make([]options.Checkpoint, 0)
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		checkpoint, err := options.ParseCheckpoint(line)
+		if err != nil {
+			log.Warnf("Invalid checkpoint on line %v of %s, skipping it: %s", lineNumber, filename, err)
+			continue
+		}
+
+		checkpoints = append(checkpoints, checkpoint)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read checkpoint file: %w", err)
+	}
+
+	return checkpoints, nil
+}
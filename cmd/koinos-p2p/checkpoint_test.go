@@ -0,0 +1,45 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadCheckpointFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "koinos-p2p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	contents := `# Mainnet checkpoints
+10:12200000000000000000000000000000000000000000000000000000000000000000
+
+20:not-hex
+  30:12200000000000000000000000000000000000000000000000000000000000000001  
+malformed
+`
+	filename := filepath.Join(dir, "checkpoints")
+	if err := ioutil.WriteFile(filename, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoints, err := loadCheckpointFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(checkpoints) != 2 {
+		t.Fatalf("Incorrect number of checkpoints. Expected 2, was %v", len(checkpoints))
+	}
+
+	if checkpoints[0].BlockHeight != 10 || checkpoints[1].BlockHeight != 30 {
+		t.Errorf("Incorrect checkpoint heights. Expected 10 and 30, was %v and %v", checkpoints[0].BlockHeight, checkpoints[1].BlockHeight)
+	}
+
+	if _, err := loadCheckpointFile(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected loading a missing checkpoint file to fail")
+	}
+}
@@ -2,14 +2,11 @@ package main
 
 import (
 	"context"
-	"encoding/hex"
 	"fmt"
 	"math/rand"
 	"os"
 	"os/signal"
 	"path"
-	"strconv"
-	"strings"
 	"syscall"
 	"time"
 
@@ -25,17 +22,39 @@ import (
 )
 
 const (
-	baseDirOption       = "basedir"
-	amqpOption          = "amqp"
-	listenOption        = "listen"
-	seedOption          = "seed"
-	peerOption          = "peer"
-	directOption        = "direct"
-	checkpointOption    = "checkpoint"
-	disableGossipOption = "disable-gossip"
-	forceGossipOption   = "force-gossip"
-	logLevelOption      = "log-level"
-	instanceIDOption    = "instance-id"
+	baseDirOption        = "basedir"
+	amqpOption           = "amqp"
+	amqpPasswordOption   = "amqp-password-file"
+	listenOption         = "listen"
+	seedOption           = "seed"
+	peerOption           = "peer"
+	directOption         = "direct"
+	whitelistOption      = "whitelist"
+	registryOption       = "registry"
+	registryKeyOption    = "registry-key"
+	roleLimitOption      = "role-limit"
+	checkpointOption     = "checkpoint"
+	checkpointFileOption = "checkpoint-file"
+	disableGossipOption  = "disable-gossip"
+	forceGossipOption    = "force-gossip"
+	clientOnlyOption     = "client-only"
+	reciprocityOption    = "reciprocity"
+	standbyOption        = "standby"
+	announceAddrsOption  = "announce-addresses"
+	announceReadyOption  = "announce-ready"
+	readyMinPeersOption  = "ready-min-peers"
+	floodPublishOption   = "flood-publish"
+	meshDemotionOption   = "mesh-demotion"
+	keyTypeOption        = "key-type"
+	securityOption       = "security"
+	enableNATOption      = "enable-nat"
+	metricsListenOption  = "metrics-listen"
+	checkPeerOption      = "check-peer"
+	dialTimeoutOption    = "dial-timeout"
+	enablePprofOption    = "enable-pprof"
+	pprofListenOption    = "pprof-listen"
+	logLevelOption       = "log-level"
+	instanceIDOption     = "instance-id"
 )
 
 const (
@@ -45,13 +64,31 @@ const (
 	seedDefault          = ""
 	disableGossipDefault = false
 	forceGossipDefault   = false
+	clientOnlyDefault    = false
+	reciprocityDefault   = false
+	standbyDefault       = false
+	announceAddrsDefault = false
+	announceReadyDefault = false
+	readyMinPeersDefault = 1
+	floodPublishDefault  = false
+	meshDemotionDefault  = false
+	keyTypeDefault       = ""
+	securityDefault      = "all"
+	enableNATDefault     = true
+	metricsListenDefault = ""
+	enablePprofDefault   = false
+	pprofListenDefault   = "localhost:6060"
+	dialTimeoutDefault   = "10s"
 	logLevelDefault      = "info"
 	instanceIDDefault    = ""
 )
 
 const (
-	appName = "p2p"
-	logDir  = "logs"
+	appName         = "p2p"
+	logDir          = "logs"
+	identityKeyFile = "identity.key"
+	statusTimeout   = time.Second * 10
+	shutdownTimeout = time.Second * 10
 )
 
 func main() {
@@ -63,13 +100,35 @@ func main() {
 
 	baseDir := flag.StringP(baseDirOption, "d", baseDirDefault, "Koinos base directory")
 	amqp := flag.StringP(amqpOption, "a", "", "AMQP server URL")
+	amqpPasswordFile := flag.String(amqpPasswordOption, "", "File containing the AMQP password, added to the AMQP server URL (defaults to the "+amqpPasswordEnv+" environment variable)")
 	addr := flag.StringP(listenOption, "l", "", "The multiaddress on which the node will listen")
-	seed := flag.StringP(seedOption, "s", "", "Seed string with which the node will generate an ID (A randomized seed will be generated if none is provided)")
+	seed := flag.StringP(seedOption, "s", "", "Seed string with which the node will generate an ID if it has no stored identity key (A randomized seed will be generated if none is provided)")
 	peerAddresses := flag.StringSliceP(peerOption, "p", []string{}, "Address of a peer to which to connect (may specify multiple)")
 	directAddresses := flag.StringSliceP(directOption, "D", []string{}, "Address of a peer to connect using gossipsub.WithDirectPeers (may specify multiple) (should be reciprocal)")
+	whitelist := flag.StringSlice(whitelistOption, []string{}, "ID of a peer allowed to connect, if any are given all other peers except initial and direct peers are disconnected (may specify multiple)")
+	registry := flag.String(registryOption, "", "Signed registry file of the peers allowed to connect, all other peers are rejected")
+	registryKey := flag.String(registryKeyOption, "", "Base64 encoded public key the peer registry must be signed with")
+	roleLimits := flag.StringSlice(roleLimitOption, []string{}, "Limit on inbound peers of a peer registry role in the form role:count (may specify multiple)")
 	checkpoints := flag.StringSliceP(checkpointOption, "c", []string{}, "Block checkpoint in the form height:blockid (may specify multiple times)")
+	checkpointFile := flag.String(checkpointFileOption, "", "File of block checkpoints, one height:blockid per line, in addition to any checkpoint options")
 	disableGossip := flag.BoolP(disableGossipOption, "g", disableGossipDefault, "Disable gossip mode")
 	forceGossip := flag.BoolP(forceGossipOption, "G", forceGossipDefault, "Force gossip mode to always be enabled")
+	clientOnly := flag.Bool(clientOnlyOption, clientOnlyDefault, "Do not serve blocks to peers, only download from them")
+	reciprocity := flag.Bool(reciprocityOption, reciprocityDefault, "Throttle block requests from peers that have never served blocks to this node")
+	standby := flag.Bool(standbyOption, standbyDefault, "Start as a warm standby that stays connected to peers but does not sync until promoted")
+	announceAddrs := flag.Bool(announceAddrsOption, announceAddrsDefault, "Broadcast the node's peer ID and addresses over AMQP on startup and when they change")
+	announceReady := flag.Bool(announceReadyOption, announceReadyDefault, "Broadcast a ready event over AMQP once the node has started and reached the minimum number of peers")
+	readyMinPeers := flag.Int(readyMinPeersOption, readyMinPeersDefault, "The number of connected peers required before the node broadcasts its ready event")
+	floodPublish := flag.Bool(floodPublishOption, floodPublishDefault, "Publish gossip messages from this node to all topic peers rather than only mesh peers")
+	meshDemotion := flag.Bool(meshDemotionOption, meshDemotionDefault, "Score block gossip peers and prune mesh peers that deliver too few blocks in favor of more active peers")
+	keyType := flag.String(keyTypeOption, "", "Type of identity key to generate (ed25519, secp256k1, ecdsa, rsa), defaults to ecdsa when a seed is given to keep its peer ID, otherwise ed25519")
+	enableNAT := flag.Bool(enableNATOption, enableNATDefault, "Map ports on NAT routers and run the AutoNAT service and relays (use --enable-nat=false to disable)")
+	security := flag.String(securityOption, "", "Security transport used to secure connections (noise, tls, all)")
+	metricsListen := flag.String(metricsListenOption, "", "The address on which to serve Prometheus metrics at /metrics (disabled if empty)")
+	enablePprof := flag.Bool(enablePprofOption, enablePprofDefault, "Serve pprof profiling endpoints at /debug/pprof/")
+	pprofListen := flag.String(pprofListenOption, "", "The address on which to serve pprof profiling endpoints, if enabled (should be a local address)")
+	checkPeer := flag.String(checkPeerOption, "", "Check connectivity to the peer at the given multiaddress, report its protocols and latency, then exit")
+	dialTimeout := flag.String(dialTimeoutOption, "", "How long a single attempt to connect to a peer may take, as a duration such as 10s")
 	logLevel := flag.StringP(logLevelOption, "v", "", "The log filtering level (debug, info, warn, error)")
 	instanceID := flag.StringP(instanceIDOption, "i", instanceIDDefault, "The instance ID to identify this node")
 
@@ -80,32 +139,110 @@ func main() {
 	yamlConfig := util.InitYamlConfig(*baseDir)
 
 	*amqp = util.GetStringOption(amqpOption, amqpDefault, *amqp, yamlConfig.P2P, yamlConfig.Global)
+	*amqpPasswordFile = util.GetStringOption(amqpPasswordOption, "", *amqpPasswordFile, yamlConfig.P2P, yamlConfig.Global)
 	*addr = util.GetStringOption(listenOption, listenDefault, *addr, yamlConfig.P2P, yamlConfig.Global)
 	*seed = util.GetStringOption(seedOption, seedDefault, *seed, yamlConfig.P2P, yamlConfig.Global)
 	*peerAddresses = util.GetStringSliceOption(peerOption, *peerAddresses, yamlConfig.P2P, yamlConfig.Global)
 	*directAddresses = util.GetStringSliceOption(directOption, *directAddresses, yamlConfig.P2P, yamlConfig.Global)
+	*whitelist = util.GetStringSliceOption(whitelistOption, *whitelist, yamlConfig.P2P, yamlConfig.Global)
 	*checkpoints = util.GetStringSliceOption(checkpointOption, *checkpoints, yamlConfig.P2P, yamlConfig.Global)
+	*checkpointFile = util.GetStringOption(checkpointFileOption, "", *checkpointFile, yamlConfig.P2P, yamlConfig.Global)
+	*registry = util.GetStringOption(registryOption, "", *registry, yamlConfig.P2P, yamlConfig.Global)
+	*registryKey = util.GetStringOption(registryKeyOption, "", *registryKey, yamlConfig.P2P, yamlConfig.Global)
+	*roleLimits = util.GetStringSliceOption(roleLimitOption, *roleLimits, yamlConfig.P2P, yamlConfig.Global)
 	*disableGossip = util.GetBoolOption(disableGossipOption, *disableGossip, disableGossipDefault, yamlConfig.P2P, yamlConfig.Global)
 	*forceGossip = util.GetBoolOption(forceGossipOption, *forceGossip, forceGossipDefault, yamlConfig.P2P, yamlConfig.Global)
+	*clientOnly = util.GetBoolOption(clientOnlyOption, *clientOnly, clientOnlyDefault, yamlConfig.P2P, yamlConfig.Global)
+	*reciprocity = util.GetBoolOption(reciprocityOption, *reciprocity, reciprocityDefault, yamlConfig.P2P, yamlConfig.Global)
+	*standby = util.GetBoolOption(standbyOption, *standby, standbyDefault, yamlConfig.P2P, yamlConfig.Global)
+	*announceAddrs = util.GetBoolOption(announceAddrsOption, *announceAddrs, announceAddrsDefault, yamlConfig.P2P, yamlConfig.Global)
+	*announceReady = util.GetBoolOption(announceReadyOption, *announceReady, announceReadyDefault, yamlConfig.P2P, yamlConfig.Global)
+	*readyMinPeers = getIntOption(readyMinPeersOption, readyMinPeersDefault, *readyMinPeers, yamlConfig.P2P, yamlConfig.Global)
+	*floodPublish = util.GetBoolOption(floodPublishOption, *floodPublish, floodPublishDefault, yamlConfig.P2P, yamlConfig.Global)
+	*meshDemotion = util.GetBoolOption(meshDemotionOption, *meshDemotion, meshDemotionDefault, yamlConfig.P2P, yamlConfig.Global)
+	*keyType = util.GetStringOption(keyTypeOption, keyTypeDefault, *keyType, yamlConfig.P2P, yamlConfig.Global)
+	*enableNAT = util.GetBoolOption(enableNATOption, *enableNAT, enableNATDefault, yamlConfig.P2P, yamlConfig.Global)
+	*security = util.GetStringOption(securityOption, securityDefault, *security, yamlConfig.P2P, yamlConfig.Global)
+	*metricsListen = util.GetStringOption(metricsListenOption, metricsListenDefault, *metricsListen, yamlConfig.P2P, yamlConfig.Global)
+	*enablePprof = util.GetBoolOption(enablePprofOption, *enablePprof, enablePprofDefault, yamlConfig.P2P, yamlConfig.Global)
+	*pprofListen = util.GetStringOption(pprofListenOption, pprofListenDefault, *pprofListen, yamlConfig.P2P, yamlConfig.Global)
+	*dialTimeout = util.GetStringOption(dialTimeoutOption, dialTimeoutDefault, *dialTimeout, yamlConfig.P2P, yamlConfig.Global)
 	*logLevel = util.GetStringOption(logLevelOption, logLevelDefault, *logLevel, yamlConfig.P2P, yamlConfig.Global)
 	*instanceID = util.GetStringOption(instanceIDOption, util.GenerateBase58ID(5), *instanceID, yamlConfig.P2P, yamlConfig.Global)
 
+	peerDialTimeout, err := time.ParseDuration(*dialTimeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid dial timeout %s: %s\n", *dialTimeout, err)
+		os.Exit(1)
+	}
+
+	if *checkPeer != "" {
+		err := runCheckPeer(context.Background(), *checkPeer, peerDialTimeout, os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	amqpURL, err := composeAMQPURL(*amqp, *amqpPasswordFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if flag.Arg(0) == statusCommand || flag.Arg(0) == promoteCommand {
+		client := koinosmq.NewClient(amqpURL, koinosmq.ExponentialBackoff)
+		client.Start()
+
+		ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+		defer cancel()
+
+		var err error
+		if flag.Arg(0) == statusCommand {
+			err = runStatus(ctx, client, os.Stdout)
+		} else {
+			err = runPromote(ctx, client, os.Stdout)
+		}
+
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	appID := fmt.Sprintf("%s.%s", appName, *instanceID)
 
 	// Initialize logger
 	logFilename := path.Join(util.GetAppDir(*baseDir, appName), logDir, "p2p.log")
-	err := log.InitLogger(*logLevel, false, logFilename, appID)
+	err = log.InitLogger(*logLevel, false, logFilename, appID)
 	if err != nil {
 		panic(fmt.Sprintf("Invalid log-level: %s. Please choose one of: debug, info, warn, error", *logLevel))
 	}
 
-	client := koinosmq.NewClient(*amqp, koinosmq.ExponentialBackoff)
-	requestHandler := koinosmq.NewRequestHandler(*amqp)
+	log.Infof("Using AMQP server %s", redactAMQPURL(amqpURL))
+
+	client := koinosmq.NewClient(amqpURL, koinosmq.ExponentialBackoff)
+	requestHandler := koinosmq.NewRequestHandler(amqpURL)
 
 	config := options.NewConfig()
 
 	config.NodeOptions.InitialPeers = *peerAddresses
+	config.NodeOptions.IdentityKeyFile = path.Join(util.GetAppDir(*baseDir, appName), identityKeyFile)
 	config.NodeOptions.DirectPeers = *directAddresses
+	config.WhitelistOptions.Peers = *whitelist
+	config.RegistryOptions.Path = *registry
+	config.RegistryOptions.PublicKey = *registryKey
+
+	for _, roleLimit := range *roleLimits {
+		role, limit, err := options.ParseRoleLimit(roleLimit)
+		if err != nil {
+			log.Errorf("Invalid role limit option: %s", err)
+			os.Exit(1)
+		}
+		config.RegistryOptions.RoleLimits[role] = limit
+	}
 
 	if *disableGossip {
 		config.GossipToggleOptions.AlwaysDisable = true
@@ -114,23 +251,35 @@ func main() {
 		config.GossipToggleOptions.AlwaysEnable = true
 	}
 
+	config.PeerRPCServiceOptions.ClientOnly = *clientOnly
+	config.PeerRPCServiceOptions.Reciprocity = *reciprocity
+	config.NodeOptions.Standby = *standby
+	config.NodeOptions.AnnounceAddresses = *announceAddrs
+	config.NodeOptions.AnnounceReady = *announceReady
+	config.NodeOptions.ReadyMinPeers = *readyMinPeers
+	config.GossipOptions.FloodPublish = *floodPublish
+	config.GossipOptions.MeshDemotion = *meshDemotion
+	config.NodeOptions.KeyType = *keyType
+	config.NodeOptions.Security = *security
+	config.NodeOptions.EnableNAT = *enableNAT
+	config.PeerConnectionOptions.DialTimeout = peerDialTimeout
+
 	for _, checkpoint := range *checkpoints {
-		parts := strings.SplitN(checkpoint, ":", 2)
-		if len(parts) != 2 {
-			log.Errorf("Checkpoint option must be in form blockHeight:blockID, was '%s'", checkpoint)
-		}
-		blockHeight, err := strconv.ParseUint(parts[0], 10, 64)
+		cp, err := options.ParseCheckpoint(checkpoint)
 		if err != nil {
-			log.Errorf("Could not parse checkpoint block height '%s': %s", parts[0], err.Error())
+			log.Errorf("Invalid checkpoint option: %s", err)
+			os.Exit(1)
 		}
+		config.PeerConnectionOptions.Checkpoints = append(config.PeerConnectionOptions.Checkpoints, cp)
+	}
 
-		// Replace with base64 later
-		//blockID, err := base64.URLEncoding.DecodeString(parts[1])
-		blockID, err := hex.DecodeString(parts[1])
+	if *checkpointFile != "" {
+		fileCheckpoints, err := loadCheckpointFile(*checkpointFile)
 		if err != nil {
-			log.Errorf("Error decoding checkpoint block id: %s", err)
+			log.Errorf("Error loading checkpoints: %s", err)
+			os.Exit(1)
 		}
-		config.PeerConnectionOptions.Checkpoints = append(config.PeerConnectionOptions.Checkpoints, options.Checkpoint{BlockHeight: blockHeight, BlockID: blockID})
+		config.PeerConnectionOptions.Checkpoints = append(config.PeerConnectionOptions.Checkpoints, fileCheckpoints...)
 	}
 
 	client.Start()
@@ -168,13 +317,37 @@ func main() {
 
 	node.Start(context.Background())
 
-	log.Infof("Starting node at address: %s", node.GetAddress())
+	if *metricsListen != "" {
+		log.Infof("Serving metrics at %s/metrics", *metricsListen)
+		go func() {
+			if err := node.Metrics.ListenAndServe(context.Background(), *metricsListen); err != nil {
+				log.Errorf("Error serving metrics: %s", err)
+			}
+		}()
+	}
+
+	if *enablePprof {
+		log.Infof("Serving pprof at %s/debug/pprof/", *pprofListen)
+		go func() {
+			if err := servePprof(context.Background(), *enablePprof, *pprofListen); err != nil {
+				log.Errorf("Error serving pprof: %s", err)
+			}
+		}()
+	}
+
+	if addr := node.GetAddress(); addr != nil {
+		log.Infof("Starting node at address: %s", addr)
+	} else {
+		log.Info("Starting node without a listen address")
+	}
 
 	// Wait for a SIGINT or SIGTERM signal
 	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
 	<-ch
 	log.Info("Shutting down node...")
-	// Shut the node down
-	node.Close()
+	// Shut the node down, giving requests in flight to peers time to finish
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	node.Close(ctx)
 }
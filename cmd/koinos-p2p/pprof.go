@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/pprof"
+)
+
+// servePprof serves the pprof profiling endpoints at /debug/pprof/ on the given address until the
+// context is done. Nothing is served unless enabled.
+func servePprof(ctx context.Context, enabled bool, addr string) error {
+	if !enabled {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func freeAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	return listener.Addr().String()
+}
+
+func TestPprof(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	addr := freeAddress(t)
+
+	if err := servePprof(ctx, false, addr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := http.Get("http://" + addr + "/debug/pprof/"); err == nil {
+		t.Error("Expected connections to be refused when pprof is disabled")
+	}
+
+	go servePprof(ctx, true, addr)
+
+	for {
+		resp, err := http.Get("http://" + addr + "/debug/pprof/goroutine?debug=1")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("Expected goroutine profile to be served, status was %v", resp.StatusCode)
+			}
+			return
+		}
+
+		select {
+		case <-time.After(time.Millisecond * 10):
+		case <-ctx.Done():
+			t.Fatalf("Expected pprof to be served when enabled: %s", err)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/koinos/koinos-p2p/internal/node"
+)
+
+const promoteCommand = "promote"
+
+func runPromote(ctx context.Context, client adminRequester, w io.Writer) error {
+	responseBytes, err := client.RPCContext(ctx, "application/json", node.PromoteRPC, []byte{})
+	if err != nil {
+		return fmt.Errorf("could not promote node: %w", err)
+	}
+
+	result := &node.PromoteResult{}
+	err = json.Unmarshal(responseBytes, result)
+	if err != nil {
+		return fmt.Errorf("could not parse promote result: %w", err)
+	}
+
+	if result.Promoted {
+		fmt.Fprintln(w, "Node promoted from standby")
+	} else {
+		fmt.Fprintln(w, "Node was not in standby")
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/koinos/koinos-p2p/internal/node"
+)
+
+const statusCommand = "status"
+
+// adminRequester is the subset of the AMQP client used to make admin requests to the node
+type adminRequester interface {
+	RPCContext(ctx context.Context, contentType string, rpcType string, args []byte) ([]byte, error)
+}
+
+func queryStatus(ctx context.Context, client adminRequester) (*node.Status, error) {
+	responseBytes, err := client.RPCContext(ctx, "application/json", node.StatusRPC, []byte{})
+	if err != nil {
+		return nil, fmt.Errorf("could not query node status: %w", err)
+	}
+
+	status := &node.Status{}
+	err = json.Unmarshal(responseBytes, status)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse node status: %w", err)
+	}
+
+	return status, nil
+}
+
+func printStatus(w io.Writer, status *node.Status) error {
+	gossip := "disabled"
+	if status.GossipEnabled {
+		gossip = "enabled"
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "ID:\t%s\n", status.ID)
+	fmt.Fprintf(tw, "Address:\t%s\n", status.Address)
+	fmt.Fprintf(tw, "Gossip:\t%s\n", gossip)
+	fmt.Fprintf(tw, "Standby:\t%v\n", status.Standby)
+	fmt.Fprintf(tw, "Isolated:\t%v\n", status.Isolated)
+	fmt.Fprintf(tw, "Outage:\t%v\n", status.Outage)
+	fmt.Fprintf(tw, "Peers:\t%v\n", len(status.Peers))
+
+	if len(status.Peers) > 0 {
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "PEER\tADDRESS\tSYNCED\tUPTIME\tLAST-SEEN")
+		for _, p := range status.Peers {
+			uptime := time.Duration(p.UptimeSeconds) * time.Second
+			fmt.Fprintf(tw, "%s\t%s\t%v\t%s\t%s\n", p.ID, p.Address, p.Synced, uptime, p.LastSeen.Format(time.RFC3339))
+		}
+	}
+
+	if hasDownloads(status.Peers) {
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "PEER\tBLOCKS\tBYTES\tAVG-LATENCY\tSUCCESS")
+		for _, p := range status.Peers {
+			latency := time.Duration(p.AverageLatencyMs) * time.Millisecond
+			fmt.Fprintf(tw, "%s\t%v\t%v\t%s\t%.2f\n", p.ID, p.BlocksDownloaded, p.BytesDownloaded, latency, p.DownloadSuccessRatio)
+		}
+	}
+
+	if len(status.Reconnects) > 0 {
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "PEER\tATTEMPTS\tSUCCESSES\tFAILURES")
+		for _, r := range status.Reconnects {
+			fmt.Fprintf(tw, "%s\t%v\t%v\t%v\n", r.ID, r.Attempts, r.Successes, r.Failures)
+		}
+	}
+
+	return tw.Flush()
+}
+
+// hasDownloads returns true if blocks have been requested from any of the peers
+func hasDownloads(peers []node.PeerStatus) bool {
+	for _, p := range peers {
+		if p.BlocksDownloaded > 0 || p.AverageLatencyMs > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func runStatus(ctx context.Context, client adminRequester, w io.Writer) error {
+	status, err := queryStatus(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	return printStatus(w, status)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koinos/koinos-p2p/internal/node"
+)
+
+type testStatusResponder struct {
+	status  *node.Status
+	rpcType string
+}
+
+func (t *testStatusResponder) RPCContext(ctx context.Context, contentType string, rpcType string, args []byte) ([]byte, error) {
+	t.rpcType = rpcType
+	if t.status == nil {
+		return nil, errors.New("no responder")
+	}
+
+	return json.Marshal(t.status)
+}
+
+func TestStatusCommand(t *testing.T) {
+	lastSeen := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	responder := &testStatusResponder{
+		status: &node.Status{
+			ID:            "QmNode",
+			Address:       "/ip4/127.0.0.1/tcp/8888/p2p/QmNode",
+			GossipEnabled: true,
+			Peers: []node.PeerStatus{
+				{ID: "QmPeerA", Address: "/ip4/10.0.0.1/tcp/8888", Synced: true, LastSeen: lastSeen, UptimeSeconds: 90},
+				{ID: "QmPeerB", Address: "/ip4/10.0.0.2/tcp/8888", Synced: false, LastSeen: lastSeen, UptimeSeconds: 5},
+			},
+		},
+	}
+
+	var out bytes.Buffer
+	err := runStatus(context.Background(), responder, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if responder.rpcType != node.StatusRPC {
+		t.Errorf("Status requested on wrong RPC type. Expected %s, was %s", node.StatusRPC, responder.rpcType)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	expected := [][]string{
+		{"ID:", "QmNode"},
+		{"Address:", "/ip4/127.0.0.1/tcp/8888/p2p/QmNode"},
+		{"Gossip:", "enabled"},
+		{"Standby:", "false"},
+		{"Isolated:", "false"},
+		{"Outage:", "false"},
+		{"Peers:", "2"},
+		{},
+		{"PEER", "ADDRESS", "SYNCED", "UPTIME", "LAST-SEEN"},
+		{"QmPeerA", "/ip4/10.0.0.1/tcp/8888", "true", "1m30s", "2022-05-01T12:00:00Z"},
+		{"QmPeerB", "/ip4/10.0.0.2/tcp/8888", "false", "5s", "2022-05-01T12:00:00Z"},
+	}
+
+	if len(lines) != len(expected) {
+		t.Fatalf("Unexpected number of output lines. Expected %v, was %v:\n%s", len(expected), len(lines), out.String())
+	}
+
+	for i, fields := range expected {
+		actual := strings.Fields(lines[i])
+		if strings.Join(actual, " ") != strings.Join(fields, " ") {
+			t.Errorf("Unexpected output on line %v. Expected %v, was %v", i, fields, actual)
+		}
+	}
+}
+
+func TestStatusCommandError(t *testing.T) {
+	var out bytes.Buffer
+	err := runStatus(context.Background(), &testStatusResponder{}, &out)
+	if err == nil {
+		t.Error("Expected an error when the node does not respond")
+	}
+
+	if out.Len() != 0 {
+		t.Errorf("Expected no output on error, was: %s", out.String())
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+// getIntOption fetches an int cli value, respecting values in a given config.
+// It follows the precedence of the util option getters, which have no int variant.
+func getIntOption(key string, defaultValue int, cliArg int, configs ...map[string]interface{}) int {
+	if cliArg != defaultValue {
+		return cliArg
+	}
+
+	for _, config := range configs {
+		if v, ok := config[key]; ok {
+			if option, ok := v.(int); ok && option != defaultValue {
+				return option
+			}
+		}
+	}
+
+	return defaultValue
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestGetIntOption(t *testing.T) {
+	config := map[string]interface{}{"ready-min-peers": 3}
+
+	if value := getIntOption("ready-min-peers", 1, 1, config); value != 3 {
+		t.Errorf("Expected the config value to be used, was %v", value)
+	}
+	if value := getIntOption("ready-min-peers", 1, 5, config); value != 5 {
+		t.Errorf("Expected the cli value to take precedence, was %v", value)
+	}
+	if value := getIntOption("ready-min-peers", 1, 1, map[string]interface{}{}); value != 1 {
+		t.Errorf("Expected the default value without a config value, was %v", value)
+	}
+}
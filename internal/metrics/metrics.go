@@ -0,0 +1,182 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "koinos_p2p"
+
+// Collector tracks node metrics for Prometheus. A nil Collector discards all metrics.
+type Collector struct {
+	registry *prometheus.Registry
+
+	connectedPeers prometheus.Gauge
+	gossipEnabled  prometheus.Gauge
+	gossipRatio    prometheus.Gauge
+	peerErrors     *prometheus.CounterVec
+	gossipVotes    *prometheus.CounterVec
+
+	droppedPeerErrors    prometheus.Counter
+	coalescedGossipVotes prometheus.Counter
+	blocksDownloaded     prometheus.Counter
+}
+
+// NewCollector creates a Collector with its own registry
+func NewCollector() *Collector {
+	c := &Collector{
+		registry: prometheus.NewRegistry(),
+		connectedPeers: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "connected_peers",
+			Help:      "Number of peers currently connected",
+		}),
+		gossipEnabled: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "gossip_enabled",
+			Help:      "Whether gossip is enabled (1) or disabled (0)",
+		}),
+		gossipRatio: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "gossip_vote_ratio",
+			Help:      "Fraction of voting peers that reported the node as synced",
+		}),
+		peerErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "peer_errors_total",
+			Help:      "Number of errors reported for peers, by reason",
+		}, []string{"reason"}),
+		gossipVotes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "gossip_votes_total",
+			Help:      "Number of gossip votes received from peers, by whether the peer was synced",
+		}, []string{"synced"}),
+		droppedPeerErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "peer_errors_dropped_total",
+			Help:      "Number of peer errors dropped because the peer connection's error queue was full",
+		}),
+		coalescedGossipVotes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "gossip_votes_coalesced_total",
+			Help:      "Number of gossip votes replaced by a newer vote from the same peer before being handled",
+		}),
+		blocksDownloaded: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "blocks_downloaded_total",
+			Help:      "Number of blocks downloaded from peers by block requests",
+		}),
+	}
+
+	c.registry.MustRegister(c.connectedPeers, c.gossipEnabled, c.gossipRatio, c.peerErrors, c.gossipVotes, c.droppedPeerErrors, c.coalescedGossipVotes, c.blocksDownloaded)
+
+	return c
+}
+
+// SetConnectedPeers records the number of connected peers
+func (c *Collector) SetConnectedPeers(count int) {
+	if c == nil {
+		return
+	}
+
+	c.connectedPeers.Set(float64(count))
+}
+
+// SetGossipEnabled records whether gossip is enabled
+func (c *Collector) SetGossipEnabled(enabled bool) {
+	if c == nil {
+		return
+	}
+
+	if enabled {
+		c.gossipEnabled.Set(1)
+	} else {
+		c.gossipEnabled.Set(0)
+	}
+}
+
+// SetGossipVoteRatio records the fraction of voting peers that reported the node as synced
+func (c *Collector) SetGossipVoteRatio(ratio float64) {
+	if c == nil {
+		return
+	}
+
+	c.gossipRatio.Set(ratio)
+}
+
+// RecordPeerError counts a peer error with the given reason
+func (c *Collector) RecordPeerError(reason string) {
+	if c == nil {
+		return
+	}
+
+	c.peerErrors.WithLabelValues(reason).Inc()
+}
+
+// RecordGossipVote counts a gossip vote from a peer
+func (c *Collector) RecordGossipVote(synced bool) {
+	if c == nil {
+		return
+	}
+
+	c.gossipVotes.WithLabelValues(strconv.FormatBool(synced)).Inc()
+}
+
+// RecordDroppedPeerError counts a peer error dropped before being handled
+func (c *Collector) RecordDroppedPeerError() {
+	if c == nil {
+		return
+	}
+
+	c.droppedPeerErrors.Inc()
+}
+
+// RecordCoalescedGossipVote counts a gossip vote replaced by a newer vote before being handled
+func (c *Collector) RecordCoalescedGossipVote() {
+	if c == nil {
+		return
+	}
+
+	c.coalescedGossipVotes.Inc()
+}
+
+// RecordBlocksDownloaded counts blocks downloaded from a peer
+func (c *Collector) RecordBlocksDownloaded(count int) {
+	if c == nil {
+		return
+	}
+
+	c.blocksDownloaded.Add(float64(count))
+}
+
+// Registry returns the registry the metrics are registered with
+func (c *Collector) Registry() *prometheus.Registry {
+	return c.registry
+}
+
+// Handler returns an http.Handler serving the metrics in the Prometheus exposition format
+func (c *Collector) Handler() http.Handler {
+	return promhttp.HandlerFor(c.registry, promhttp.HandlerOpts{})
+}
+
+// ListenAndServe serves the metrics at /metrics on the given address until the context is done
+func (c *Collector) ListenAndServe(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", c.Handler())
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
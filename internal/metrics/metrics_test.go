@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	c := NewCollector()
+
+	c.SetConnectedPeers(3)
+	c.SetGossipEnabled(true)
+	c.SetGossipVoteRatio(0.75)
+	c.RecordPeerError("peer RPC error")
+	c.RecordPeerError("peer RPC error")
+	c.RecordPeerError("block application failed")
+	c.RecordGossipVote(true)
+	c.RecordGossipVote(false)
+	c.RecordGossipVote(true)
+	c.RecordDroppedPeerError()
+	c.RecordCoalescedGossipVote()
+	c.RecordCoalescedGossipVote()
+	c.RecordBlocksDownloaded(10)
+	c.RecordBlocksDownloaded(5)
+
+	if v := testutil.ToFloat64(c.connectedPeers); v != 3 {
+		t.Errorf("Expected 3 connected peers, was %v", v)
+	}
+
+	if v := testutil.ToFloat64(c.gossipEnabled); v != 1 {
+		t.Errorf("Expected gossip to be enabled, was %v", v)
+	}
+
+	if v := testutil.ToFloat64(c.gossipRatio); v != 0.75 {
+		t.Errorf("Expected gossip vote ratio of 0.75, was %v", v)
+	}
+
+	if v := testutil.ToFloat64(c.peerErrors.WithLabelValues("peer RPC error")); v != 2 {
+		t.Errorf("Expected 2 peer RPC errors, was %v", v)
+	}
+
+	if v := testutil.ToFloat64(c.gossipVotes.WithLabelValues("true")); v != 2 {
+		t.Errorf("Expected 2 synced gossip votes, was %v", v)
+	}
+
+	if v := testutil.ToFloat64(c.gossipVotes.WithLabelValues("false")); v != 1 {
+		t.Errorf("Expected 1 unsynced gossip vote, was %v", v)
+	}
+
+	if v := testutil.ToFloat64(c.droppedPeerErrors); v != 1 {
+		t.Errorf("Expected 1 dropped peer error, was %v", v)
+	}
+
+	if v := testutil.ToFloat64(c.coalescedGossipVotes); v != 2 {
+		t.Errorf("Expected 2 coalesced gossip votes, was %v", v)
+	}
+
+	if v := testutil.ToFloat64(c.blocksDownloaded); v != 15 {
+		t.Errorf("Expected 15 downloaded blocks, was %v", v)
+	}
+
+	recorder := httptest.NewRecorder()
+	c.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(recorder.Body.String(), "koinos_p2p_connected_peers 3") {
+		t.Errorf("Expected connected peers in metrics output, was %s", recorder.Body.String())
+	}
+}
+
+func TestNilCollector(t *testing.T) {
+	var c *Collector
+
+	c.SetConnectedPeers(1)
+	c.SetGossipEnabled(true)
+	c.SetGossipVoteRatio(1)
+	c.RecordPeerError("peer RPC error")
+	c.RecordGossipVote(true)
+	c.RecordDroppedPeerError()
+	c.RecordCoalescedGossipVote()
+	c.RecordBlocksDownloaded(1)
+}
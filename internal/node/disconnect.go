@@ -0,0 +1,68 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	log "github.com/koinos/koinos-log-golang"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// DisconnectRPC is the AMQP RPC type on which an operator disconnects a peer
+const DisconnectRPC = "p2p_disconnect"
+
+// DisconnectRequest is a request to disconnect a peer
+type DisconnectRequest struct {
+	PeerID string `json:"peer_id"`
+	// BanSeconds prevents connections to and from the peer for this many seconds, if not zero
+	BanSeconds uint64 `json:"ban_seconds"`
+}
+
+// DisconnectResult is the result of a disconnect request
+type DisconnectResult struct {
+	Disconnected bool   `json:"disconnected"`
+	Error        string `json:"error,omitempty"`
+}
+
+// DisconnectPeer disconnects a connected peer, so it is not reconnected even if it is an initial
+// peer. If ban is not zero, connections to and from the peer are refused for that long. The ban is
+// recorded before the connection is closed, so the peer can not reconnect in between.
+func (n *KoinosP2PNode) DisconnectPeer(ctx context.Context, id peer.ID, ban time.Duration) error {
+	if ban > 0 {
+		if err := n.PeerErrorHandler.Ban(ctx, id, ban); err != nil {
+			return err
+		}
+	}
+
+	return n.ConnectionManager.DisconnectPeer(ctx, id)
+}
+
+func (n *KoinosP2PNode) disconnectFromRequest(ctx context.Context, data []byte) error {
+	req := &DisconnectRequest{}
+	if err := json.Unmarshal(data, req); err != nil {
+		return err
+	}
+
+	id, err := peer.Decode(req.PeerID)
+	if err != nil {
+		return err
+	}
+
+	return n.DisconnectPeer(ctx, id, time.Duration(req.BanSeconds)*time.Second)
+}
+
+func (n *KoinosP2PNode) handleDisconnectRPC(rpcType string, data []byte) ([]byte, error) {
+	log.Debug("Received disconnect request")
+
+	ctx, cancel := context.WithTimeout(context.Background(), statusRequestTimeout)
+	defer cancel()
+
+	result := &DisconnectResult{Disconnected: true}
+	if err := n.disconnectFromRequest(ctx, data); err != nil {
+		log.Warnf("Could not disconnect peer: %s", err.Error())
+		result = &DisconnectResult{Error: err.Error()}
+	}
+
+	return json.Marshal(result)
+}
@@ -7,13 +7,19 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync/atomic"
 	"time"
 
 	log "github.com/koinos/koinos-log-golang"
 	koinosmq "github.com/koinos/koinos-mq-golang"
+	"github.com/koinos/koinos-p2p/internal/metrics"
 	"github.com/koinos/koinos-p2p/internal/options"
 	"github.com/koinos/koinos-p2p/internal/p2p"
 	"github.com/koinos/koinos-p2p/internal/rpc"
@@ -26,13 +32,16 @@ import (
 
 	libp2p "github.com/libp2p/go-libp2p"
 	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/event"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/libp2p/go-libp2p-core/routing"
 	dht "github.com/libp2p/go-libp2p-kad-dht"
+	noise "github.com/libp2p/go-libp2p-noise"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	libp2ptls "github.com/libp2p/go-libp2p-tls"
 	multiaddr "github.com/multiformats/go-multiaddr"
 
 	"google.golang.org/protobuf/proto"
@@ -47,68 +56,125 @@ type KoinosP2PNode struct {
 	PeerErrorHandler  *p2p.PeerErrorHandler
 	GossipToggle      *p2p.GossipToggle
 	TransactionCache  *p2p.TransactionCache
+	Metrics           *metrics.Collector
 	libValue          atomic.Value
 
 	PeerErrorChan        chan p2p.PeerError
+	PeerRewardChan       chan peer.ID
 	DisconnectPeerChan   chan peer.ID
 	GossipVoteChan       chan p2p.GossipVote
 	PeerDisconnectedChan chan peer.ID
 
 	Options options.NodeOptions
+
+	dialTimeout time.Duration
 }
 
 const (
 	transactionCacheDuration = time.Minute * 10
+	readyCheckInterval       = time.Millisecond * 500
 )
 
 // NewKoinosP2PNode creates a libp2p node object listening on the given multiaddress
-// uses secio encryption on the wire
+// connections are secured with the security transport in config.NodeOptions.Security
 // listenAddr is a multiaddress string on which to listen
 // seed is the random seed to use for key generation. Use 0 for a random seed.
+// A key stored in config.NodeOptions.IdentityKeyFile takes precedence over the seed.
 func NewKoinosP2PNode(ctx context.Context, listenAddr string, localRPC rpc.LocalRPC, requestHandler *koinosmq.RequestHandler, seed string, config *options.Config) (*KoinosP2PNode, error) {
-	privateKey, err := generatePrivateKey(seed)
+	privateKey, err := loadPrivateKey(config.NodeOptions.IdentityKeyFile, seed, config.NodeOptions.KeyType)
 	if err != nil {
 		return nil, err
 	}
 
+	if config.PeerConnectionOptions.DialTimeout <= 0 {
+		return nil, fmt.Errorf("dial timeout must be positive, was %v", config.PeerConnectionOptions.DialTimeout)
+	}
+
+	if config.PeerConnectionOptions.MaxReconnects <= 0 {
+		return nil, fmt.Errorf("max reconnects must be positive, was %v", config.PeerConnectionOptions.MaxReconnects)
+	}
+
+	if config.PeerConnectionOptions.BackoffJitter < 0 || config.PeerConnectionOptions.BackoffJitter > 1 {
+		return nil, fmt.Errorf("backoff jitter must be between 0 and 1, was %v", config.PeerConnectionOptions.BackoffJitter)
+	}
+
+	if config.PeerConnectionOptions.PeerErrorQueueSize < 0 {
+		return nil, fmt.Errorf("peer error queue size must not be negative, was %v", config.PeerConnectionOptions.PeerErrorQueueSize)
+	}
+
+	if config.NodeOptions.ReadyMinPeers < 0 {
+		return nil, fmt.Errorf("ready min peers must not be negative, was %v", config.NodeOptions.ReadyMinPeers)
+	}
+
 	node := new(KoinosP2PNode)
 
 	node.Options = config.NodeOptions
+	node.dialTimeout = config.PeerConnectionOptions.DialTimeout
 	node.PeerErrorChan = make(chan p2p.PeerError)
+	node.PeerRewardChan = make(chan peer.ID)
 	node.DisconnectPeerChan = make(chan peer.ID)
 	node.GossipVoteChan = make(chan p2p.GossipVote)
 	node.PeerDisconnectedChan = make(chan peer.ID)
+	node.Metrics = metrics.NewCollector()
+
+	registry, err := p2p.LoadPeerRegistry(&config.RegistryOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateRegisteredPeers(registry, config.NodeOptions.InitialPeers, config.NodeOptions.DirectPeers); err != nil {
+		return nil, err
+	}
+
+	whitelist := p2p.NewWhitelist(&config.WhitelistOptions)
 
 	node.PeerErrorHandler = p2p.NewPeerErrorHandler(
 		node.DisconnectPeerChan,
 		node.PeerErrorChan,
+		node.PeerRewardChan,
+		node.Metrics,
+		registry,
+		whitelist,
 		config.PeerErrorHandlerOptions)
 
+	security, err := securityOptions(config.NodeOptions.Security)
+	if err != nil {
+		return nil, err
+	}
+
 	var idht *dht.IpfsDHT
 
 	options := []libp2p.Option{
 		libp2p.ListenAddrStrings(listenAddr),
 		libp2p.Identity(privateKey),
-		// Attempt to open ports using uPNP for NATed hosts.
-		libp2p.NATPortMap(),
 		// Let this host use the DHT to find other hosts
 		libp2p.Routing(func(h host.Host) (routing.PeerRouting, error) {
 			idht, err = dht.New(ctx, h)
 			return idht, err
 		}),
-		// Let this host use relays and advertise itself on relays if
-		// it finds it is behind NAT. Use libp2p.Relay(options...) to
-		// enable active relays and more.
-		libp2p.EnableAutoRelay(),
-		// If you want to help other peers to figure out if they are behind
-		// NATs, you can launch the server-side of AutoNAT too (AutoRelay
-		// already runs the client)
-		//
-		// This service is highly rate-limited and should not cause any
-		// performance issues.
-		libp2p.EnableNATService(),
 		libp2p.ConnectionGater(node.PeerErrorHandler),
 	}
+	options = append(options, security...)
+
+	if config.NodeOptions.EnableNAT {
+		options = append(options,
+			// Attempt to open ports using uPNP for NATed hosts.
+			libp2p.NATPortMap(),
+			// Let this host use relays and advertise itself on relays if
+			// it finds it is behind NAT. Use libp2p.Relay(options...) to
+			// enable active relays and more.
+			libp2p.EnableAutoRelay(),
+			// If you want to help other peers to figure out if they are behind
+			// NATs, you can launch the server-side of AutoNAT too (AutoRelay
+			// already runs the client)
+			//
+			// This service is highly rate-limited and should not cause any
+			// performance issues.
+			libp2p.EnableNATService(),
+			// Hole punching (DCUtR) is not enabled, the go-libp2p version in use panics
+			// when closing a host that never became privately reachable
+		)
+	}
 
 	host, err := libp2p.New(options...)
 	if err != nil {
@@ -123,16 +189,21 @@ func NewKoinosP2PNode(ctx context.Context, listenAddr string, localRPC rpc.Local
 		requestHandler.SetBroadcastHandler("koinos.mempool.accept", node.handleTransactionBroadcast)
 		requestHandler.SetBroadcastHandler("koinos.block.forks", node.handleForkUpdate)
 		requestHandler.SetRPCHandler("p2p", node.handleRPC)
+		requestHandler.SetRPCHandler(StatusRPC, node.handleStatusRPC)
+		requestHandler.SetRPCHandler(PromoteRPC, node.handlePromoteRPC)
+		requestHandler.SetRPCHandler(PeersRPC, node.handlePeersRPC)
+		requestHandler.SetRPCHandler(DisconnectRPC, node.handleDisconnectRPC)
 	} else {
 		log.Info("Starting P2P node without broadcast listeners")
 	}
 
 	pubsub.TimeCacheDuration = 60 * time.Second
-	ps, err := pubsub.NewGossipSub(
-		ctx, node.Host,
-		pubsub.WithMessageIdFn(generateMessageID),
-		pubsub.WithPeerExchange(true),
-	)
+	gossipOptions, err := gossipSubOptions(&config.GossipOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	ps, err := pubsub.NewGossipSub(ctx, node.Host, gossipOptions...)
 	if err != nil {
 		return nil, err
 	}
@@ -144,23 +215,37 @@ func NewKoinosP2PNode(ctx context.Context, listenAddr string, localRPC rpc.Local
 		node.localRPC,
 		ps,
 		node.PeerErrorChan,
+		node.PeerRewardChan,
 		node.Host.ID(),
 		node,
-		node.TransactionCache)
+		node.TransactionCache,
+		&config.GossipOptions)
+
+	if err := validateGossipToggleOptions(&config.GossipToggleOptions); err != nil {
+		return nil, err
+	}
 
 	node.GossipToggle = p2p.NewGossipToggle(
 		node.Gossip,
 		node.localRPC,
 		node.GossipVoteChan,
 		node.PeerDisconnectedChan,
+		node.Metrics,
 		config.GossipToggleOptions)
 
 	node.ConnectionManager = p2p.NewConnectionManager(
 		node.Host,
 		node.localRPC,
 		&config.PeerConnectionOptions,
+		&config.IsolationOptions,
+		&config.PeerRPCServiceOptions,
+		whitelist,
+		registry,
 		node,
+		node.Metrics,
 		node.Options.InitialPeers,
+		node.Options.DirectPeers,
+		node.Options.Standby,
 		node.PeerErrorChan,
 		node.GossipVoteChan,
 		node.PeerDisconnectedChan)
@@ -177,8 +262,8 @@ func (n *KoinosP2PNode) handleBlockBroadcast(topic string, data []byte) {
 		return
 	}
 
-	// If gossip is enabled publish the block
-	if n.GossipToggle.IsEnabled() {
+	// If gossip is enabled and we have peers publish the block
+	if n.GossipToggle.IsEnabled() && !n.ConnectionManager.IsIsolated() {
 		err = n.Gossip.PublishBlock(context.Background(), blockBroadcast.Block)
 		if err != nil {
 			log.Warnf("Unable to serialize block from broadcast: %v", err.Error())
@@ -196,8 +281,8 @@ func (n *KoinosP2PNode) handleTransactionBroadcast(topic string, data []byte) {
 		return
 	}
 
-	// If gossip is enabled publish the transaction
-	if n.GossipToggle.IsEnabled() {
+	// If gossip is enabled and we have peers publish the transaction
+	if n.GossipToggle.IsEnabled() && !n.ConnectionManager.IsIsolated() {
 		err = n.Gossip.PublishTransaction(context.Background(), trxBroadcast.Transaction)
 		if err != nil {
 			log.Warnf("Unable to serialize transaction from broadcast: %v", err.Error())
@@ -281,7 +366,15 @@ func (n *KoinosP2PNode) PeerStringToAddress(peerAddr string) (*peer.AddrInfo, er
 
 // ConnectToPeerAddress connects to the given peer address
 func (n *KoinosP2PNode) ConnectToPeerAddress(ctx context.Context, peer *peer.AddrInfo) error {
-	return n.Host.Connect(ctx, *peer)
+	return ConnectWithTimeout(ctx, n.Host, peer, n.dialTimeout)
+}
+
+// ConnectWithTimeout connects the host to the given peer address, giving up after dialTimeout
+func ConnectWithTimeout(ctx context.Context, h host.Host, peer *peer.AddrInfo, dialTimeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+
+	return h.Connect(ctx, *peer)
 }
 
 // GetConnections returns the host's current peer connections
@@ -297,9 +390,18 @@ func (n *KoinosP2PNode) GetAddressInfo() *peer.AddrInfo {
 	}
 }
 
-// GetAddress returns the peer multiaddress
+// GetAddress returns the peer multiaddress, or nil if the host is not listening on any address
 func (n *KoinosP2PNode) GetAddress() multiaddr.Multiaddr {
-	addrs, _ := peer.AddrInfoToP2pAddrs(n.GetAddressInfo())
+	// Without a listen address, only a bare /p2p/ address would be returned, which peers cannot dial
+	if len(n.Host.Addrs()) == 0 {
+		return nil
+	}
+
+	addrs, err := peer.AddrInfoToP2pAddrs(n.GetAddressInfo())
+	if err != nil {
+		return nil
+	}
+
 	return addrs[0]
 }
 
@@ -309,7 +411,11 @@ func (n *KoinosP2PNode) GetLastIrreversibleBlock() *koinos.BlockTopology {
 }
 
 // Close closes the node
-func (n *KoinosP2PNode) Close() error {
+func (n *KoinosP2PNode) Close(ctx context.Context) error {
+	if err := n.ConnectionManager.Stop(ctx); err != nil {
+		log.Warnf("Closing the node before requests to peers finished: %s", err)
+	}
+
 	if err := n.Host.Close(); err != nil {
 		return err
 	}
@@ -321,8 +427,12 @@ func (n *KoinosP2PNode) logConnectionsLoop(ctx context.Context) {
 	for {
 		select {
 		case <-time.After(time.Minute * 1):
-			log.Info("My address:")
-			log.Infof(" - %s", n.GetAddress())
+			if addr := n.GetAddress(); addr != nil {
+				log.Info("My address:")
+				log.Infof(" - %s", addr)
+			} else {
+				log.Info("Not listening on any address")
+			}
 			log.Info("Connected peers:")
 			for i, conn := range n.GetConnections() {
 				log.Infof(" - %s/p2p/%s", conn.RemoteMultiaddr(), conn.RemotePeer())
@@ -337,6 +447,109 @@ func (n *KoinosP2PNode) logConnectionsLoop(ctx context.Context) {
 	}
 }
 
+func (n *KoinosP2PNode) announceAddresses() {
+	announcement := &rpc.AddressAnnouncement{
+		ID:        n.Host.ID().Pretty(),
+		Addresses: make([]string, 0),
+	}
+
+	addrs, _ := peer.AddrInfoToP2pAddrs(n.GetAddressInfo())
+	for _, addr := range addrs {
+		announcement.Addresses = append(announcement.Addresses, addr.String())
+	}
+
+	if err := n.localRPC.BroadcastAddresses(announcement); err != nil {
+		log.Warnf("Unable to broadcast node addresses: %s", err.Error())
+	}
+}
+
+func (n *KoinosP2PNode) announceAddressesLoop(ctx context.Context, sub event.Subscription) {
+	defer sub.Close()
+
+	n.announceAddresses()
+
+	for {
+		select {
+		case <-sub.Out():
+			n.announceAddresses()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (n *KoinosP2PNode) logReachabilityLoop(ctx context.Context, sub event.Subscription) {
+	defer sub.Close()
+
+	for {
+		select {
+		case evt := <-sub.Out():
+			reachability := evt.(event.EvtLocalReachabilityChanged).Reachability
+			if reachability == network.ReachabilityPublic {
+				log.Infof("AutoNAT determined the node is publicly reachable at: %v", n.Host.Addrs())
+			} else {
+				log.Infof("AutoNAT determined the node is %s", reachability)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// isReady returns true once the node is listening, connected to the local node's services,
+// serving peers, and connected to enough peers
+func (n *KoinosP2PNode) isReady(ctx context.Context) bool {
+	if n.GetAddress() == nil || n.ConnectionManager.IsStandby() {
+		return false
+	}
+
+	if connected, err := n.localRPC.IsConnectedToChain(ctx); err != nil || !connected {
+		return false
+	}
+
+	if connected, err := n.localRPC.IsConnectedToBlockStore(ctx); err != nil || !connected {
+		return false
+	}
+
+	return len(n.ConnectionManager.GetConnectedPeers(ctx)) >= n.Options.ReadyMinPeers
+}
+
+func (n *KoinosP2PNode) announceReadyLoop(ctx context.Context) {
+	for {
+		select {
+		case <-time.After(readyCheckInterval):
+		case <-ctx.Done():
+			return
+		}
+
+		checkCtx, cancel := context.WithTimeout(ctx, readyCheckInterval)
+		ready := n.isReady(checkCtx)
+		cancel()
+
+		if !ready {
+			continue
+		}
+
+		announcement := &rpc.ReadyAnnouncement{
+			ID:        n.Host.ID().Pretty(),
+			Addresses: make([]string, 0),
+			Peers:     len(n.Host.Network().Peers()),
+		}
+
+		addrs, _ := peer.AddrInfoToP2pAddrs(n.GetAddressInfo())
+		for _, addr := range addrs {
+			announcement.Addresses = append(announcement.Addresses, addr.String())
+		}
+
+		log.Info("Node is ready")
+		if err := n.localRPC.BroadcastReady(announcement); err != nil {
+			log.Warnf("Unable to broadcast ready event: %s", err.Error())
+		}
+
+		return
+	}
+}
+
 // Start starts background goroutines
 func (n *KoinosP2PNode) Start(ctx context.Context) {
 	n.Host.Network().Notify(n.ConnectionManager)
@@ -355,6 +568,28 @@ func (n *KoinosP2PNode) Start(ctx context.Context) {
 	n.GossipToggle.Start(ctx)
 	n.ConnectionManager.Start(ctx)
 
+	if n.Options.AnnounceAddresses {
+		sub, err := n.Host.EventBus().Subscribe(new(event.EvtLocalAddressesUpdated))
+		if err != nil {
+			log.Warnf("Unable to subscribe to address updates: %s", err.Error())
+		} else {
+			go n.announceAddressesLoop(ctx, sub)
+		}
+	}
+
+	if n.Options.AnnounceReady {
+		go n.announceReadyLoop(ctx)
+	}
+
+	if n.Options.EnableNAT {
+		sub, err := n.Host.EventBus().Subscribe(new(event.EvtLocalReachabilityChanged))
+		if err != nil {
+			log.Warnf("Unable to subscribe to reachability updates: %s", err.Error())
+		} else {
+			go n.logReachabilityLoop(ctx, sub)
+		}
+	}
+
 	go func() {
 		for {
 			select {
@@ -380,9 +615,63 @@ func seedStringToInt64(seed string) int64 {
 	return int64(binary.BigEndian.Uint64(sum[:8]))
 }
 
-func generatePrivateKey(seed string) (crypto.PrivKey, error) {
+const rsaKeyBits = 2048
+
+func parseKeyType(keyType string) (int, error) {
+	switch strings.ToLower(keyType) {
+	case "ed25519":
+		return crypto.Ed25519, nil
+	case "secp256k1":
+		return crypto.Secp256k1, nil
+	case "ecdsa":
+		return crypto.ECDSA, nil
+	case "rsa":
+		log.Warn("RSA identity keys are slow to handshake and produce large peer IDs, consider ed25519")
+		return crypto.RSA, nil
+	default:
+		return 0, fmt.Errorf("unknown key type %s, must be one of ed25519, secp256k1, ecdsa, rsa", keyType)
+	}
+}
+
+// securityOptions returns the libp2p options for the named security transport
+func securityOptions(security string) ([]libp2p.Option, error) {
+	noiseSecurity := libp2p.Security(noise.ID, noise.New)
+	tlsSecurity := libp2p.Security(libp2ptls.ID, libp2ptls.New)
+
+	switch strings.ToLower(security) {
+	case "noise":
+		return []libp2p.Option{noiseSecurity}, nil
+	case "tls":
+		return []libp2p.Option{tlsSecurity}, nil
+	case "all":
+		return []libp2p.Option{noiseSecurity, tlsSecurity}, nil
+	default:
+		return nil, fmt.Errorf("unknown security transport %s, must be one of noise, tls, all", security)
+	}
+}
+
+func generatePrivateKey(seed string, keyType string) (crypto.PrivKey, error) {
 	var r io.Reader
 
+	// Seeded keys were always ecdsa, keep them so seeded nodes keep their peer IDs
+	if keyType == "" {
+		if seed != "" {
+			keyType = "ecdsa"
+		} else {
+			keyType = "ed25519"
+		}
+	}
+
+	typ, err := parseKeyType(keyType)
+	if err != nil {
+		return nil, err
+	}
+
+	// libp2p generates secp256k1 keys from its own randomness, ignoring the seeded reader
+	if typ == crypto.Secp256k1 && seed != "" {
+		return nil, errors.New("secp256k1 identity keys can not be generated from a seed")
+	}
+
 	// If blank seed, generate a new randomized seed
 	if seed == "" {
 		seed = util.GenerateBase58ID(8)
@@ -393,7 +682,7 @@ func generatePrivateKey(seed string) (crypto.PrivKey, error) {
 	iseed := seedStringToInt64(seed)
 	r = rand.New(rand.NewSource(iseed))
 
-	privateKey, _, err := crypto.GenerateECDSAKeyPair(r)
+	privateKey, _, err := crypto.GenerateKeyPairWithReader(typ, rsaKeyBits, r)
 	if err != nil {
 		return nil, err
 	}
@@ -401,6 +690,180 @@ func generatePrivateKey(seed string) (crypto.PrivKey, error) {
 	return privateKey, nil
 }
 
+// loadPrivateKey loads the private key stored in keyFile. If keyFile does not exist, a key is
+// generated from the seed and written to keyFile. If keyFile is empty, the key is generated from the seed.
+func loadPrivateKey(keyFile string, seed string, keyType string) (crypto.PrivKey, error) {
+	if keyFile == "" {
+		return generatePrivateKey(seed, keyType)
+	}
+
+	data, err := ioutil.ReadFile(keyFile)
+	if err == nil {
+		if seed != "" {
+			log.Warnf("Using identity key from %s, ignoring seed", keyFile)
+		}
+
+		privateKey, err := crypto.UnmarshalPrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse identity key file %s: %w", keyFile, err)
+		}
+
+		return privateKey, nil
+	}
+
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not read identity key file %s: %w", keyFile, err)
+	}
+
+	privateKey, err := generatePrivateKey(seed, keyType)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = crypto.MarshalPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0700); err != nil {
+		return nil, fmt.Errorf("could not create identity key directory: %w", err)
+	}
+
+	if err := ioutil.WriteFile(keyFile, data, 0600); err != nil {
+		return nil, fmt.Errorf("could not write identity key file %s: %w", keyFile, err)
+	}
+
+	log.Infof("Wrote new identity key to %s", keyFile)
+
+	return privateKey, nil
+}
+
+func gossipSubOptions(opts *options.GossipOptions) ([]pubsub.Option, error) {
+	params := pubsub.DefaultGossipSubParams()
+	if opts.Dout < 0 || opts.Dout >= params.Dlo || opts.Dout > params.D/2 {
+		return nil, fmt.Errorf("gossip Dout must be below %v and at most %v, was %v", params.Dlo, params.D/2, opts.Dout)
+	}
+	params.Dout = opts.Dout
+
+	if opts.MaxBlockMessageSize <= 0 || opts.MaxTransactionMessageSize <= 0 {
+		return nil, fmt.Errorf("gossip message size limits must be positive, were %v and %v", opts.MaxBlockMessageSize, opts.MaxTransactionMessageSize)
+	}
+
+	// The router limit must allow the largest message on any topic, topic validators enforce the per-topic limits
+	maxMessageSize := opts.MaxBlockMessageSize
+	if opts.MaxTransactionMessageSize > maxMessageSize {
+		maxMessageSize = opts.MaxTransactionMessageSize
+	}
+
+	gossipOptions := []pubsub.Option{
+		pubsub.WithMessageIdFn(generateMessageID),
+		pubsub.WithPeerExchange(true),
+		pubsub.WithGossipSubParams(params),
+		pubsub.WithFloodPublish(opts.FloodPublish),
+		pubsub.WithMaxMessageSize(maxMessageSize),
+	}
+
+	if opts.MeshDemotion {
+		scoreOption, err := meshDemotionOption(opts)
+		if err != nil {
+			return nil, err
+		}
+		gossipOptions = append(gossipOptions, scoreOption)
+	}
+
+	return gossipOptions, nil
+}
+
+// meshDemotionOption enables gossipsub peer scoring on the block topic. A block topic mesh peer that
+// delivers too few new blocks gets a negative score, and gossipsub prunes peers with negative scores
+// from the mesh, grafting better scoring topic peers in their place.
+func meshDemotionOption(opts *options.GossipOptions) (pubsub.Option, error) {
+	if opts.MeshDeliveryThreshold <= 0 {
+		return nil, fmt.Errorf("mesh delivery threshold must be positive, was %v", opts.MeshDeliveryThreshold)
+	}
+
+	if opts.MeshDeliveryActivation < time.Second || opts.MeshDeliveryDecay < time.Second {
+		return nil, fmt.Errorf("mesh delivery activation and decay must be at least 1s, were %v and %v", opts.MeshDeliveryActivation, opts.MeshDeliveryDecay)
+	}
+
+	decay := pubsub.ScoreParameterDecay(opts.MeshDeliveryDecay)
+
+	blockTopic := &pubsub.TopicScoreParams{
+		TopicWeight:       1,
+		TimeInMeshQuantum: time.Second,
+
+		// Reward peers for being first to deliver a block, so active peers outscore idle ones
+		FirstMessageDeliveriesWeight: 1,
+		FirstMessageDeliveriesDecay:  decay,
+		FirstMessageDeliveriesCap:    opts.MeshDeliveryThreshold * 2,
+
+		// Penalize mesh peers delivering fewer blocks than the threshold
+		MeshMessageDeliveriesWeight:     -1,
+		MeshMessageDeliveriesDecay:      decay,
+		MeshMessageDeliveriesCap:        opts.MeshDeliveryThreshold * 2,
+		MeshMessageDeliveriesThreshold:  opts.MeshDeliveryThreshold,
+		MeshMessageDeliveriesWindow:     time.Second,
+		MeshMessageDeliveriesActivation: opts.MeshDeliveryActivation,
+
+		// Keep the penalty after a peer is pruned, so it is not grafted straight back
+		MeshFailurePenaltyWeight: -1,
+		MeshFailurePenaltyDecay:  decay,
+
+		// Invalid blocks are already scored by the peer error handler
+		InvalidMessageDeliveriesDecay: decay,
+	}
+
+	params := &pubsub.PeerScoreParams{
+		Topics:           map[string]*pubsub.TopicScoreParams{p2p.BlockTopicName: blockTopic},
+		AppSpecificScore: func(peer.ID) float64 { return 0 },
+		DecayInterval:    pubsub.DefaultDecayInterval,
+		DecayToZero:      pubsub.DefaultDecayToZero,
+	}
+
+	// Delivery penalties only demote peers from the mesh, they are far above the thresholds
+	// at which gossipsub stops gossiping with or accepting messages from a peer
+	thresholds := &pubsub.PeerScoreThresholds{
+		GossipThreshold:             -1000,
+		PublishThreshold:            -2000,
+		GraylistThreshold:           -4000,
+		AcceptPXThreshold:           0,
+		OpportunisticGraftThreshold: 1,
+	}
+
+	return pubsub.WithPeerScore(params, thresholds), nil
+}
+
+// validateRegisteredPeers checks that the initial and direct peers are in the peer registry, as the connection
+// gater would reject them. Addresses without a peer ID are checked once the peer is identified.
+func validateRegisteredPeers(registry *p2p.PeerRegistry, initialPeers []string, directPeers []string) error {
+	for _, peerStr := range append(append([]string{}, initialPeers...), directPeers...) {
+		addr, err := peer.AddrInfoFromString(peerStr)
+		if err != nil {
+			continue
+		}
+
+		if !registry.IsRegistered(addr.ID) {
+			return fmt.Errorf("peer %s is not in the peer registry", peerStr)
+		}
+	}
+
+	return nil
+}
+
+// validateGossipToggleOptions checks that the disable threshold is below the enable threshold, so gossip
+// can not be both enabled and disabled by the same vote ratio
+func validateGossipToggleOptions(opts *options.GossipToggleOptions) error {
+	if opts.DisableThreshold < 0 || opts.EnableThreshold > 1 || opts.DisableThreshold >= opts.EnableThreshold {
+		return fmt.Errorf("gossip thresholds must satisfy 0 <= disable < enable <= 1, were disable %v and enable %v", opts.DisableThreshold, opts.EnableThreshold)
+	}
+
+	if opts.MinPeers < 0 {
+		return fmt.Errorf("gossip minimum peers must not be negative, was %v", opts.MinPeers)
+	}
+
+	return nil
+}
+
 func generateMessageID(msg *pb.Message) string {
 	// Use the default unique ID function for peer exchange
 	switch *msg.Topic {
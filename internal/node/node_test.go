@@ -2,16 +2,33 @@ package node
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/koinos/koinos-p2p/internal/options"
+	"github.com/koinos/koinos-p2p/internal/p2p"
+	"github.com/koinos/koinos-p2p/internal/rpc"
 	"github.com/koinos/koinos-proto-golang/koinos"
 	"github.com/koinos/koinos-proto-golang/koinos/protocol"
 	"github.com/koinos/koinos-proto-golang/koinos/rpc/block_store"
 	"github.com/koinos/koinos-proto-golang/koinos/rpc/chain"
+	libp2p "github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	pbcrypto "github.com/libp2p/go-libp2p-core/crypto/pb"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/test"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
 	"github.com/multiformats/go-multihash"
 )
 
@@ -76,6 +93,14 @@ func (k *TestRPC) BroadcastGossipStatus(enabled bool) error {
 	return nil
 }
 
+func (k *TestRPC) BroadcastAddresses(announcement *rpc.AddressAnnouncement) error {
+	return nil
+}
+
+func (k *TestRPC) BroadcastReady(announcement *rpc.ReadyAnnouncement) error {
+	return nil
+}
+
 // GetBlocksByHeight rpc call
 func (k *TestRPC) GetBlocksByHeight(ctx context.Context, blockID multihash.Multihash, height uint64, numBlocks uint32) (*block_store.GetBlocksByHeightResponse, error) {
 	k.Mutex.Lock()
@@ -142,7 +167,7 @@ func TestBasicNode(t *testing.T) {
 		t.Errorf("Peer address returned by node is not correct")
 	}
 
-	bn.Close()
+	bn.Close(ctx)
 
 	// With blank seed
 	bn, err = NewKoinosP2PNode(ctx, "/ip4/127.0.0.1/tcp/8765", rpc, nil, "", options.NewConfig())
@@ -150,12 +175,621 @@ func TestBasicNode(t *testing.T) {
 		t.Error(err)
 	}
 
-	bn.Close()
+	bn.Close(ctx)
 
 	// Give an invalid listen address
 	bn, err = NewKoinosP2PNode(ctx, "---", rpc, nil, "", options.NewConfig())
 	if err == nil {
-		bn.Close()
+		bn.Close(ctx)
 		t.Error("Starting a node with an invalid address should give an error, but it did not")
 	}
+
+	// Require a negative number of peers before announcing ready
+	config := options.NewConfig()
+	config.NodeOptions.ReadyMinPeers = -1
+	bn, err = NewKoinosP2PNode(ctx, "/ip4/127.0.0.1/tcp/8765", rpc, nil, "", config)
+	if err == nil {
+		bn.Close(ctx)
+		t.Error("Starting a node with negative ready min peers should give an error, but it did not")
+	}
+
+	// Disable reconnect workers
+	config = options.NewConfig()
+	config.PeerConnectionOptions.MaxReconnects = 0
+	bn, err = NewKoinosP2PNode(ctx, "/ip4/127.0.0.1/tcp/8765", rpc, nil, "", config)
+	if err == nil {
+		bn.Close(ctx)
+		t.Error("Starting a node with no reconnect workers should give an error, but it did not")
+	}
+
+	// Use a backoff jitter outside of [0, 1]
+	for _, jitter := range []float64{-0.1, 1.5} {
+		config = options.NewConfig()
+		config.PeerConnectionOptions.BackoffJitter = jitter
+		bn, err = NewKoinosP2PNode(ctx, "/ip4/127.0.0.1/tcp/8765", rpc, nil, "", config)
+		if err == nil {
+			bn.Close(ctx)
+			t.Errorf("Starting a node with backoff jitter %v should give an error, but it did not", jitter)
+		}
+	}
+
+	// Use a negative peer error queue size
+	config = options.NewConfig()
+	config.PeerConnectionOptions.PeerErrorQueueSize = -1
+	bn, err = NewKoinosP2PNode(ctx, "/ip4/127.0.0.1/tcp/8765", rpc, nil, "", config)
+	if err == nil {
+		bn.Close(ctx)
+		t.Error("Starting a node with a negative peer error queue size should give an error, but it did not")
+	}
+}
+
+// writeTestRegistry writes a peer registry of the given peers, signed by key, to a file in dir
+func writeTestRegistry(t *testing.T, dir string, key crypto.PrivKey, ids ...peer.ID) string {
+	entries := make([]p2p.RegistryEntry, 0, len(ids))
+	for _, id := range ids {
+		entries = append(entries, p2p.RegistryEntry{ID: id.String()})
+	}
+
+	peers, err := json.Marshal(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature, err := key.Sign(peers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(map[string]interface{}{"peers": json.RawMessage(peers), "signature": base64.StdEncoding.EncodeToString(signature)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "registry.json")
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestUnregisteredDirectPeer(t *testing.T) {
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "koinos-p2p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyData, err := crypto.MarshalPublicKey(key.GetPublic())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registered, err := test.RandPeerID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unregistered, err := test.RandPeerID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := options.NewConfig()
+	config.RegistryOptions.Path = writeTestRegistry(t, dir, key, registered)
+	config.RegistryOptions.PublicKey = base64.StdEncoding.EncodeToString(keyData)
+
+	config.NodeOptions.DirectPeers = []string{"/ip4/127.0.0.1/tcp/8766/p2p/" + unregistered.String()}
+	bn, err := NewKoinosP2PNode(ctx, "/ip4/127.0.0.1/tcp/8765", NewTestRPC(128), nil, "", config)
+	if err == nil {
+		bn.Close(ctx)
+		t.Error("Starting a node with a direct peer missing from the peer registry should give an error, but it did not")
+	}
+
+	config.NodeOptions.DirectPeers = []string{"/ip4/127.0.0.1/tcp/8766/p2p/" + registered.String()}
+	bn, err = NewKoinosP2PNode(ctx, "/ip4/127.0.0.1/tcp/8765", NewTestRPC(128), nil, "", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bn.Close(ctx)
+}
+
+func TestGossipMessageID(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	hosts := make([]host.Host, 3)
+	topics := make([]*pubsub.Topic, 3)
+	for i := range hosts {
+		h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer h.Close()
+		hosts[i] = h
+
+		ps, err := pubsub.NewGossipSub(ctx, h, pubsub.WithMessageIdFn(generateMessageID))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		topics[i], err = ps.Join(p2p.BlockTopicName)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Both senders are connected only to the receiver
+	receiver, senders := hosts[2], hosts[:2]
+	for _, h := range senders {
+		if err := h.Connect(ctx, peer.AddrInfo{ID: receiver.ID(), Addrs: receiver.Addrs()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sub, err := topics[2].Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range senders {
+		for len(topics[i].ListPeers()) == 0 {
+			select {
+			case <-time.After(time.Millisecond * 10):
+			case <-ctx.Done():
+				t.Fatal("Senders never saw the receiver subscribe")
+			}
+		}
+	}
+
+	block := []byte("the same block")
+	for i := range senders {
+		if err := topics[i].Publish(ctx, block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := sub.Next(ctx); err != nil {
+		t.Fatalf("Expected the block to be received: %s", err)
+	}
+
+	dupCtx, dupCancel := context.WithTimeout(ctx, time.Millisecond*500)
+	defer dupCancel()
+	if msg, err := sub.Next(dupCtx); err == nil {
+		t.Errorf("Identical block from a second sender was delivered as a new message from %s", msg.ReceivedFrom)
+	}
+}
+
+func TestGetAddressWithoutListenAddrs(t *testing.T) {
+	h, err := libp2p.New(libp2p.NoListenAddrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	n := &KoinosP2PNode{Host: h}
+	if addr := n.GetAddress(); addr != nil {
+		t.Errorf("Expected no address for a host without listen addresses, was %s", addr)
+	}
+}
+
+func TestFloodPublish(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	opts := options.NewGossipOptions()
+	opts.FloodPublish = true
+	gossipOptions, err := gossipSubOptions(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publisher, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer publisher.Close()
+
+	ps, err := pubsub.NewGossipSub(ctx, publisher, gossipOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	topic, err := ps.Join(p2p.BlockTopicName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every subscriber is connected only to the publisher
+	subs := make([]*pubsub.Subscription, 8)
+	for i := range subs {
+		h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer h.Close()
+
+		subPS, err := pubsub.NewGossipSub(ctx, h, pubsub.WithMessageIdFn(generateMessageID))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		subs[i], err = subPS.Subscribe(p2p.BlockTopicName)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := h.Connect(ctx, peer.AddrInfo{ID: publisher.ID(), Addrs: publisher.Addrs()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for len(topic.ListPeers()) < len(subs) {
+		select {
+		case <-time.After(time.Millisecond * 10):
+		case <-ctx.Done():
+			t.Fatal("Publisher never saw all subscribers")
+		}
+	}
+
+	if err := topic.Publish(ctx, []byte("a new block")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Flood published messages are sent directly to every subscriber, without waiting for gossip
+	for i, sub := range subs {
+		recvCtx, recvCancel := context.WithTimeout(ctx, time.Millisecond*500)
+		msg, err := sub.Next(recvCtx)
+		recvCancel()
+		if err != nil {
+			t.Fatalf("Subscriber %v did not receive the block in the first hop: %s", i, err)
+		}
+		if msg.ReceivedFrom != publisher.ID() {
+			t.Errorf("Subscriber %v received the block from %s rather than the publisher", i, msg.ReceivedFrom)
+		}
+	}
+}
+
+// meshTracer tracks the peers in the local gossip mesh from graft and prune trace events
+type meshTracer struct {
+	mutex  sync.Mutex
+	mesh   map[peer.ID]bool
+	pruned map[peer.ID]bool
+}
+
+func (m *meshTracer) Trace(evt *pb.TraceEvent) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	switch evt.GetType() {
+	case pb.TraceEvent_GRAFT:
+		if id, err := peer.IDFromBytes(evt.GetGraft().GetPeerID()); err == nil {
+			m.mesh[id] = true
+		}
+	case pb.TraceEvent_PRUNE:
+		if id, err := peer.IDFromBytes(evt.GetPrune().GetPeerID()); err == nil {
+			m.mesh[id] = false
+			m.pruned[id] = true
+		}
+	}
+}
+
+func (m *meshTracer) state(id peer.ID) (inMesh bool, pruned bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.mesh[id], m.pruned[id]
+}
+
+func TestMeshDemotion(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	opts := options.NewGossipOptions()
+	opts.Dout = 0
+	opts.MeshDemotion = true
+	opts.MeshDeliveryThreshold = 1
+	opts.MeshDeliveryActivation = time.Second
+	opts.MeshDeliveryDecay = time.Second * 30
+	gossipOptions, err := gossipSubOptions(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The mesh targets a single peer, with room for the active peer to join alongside the inactive one
+	params := pubsub.DefaultGossipSubParams()
+	params.D, params.Dlo, params.Dhi, params.Dscore, params.Dout = 1, 1, 2, 1, 0
+	params.HeartbeatInterval = time.Millisecond * 100
+
+	tracer := &meshTracer{mesh: make(map[peer.ID]bool), pruned: make(map[peer.ID]bool)}
+	gossipOptions = append(gossipOptions, pubsub.WithGossipSubParams(params), pubsub.WithEventTracer(tracer))
+
+	local, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer local.Close()
+
+	localPS, err := pubsub.NewGossipSub(ctx, local, gossipOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := localPS.Subscribe(p2p.BlockTopicName); err != nil {
+		t.Fatal(err)
+	}
+
+	newTopicPeer := func() (host.Host, *pubsub.Topic) {
+		h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ps, err := pubsub.NewGossipSub(ctx, h, pubsub.WithMessageIdFn(generateMessageID))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		topic, err := ps.Join(p2p.BlockTopicName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := topic.Subscribe(); err != nil {
+			t.Fatal(err)
+		}
+
+		// The local node dials, so it accepts grafts from the peer even with a full mesh
+		if err := local.Connect(ctx, peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()}); err != nil {
+			t.Fatal(err)
+		}
+
+		return h, topic
+	}
+
+	waitForMesh := func(reason string, done func() bool) {
+		for !done() {
+			select {
+			case <-time.After(time.Millisecond * 10):
+			case <-ctx.Done():
+				t.Fatal(reason)
+			}
+		}
+	}
+
+	inactive, _ := newTopicPeer()
+	defer inactive.Close()
+
+	waitForMesh("Inactive peer was never grafted", func() bool {
+		inMesh, _ := tracer.state(inactive.ID())
+		return inMesh
+	})
+
+	active, activeTopic := newTopicPeer()
+	defer active.Close()
+
+	go func() {
+		for i := uint64(0); ; i++ {
+			select {
+			case <-time.After(time.Millisecond * 100):
+			case <-ctx.Done():
+				return
+			}
+
+			data := make([]byte, 8)
+			binary.BigEndian.PutUint64(data, i)
+			activeTopic.Publish(ctx, data)
+		}
+	}()
+
+	waitForMesh("Active peer was never grafted", func() bool {
+		activeInMesh, _ := tracer.state(active.ID())
+		return activeInMesh
+	})
+
+	waitForMesh("Inactive peer was not demoted", func() bool {
+		_, inactivePruned := tracer.state(inactive.ID())
+		return inactivePruned
+	})
+
+	// The inactive peer's penalty keeps it from being grafted again
+	time.Sleep(time.Second * 2)
+	if activeInMesh, _ := tracer.state(active.ID()); !activeInMesh {
+		t.Error("Expected the active peer to stay in the mesh")
+	}
+	if inactiveInMesh, _ := tracer.state(inactive.ID()); inactiveInMesh {
+		t.Error("Expected the inactive peer to stay out of the mesh")
+	}
+}
+
+func TestMeshDemotionOptions(t *testing.T) {
+	opts := options.NewGossipOptions()
+	opts.MeshDemotion = true
+	if _, err := gossipSubOptions(opts); err != nil {
+		t.Errorf("Unexpected error for default mesh demotion options: %s", err)
+	}
+
+	opts.MeshDeliveryThreshold = 0
+	if _, err := gossipSubOptions(opts); err == nil {
+		t.Error("Expected an error for a zero mesh delivery threshold")
+	}
+
+	opts = options.NewGossipOptions()
+	opts.MeshDemotion = true
+	opts.MeshDeliveryActivation = time.Millisecond * 500
+	if _, err := gossipSubOptions(opts); err == nil {
+		t.Error("Expected an error for a mesh delivery activation under 1s")
+	}
+}
+
+func TestGossipSubOptionsDout(t *testing.T) {
+	opts := options.NewGossipOptions()
+	for _, dout := range []int{-1, 4, 5} {
+		opts.Dout = dout
+		if _, err := gossipSubOptions(opts); err == nil {
+			t.Errorf("Expected an error for Dout %v", dout)
+		}
+	}
+}
+
+func TestValidateGossipToggleOptions(t *testing.T) {
+	if err := validateGossipToggleOptions(options.NewGossipToggleOptions()); err != nil {
+		t.Errorf("Unexpected error for default options: %s", err)
+	}
+
+	tests := []struct {
+		name    string
+		enable  float64
+		disable float64
+	}{
+		{"disable above enable", 0.3, 0.6},
+		{"disable equal to enable", 0.5, 0.5},
+		{"enable above one", 1.5, 0.3},
+		{"negative disable", 0.6, -0.1},
+	}
+
+	for _, tt := range tests {
+		opts := options.NewGossipToggleOptions()
+		opts.EnableThreshold = tt.enable
+		opts.DisableThreshold = tt.disable
+		if err := validateGossipToggleOptions(opts); err == nil {
+			t.Errorf("Expected an error for %s", tt.name)
+		}
+	}
+
+	opts := options.NewGossipToggleOptions()
+	opts.MinPeers = -1
+	if err := validateGossipToggleOptions(opts); err == nil {
+		t.Error("Expected an error for negative minimum peers")
+	}
+}
+
+func TestLoadPrivateKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "koinos-p2p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "p2p", "identity.key")
+
+	key, err := loadPrivateKey(keyFile, "", "ed25519")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(keyFile)
+	if err != nil {
+		t.Fatalf("Expected identity key file to be written: %s", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Incorrect identity key file permissions. Expected 0600, was %v", info.Mode().Perm())
+	}
+
+	// The stored key takes precedence over a seed
+	loaded, err := loadPrivateKey(keyFile, "test1", "ed25519")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Equals(loaded) {
+		t.Error("Expected the stored identity key to be reused")
+	}
+
+	seeded, err := loadPrivateKey("", "test1", "ed25519")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Equals(seeded) {
+		t.Error("Expected the seeded key to differ from the stored key")
+	}
+}
+
+func TestGeneratePrivateKeyType(t *testing.T) {
+	tests := []struct {
+		seed     string
+		keyType  string
+		expected pbcrypto.KeyType
+	}{
+		{"test1", "ed25519", pbcrypto.KeyType_Ed25519},
+		{"", "secp256k1", pbcrypto.KeyType_Secp256k1},
+		{"test1", "ecdsa", pbcrypto.KeyType_ECDSA},
+		{"test1", "rsa", pbcrypto.KeyType_RSA},
+		{"test1", "", pbcrypto.KeyType_ECDSA},
+		{"", "", pbcrypto.KeyType_Ed25519},
+	}
+
+	for _, tt := range tests {
+		key, err := generatePrivateKey(tt.seed, tt.keyType)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.keyType, err)
+		}
+		if key.Type() != tt.expected {
+			t.Errorf("Incorrect key type for seed %q and key type %q. Expected %v, was %v", tt.seed, tt.keyType, tt.expected, key.Type())
+		}
+	}
+
+	if _, err := generatePrivateKey("test1", "secp256k1"); err == nil {
+		t.Error("Expected an error generating a secp256k1 key from a seed")
+	}
+
+	first, _ := generatePrivateKey("test1", "ed25519")
+	second, _ := generatePrivateKey("test1", "ed25519")
+	if !first.Equals(second) {
+		t.Error("Expected the same seed to generate the same ed25519 key")
+	}
+
+	if _, err := generatePrivateKey("test1", "dsa"); err == nil {
+		t.Error("Expected an error for an unknown key type")
+	}
+}
+
+func TestSecurityOptions(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	newSecureHost := func(security string) host.Host {
+		opts, err := securityOptions(security)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		h, err := libp2p.New(append(opts, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	tests := []struct {
+		client   string
+		server   string
+		connects bool
+	}{
+		{"noise", "all", true},
+		{"tls", "all", true},
+		{"noise", "noise", true},
+		{"tls", "tls", true},
+		{"noise", "tls", false},
+		{"tls", "noise", false},
+	}
+
+	for _, tt := range tests {
+		client := newSecureHost(tt.client)
+		server := newSecureHost(tt.server)
+
+		err := client.Connect(ctx, peer.AddrInfo{ID: server.ID(), Addrs: server.Addrs()})
+		if connected := err == nil; connected != tt.connects {
+			t.Errorf("Unexpected connection from %s to %s. Expected connected %v, error was %v", tt.client, tt.server, tt.connects, err)
+		}
+
+		client.Close()
+		server.Close()
+	}
+
+	if _, err := securityOptions("secio"); err == nil {
+		t.Error("Expected an error for an unknown security transport")
+	}
 }
@@ -0,0 +1,57 @@
+package node
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	log "github.com/koinos/koinos-log-golang"
+)
+
+// PeersRPC is the AMQP RPC type on which the node reports its connected peers
+const PeersRPC = "p2p_peers"
+
+// ConnectedPeer is the reported state of a connected peer
+type ConnectedPeer struct {
+	ID        string `json:"id"`
+	Address   string `json:"address"`
+	Direction string `json:"direction"`
+	// HeadID and HeadHeight are the head block last reported by the peer, HeadID is empty if it has not reported one
+	HeadID     string `json:"head_id"`
+	HeadHeight uint64 `json:"head_height"`
+}
+
+// GetConnectedPeers returns the node's currently connected peers
+func (n *KoinosP2PNode) GetConnectedPeers(ctx context.Context) []ConnectedPeer {
+	peers := make([]ConnectedPeer, 0)
+
+	for _, peerInfo := range n.ConnectionManager.GetConnectedPeers(ctx) {
+		connectedPeer := ConnectedPeer{
+			ID:         peerInfo.ID.Pretty(),
+			Direction:  strings.ToLower(peerInfo.Direction.String()),
+			HeadHeight: peerInfo.Head.Height,
+		}
+
+		if peerInfo.Address != nil {
+			connectedPeer.Address = peerInfo.Address.String()
+		}
+
+		if len(peerInfo.Head.ID) > 0 {
+			connectedPeer.HeadID = "0x" + hex.EncodeToString(peerInfo.Head.ID)
+		}
+
+		peers = append(peers, connectedPeer)
+	}
+
+	return peers
+}
+
+func (n *KoinosP2PNode) handlePeersRPC(rpcType string, data []byte) ([]byte, error) {
+	log.Debug("Received connected peers request")
+
+	ctx, cancel := context.WithTimeout(context.Background(), statusRequestTimeout)
+	defer cancel()
+
+	return json.Marshal(n.GetConnectedPeers(ctx))
+}
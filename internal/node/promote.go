@@ -0,0 +1,25 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+
+	log "github.com/koinos/koinos-log-golang"
+)
+
+// PromoteRPC is the AMQP RPC type on which a standby node is promoted to active
+const PromoteRPC = "p2p_promote"
+
+// PromoteResult is the result of a promote request
+type PromoteResult struct {
+	Promoted bool `json:"promoted"`
+}
+
+func (n *KoinosP2PNode) handlePromoteRPC(rpcType string, data []byte) ([]byte, error) {
+	log.Debug("Received promote request")
+
+	ctx, cancel := context.WithTimeout(context.Background(), statusRequestTimeout)
+	defer cancel()
+
+	return json.Marshal(&PromoteResult{Promoted: n.ConnectionManager.Promote(ctx)})
+}
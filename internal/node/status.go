@@ -0,0 +1,107 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	log "github.com/koinos/koinos-log-golang"
+)
+
+// StatusRPC is the AMQP RPC type on which the node reports its status
+const StatusRPC = "p2p_status"
+
+const statusRequestTimeout = time.Second * 5
+
+// PeerStatus is the reported status of a connected peer
+type PeerStatus struct {
+	ID             string    `json:"id"`
+	Address        string    `json:"address"`
+	Synced         bool      `json:"synced"`
+	FirstConnected time.Time `json:"first_connected"`
+	LastSeen       time.Time `json:"last_seen"`
+	UptimeSeconds  int64     `json:"uptime_seconds"`
+
+	BlocksDownloaded     uint64  `json:"blocks_downloaded"`
+	BytesDownloaded      uint64  `json:"bytes_downloaded"`
+	AverageLatencyMs     int64   `json:"average_latency_ms"`
+	DownloadSuccessRatio float64 `json:"download_success_ratio"`
+}
+
+// ReconnectStatus is the reported connection attempt counts for a peer
+type ReconnectStatus struct {
+	ID        string `json:"id"`
+	Attempts  uint64 `json:"attempts"`
+	Successes uint64 `json:"successes"`
+	Failures  uint64 `json:"failures"`
+}
+
+// Status is the reported status of the node
+type Status struct {
+	ID            string            `json:"id"`
+	Address       string            `json:"address"`
+	GossipEnabled bool              `json:"gossip_enabled"`
+	Standby       bool              `json:"standby"`
+	Isolated      bool              `json:"isolated"`
+	Outage        bool              `json:"outage"`
+	Peers         []PeerStatus      `json:"peers"`
+	Reconnects    []ReconnectStatus `json:"reconnects"`
+}
+
+// GetStatus returns the current status of the node
+func (n *KoinosP2PNode) GetStatus(ctx context.Context) *Status {
+	status := &Status{
+		ID:            n.Host.ID().Pretty(),
+		GossipEnabled: n.GossipToggle.IsEnabled(),
+		Standby:       n.ConnectionManager.IsStandby(),
+		Isolated:      n.ConnectionManager.IsIsolated(),
+		Outage:        n.ConnectionManager.IsInOutage(),
+		Peers:         make([]PeerStatus, 0),
+		Reconnects:    make([]ReconnectStatus, 0),
+	}
+
+	if addr := n.GetAddress(); addr != nil {
+		status.Address = addr.String()
+	}
+
+	for _, peerInfo := range n.ConnectionManager.GetConnectedPeers(ctx) {
+		peerStatus := PeerStatus{
+			ID:             peerInfo.ID.Pretty(),
+			Synced:         peerInfo.Synced,
+			FirstConnected: peerInfo.FirstConnected,
+			LastSeen:       peerInfo.LastSeen,
+			UptimeSeconds:  int64(peerInfo.Uptime / time.Second),
+
+			BlocksDownloaded:     peerInfo.Downloads.Blocks,
+			BytesDownloaded:      peerInfo.Downloads.Bytes,
+			AverageLatencyMs:     int64(peerInfo.Downloads.AverageLatency() / time.Millisecond),
+			DownloadSuccessRatio: peerInfo.Downloads.SuccessRatio(),
+		}
+
+		if peerInfo.Address != nil {
+			peerStatus.Address = peerInfo.Address.String()
+		}
+
+		status.Peers = append(status.Peers, peerStatus)
+	}
+
+	for id, stats := range n.ConnectionManager.GetReconnectStats() {
+		status.Reconnects = append(status.Reconnects, ReconnectStatus{
+			ID:        id.Pretty(),
+			Attempts:  stats.Attempts,
+			Successes: stats.Successes,
+			Failures:  stats.Failures,
+		})
+	}
+
+	return status
+}
+
+func (n *KoinosP2PNode) handleStatusRPC(rpcType string, data []byte) ([]byte, error) {
+	log.Debug("Received status request")
+
+	ctx, cancel := context.WithTimeout(context.Background(), statusRequestTimeout)
+	defer cancel()
+
+	return json.Marshal(n.GetStatus(ctx))
+}
@@ -0,0 +1,41 @@
+package options
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/multiformats/go-multihash"
+)
+
+// ParseCheckpoint parses a checkpoint in the form height:blockid, where blockid is a hex encoded multihash
+func ParseCheckpoint(checkpoint string) (Checkpoint, error) {
+	parts := strings.SplitN(checkpoint, ":", 2)
+	if len(parts) != 2 {
+		return Checkpoint{}, fmt.Errorf("checkpoint must be in form blockHeight:blockID, was '%s'", checkpoint)
+	}
+
+	blockHeight, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return Checkpoint{}, fmt.Errorf("could not parse block height of checkpoint '%s': %w", checkpoint, err)
+	}
+
+	// Replace with base64 later
+	//blockID, err := base64.URLEncoding.DecodeString(parts[1])
+	blockID, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return Checkpoint{}, fmt.Errorf("could not decode block id of checkpoint '%s': %w", checkpoint, err)
+	}
+
+	decoded, err := multihash.Decode(blockID)
+	if err != nil {
+		return Checkpoint{}, fmt.Errorf("block id of checkpoint '%s' is not a valid multihash: %w", checkpoint, err)
+	}
+
+	if length, ok := multihash.DefaultLengths[decoded.Code]; ok && length >= 0 && decoded.Length != length {
+		return Checkpoint{}, fmt.Errorf("block id of checkpoint '%s' has a %v byte %s digest, expected %v bytes", checkpoint, decoded.Length, decoded.Name, length)
+	}
+
+	return Checkpoint{BlockHeight: blockHeight, BlockID: blockID}, nil
+}
@@ -0,0 +1,47 @@
+package options
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/multiformats/go-multihash"
+)
+
+func TestParseCheckpoint(t *testing.T) {
+	blockID, err := multihash.Sum([]byte("block"), multihash.SHA2_256, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoint, err := ParseCheckpoint("10:" + hex.EncodeToString(blockID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if checkpoint.BlockHeight != 10 || !bytes.Equal(checkpoint.BlockID, blockID) {
+		t.Errorf("Incorrect checkpoint. Expected 10:%x, was %v:%x", []byte(blockID), checkpoint.BlockHeight, []byte(checkpoint.BlockID))
+	}
+
+	invalid := []string{
+		"10",
+		"ten:" + hex.EncodeToString(blockID),
+		"10:not-hex",
+		// Raw digest without a multihash prefix
+		"10:" + hex.EncodeToString(blockID[2:]),
+		// Truncated digest
+		"10:" + hex.EncodeToString(blockID[:len(blockID)-1]),
+		// Length prefix does not match the sha2-256 digest size
+		"10:1202abcd",
+	}
+
+	for _, cp := range invalid {
+		_, err := ParseCheckpoint(cp)
+		if err == nil {
+			t.Errorf("Expected parsing checkpoint '%s' to fail", cp)
+		} else if !strings.Contains(err.Error(), cp) {
+			t.Errorf("Expected error to name checkpoint '%s', was %s", cp, err)
+		}
+	}
+}
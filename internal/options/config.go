@@ -6,6 +6,11 @@ type Config struct {
 	PeerConnectionOptions   PeerConnectionOptions
 	PeerErrorHandlerOptions PeerErrorHandlerOptions
 	GossipToggleOptions     GossipToggleOptions
+	IsolationOptions        IsolationOptions
+	PeerRPCServiceOptions   PeerRPCServiceOptions
+	GossipOptions           GossipOptions
+	WhitelistOptions        WhitelistOptions
+	RegistryOptions         RegistryOptions
 }
 
 // NewConfig creates a new Config
@@ -15,6 +20,11 @@ func NewConfig() *Config {
 		PeerConnectionOptions:   *NewPeerConnectionOptions(),
 		PeerErrorHandlerOptions: *NewPeerErrorHandlerOptions(),
 		GossipToggleOptions:     *NewGossipToggleOptions(),
+		IsolationOptions:        *NewIsolationOptions(),
+		PeerRPCServiceOptions:   *NewPeerRPCServiceOptions(),
+		GossipOptions:           *NewGossipOptions(),
+		WhitelistOptions:        *NewWhitelistOptions(),
+		RegistryOptions:         *NewRegistryOptions(),
 	}
 	return &config
 }
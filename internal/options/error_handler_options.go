@@ -10,19 +10,34 @@ const (
 	errorScoreThresholdDefault     = 100000
 
 	deserializationErrorScoreDefault        = 5000
+	messageTooLargeErrorScoreDefault        = deserializationErrorScoreDefault
 	serializationErrorScoreDefault          = 0
 	blockIrreversibilityErrorScoreDefault   = 100
 	blockApplicationErrorScoreDefault       = 5000
+	blockMismatchErrorScoreDefault          = blockApplicationErrorScoreDefault
+	blockTooLargeErrorScoreDefault          = deserializationErrorScoreDefault
 	transactionApplicationErrorScoreDefault = 1000
 	chainIDMismatchErrorScoreDefault        = uint64(math.MaxUint32)
 	chainNotConnectedErrorScoreDefault      = uint64(math.MaxUint32)
 	checkpointMismatchErrorScoreDefault     = uint64(math.MaxUint32)
+	clockSkewErrorScoreDefault              = 0
+	headRegressionErrorScoreDefault         = blockApplicationErrorScoreDefault
+	slowPeerErrorScoreDefault               = blockApplicationErrorScoreDefault
 	localRPCErrorScoreDefault               = 0
 	peerRPCErrorScoreDefault                = 1000
 	localRPCTimeoutErrorScoreDefault        = 0
 	peerRPCTimeoutErrorScoreDefault         = 1000
+	rateLimitedErrorScoreDefault            = 1000
+	malformedRequestErrorScoreDefault       = deserializationErrorScoreDefault
+	peerNotReadyErrorScoreDefault           = 0
+	heightNotServableErrorScoreDefault      = 0
+	reciprocityRefusedErrorScoreDefault     = 0
 	processRequestTimeoutErrorScoreDefault  = 0
 	unknownErrorScoreDefault                = blockApplicationErrorScoreDefault
+
+	transactionAcceptedRewardDefault     = 100
+	transactionRewardWindowDefault       = time.Minute
+	maxTransactionRewardPerWindowDefault = 1000
 )
 
 // PeerErrorHandlerOptions are options for PeerErrorHandler
@@ -31,19 +46,37 @@ type PeerErrorHandlerOptions struct {
 	ErrorScoreThreshold     uint64
 
 	DeserializationErrorScore        uint64
+	MessageTooLargeErrorScore        uint64
 	SerializationErrorScore          uint64
 	BlockIrreversibilityErrorScore   uint64
 	BlockApplicationErrorScore       uint64
+	BlockMismatchErrorScore          uint64
+	BlockTooLargeErrorScore          uint64
 	TransactionApplicationErrorScore uint64
 	ChainIDMismatchErrorScore        uint64
 	ChainNotConnectedErrorScore      uint64
 	CheckpointMismatchErrorScore     uint64
+	ClockSkewErrorScore              uint64
+	HeadRegressionErrorScore         uint64
+	SlowPeerErrorScore               uint64
 	LocalRPCErrorScore               uint64
 	PeerRPCErrorScore                uint64
 	LocalRPCTimeoutErrorScore        uint64
 	PeerRPCTimeoutErrorScore         uint64
+	RateLimitedErrorScore            uint64
+	MalformedRequestErrorScore       uint64
+	PeerNotReadyErrorScore           uint64
+	HeightNotServableErrorScore      uint64
+	ReciprocityRefusedErrorScore     uint64
 	ProcessRequestTimeoutErrorScore  uint64
 	UnknownErrorScore                uint64
+
+	// TransactionAcceptedReward is subtracted from a peer's error score when it gossips a transaction that is applied
+	TransactionAcceptedReward uint64
+
+	// MaxTransactionRewardPerWindow caps the reward a peer may earn within each TransactionRewardWindow
+	MaxTransactionRewardPerWindow uint64
+	TransactionRewardWindow       time.Duration
 }
 
 // NewPeerErrorHandlerOptions returns default initialized PeerErrorHandlerOptions
@@ -52,18 +85,32 @@ func NewPeerErrorHandlerOptions() *PeerErrorHandlerOptions {
 		ErrorScoreDecayHalflife:          errorScoreDecayHalflifeDefault,
 		ErrorScoreThreshold:              errorScoreThresholdDefault,
 		DeserializationErrorScore:        deserializationErrorScoreDefault,
+		MessageTooLargeErrorScore:        messageTooLargeErrorScoreDefault,
 		SerializationErrorScore:          serializationErrorScoreDefault,
 		BlockIrreversibilityErrorScore:   blockIrreversibilityErrorScoreDefault,
 		BlockApplicationErrorScore:       blockApplicationErrorScoreDefault,
+		BlockMismatchErrorScore:          blockMismatchErrorScoreDefault,
+		BlockTooLargeErrorScore:          blockTooLargeErrorScoreDefault,
 		TransactionApplicationErrorScore: transactionApplicationErrorScoreDefault,
 		ChainIDMismatchErrorScore:        chainIDMismatchErrorScoreDefault,
 		ChainNotConnectedErrorScore:      chainNotConnectedErrorScoreDefault,
 		CheckpointMismatchErrorScore:     checkpointMismatchErrorScoreDefault,
+		ClockSkewErrorScore:              clockSkewErrorScoreDefault,
+		HeadRegressionErrorScore:         headRegressionErrorScoreDefault,
+		SlowPeerErrorScore:               slowPeerErrorScoreDefault,
 		LocalRPCErrorScore:               localRPCErrorScoreDefault,
 		PeerRPCErrorScore:                peerRPCErrorScoreDefault,
 		LocalRPCTimeoutErrorScore:        localRPCTimeoutErrorScoreDefault,
 		PeerRPCTimeoutErrorScore:         peerRPCTimeoutErrorScoreDefault,
+		RateLimitedErrorScore:            rateLimitedErrorScoreDefault,
+		MalformedRequestErrorScore:       malformedRequestErrorScoreDefault,
+		PeerNotReadyErrorScore:           peerNotReadyErrorScoreDefault,
+		HeightNotServableErrorScore:      heightNotServableErrorScoreDefault,
+		ReciprocityRefusedErrorScore:     reciprocityRefusedErrorScoreDefault,
 		ProcessRequestTimeoutErrorScore:  processRequestTimeoutErrorScoreDefault,
 		UnknownErrorScore:                unknownErrorScoreDefault,
+		TransactionAcceptedReward:        transactionAcceptedRewardDefault,
+		MaxTransactionRewardPerWindow:    maxTransactionRewardPerWindowDefault,
+		TransactionRewardWindow:          transactionRewardWindowDefault,
 	}
 }
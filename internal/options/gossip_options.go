@@ -0,0 +1,57 @@
+package options
+
+import (
+	"time"
+)
+
+const (
+	floodPublishDefault              = false
+	doutDefault                      = 2
+	maxBlockMessageSizeDefault       = 1 << 20
+	maxTransactionMessageSizeDefault = 1 << 19
+	meshDemotionDefault              = false
+	meshDeliveryThresholdDefault     = 3
+	meshDeliveryActivationDefault    = time.Minute
+	meshDeliveryDecayDefault         = time.Minute
+)
+
+// GossipOptions are options for the gossipsub router
+type GossipOptions struct {
+	// FloodPublish sends messages published by this node to every subscribed peer rather than only mesh peers
+	FloodPublish bool
+
+	// Dout is the number of outbound connections to maintain in each topic mesh
+	Dout int
+
+	// MaxBlockMessageSize is the largest message in bytes accepted on the block topic
+	MaxBlockMessageSize int
+
+	// MaxTransactionMessageSize is the largest message in bytes accepted on the transaction topic
+	MaxTransactionMessageSize int
+
+	// MeshDemotion prunes block topic mesh peers that deliver fewer than MeshDeliveryThreshold new blocks
+	MeshDemotion bool
+
+	// MeshDeliveryThreshold is the number of new blocks a mesh peer must keep delivering, decaying over MeshDeliveryDecay
+	MeshDeliveryThreshold float64
+
+	// MeshDeliveryActivation is how long a peer is in the mesh before it is penalized for delivering too few blocks
+	MeshDeliveryActivation time.Duration
+
+	// MeshDeliveryDecay is how long it takes a peer's count of delivered blocks to decay to zero
+	MeshDeliveryDecay time.Duration
+}
+
+// NewGossipOptions returns default initialized GossipOptions
+func NewGossipOptions() *GossipOptions {
+	return &GossipOptions{
+		FloodPublish:              floodPublishDefault,
+		Dout:                      doutDefault,
+		MaxBlockMessageSize:       maxBlockMessageSizeDefault,
+		MaxTransactionMessageSize: maxTransactionMessageSizeDefault,
+		MeshDemotion:              meshDemotionDefault,
+		MeshDeliveryThreshold:     meshDeliveryThresholdDefault,
+		MeshDeliveryActivation:    meshDeliveryActivationDefault,
+		MeshDeliveryDecay:         meshDeliveryDecayDefault,
+	}
+}
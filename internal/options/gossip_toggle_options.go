@@ -1,10 +1,16 @@
 package options
 
+import (
+	"time"
+)
+
 const (
 	enableThresholdDefault  = 2.0 / 3.0
 	disableThresholdDefault = 1.0 / 3.0
 	alwaysEnableDefault     = false
 	alwaysDisableDefault    = false
+	gossipMinPeersDefault   = 1
+	toggleCooldownDefault   = time.Duration(0)
 )
 
 // GossipToggleOptions are options for GossipToggle
@@ -13,6 +19,12 @@ type GossipToggleOptions struct {
 	DisableThreshold float64
 	AlwaysEnable     bool
 	AlwaysDisable    bool
+
+	// MinPeers is the number of peers that must have voted before the vote ratio can toggle gossip
+	MinPeers int
+
+	// ToggleCooldown is the minimum time gossip stays enabled or disabled before it can be toggled again
+	ToggleCooldown time.Duration
 }
 
 // NewGossipToggleOptions returns default initialized GossipToggleOptions
@@ -22,5 +34,7 @@ func NewGossipToggleOptions() *GossipToggleOptions {
 		DisableThreshold: disableThresholdDefault,
 		AlwaysEnable:     alwaysEnableDefault,
 		AlwaysDisable:    alwaysDisableDefault,
+		MinPeers:         gossipMinPeersDefault,
+		ToggleCooldown:   toggleCooldownDefault,
 	}
 }
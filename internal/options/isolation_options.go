@@ -0,0 +1,31 @@
+package options
+
+import (
+	"time"
+)
+
+const (
+	isolationReconnectIntervalDefault = time.Second * 2
+	isolationRetryBudgetDefault       = 300
+	outageProbeIntervalDefault        = time.Minute
+)
+
+// IsolationOptions are options for when the node has lost all of its peers
+type IsolationOptions struct {
+	ReconnectInterval time.Duration
+
+	// RetryBudget is the number of connection attempts made while isolated before entering an outage, zero disables the budget
+	RetryBudget uint64
+
+	// OutageProbeInterval is the interval at which initial peers are retried during an outage
+	OutageProbeInterval time.Duration
+}
+
+// NewIsolationOptions returns default initialized IsolationOptions
+func NewIsolationOptions() *IsolationOptions {
+	return &IsolationOptions{
+		ReconnectInterval:   isolationReconnectIntervalDefault,
+		RetryBudget:         isolationRetryBudgetDefault,
+		OutageProbeInterval: outageProbeIntervalDefault,
+	}
+}
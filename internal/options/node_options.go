@@ -8,15 +8,44 @@ type NodeOptions struct {
 	// Peers to directly connect
 	DirectPeers []string
 
+	// File from which the node's identity key is loaded, or to which a generated key is written
+	IdentityKeyFile string
+
+	// Type of identity key to generate, defaulting to "ecdsa" from a seed and "ed25519" otherwise
+	KeyType string
+
+	// Security transport used to secure connections: "noise", "tls", or "all" to offer both, preferring noise
+	Security string
+
+	// Map ports on NAT routers and run the AutoNAT service and relays
+	EnableNAT bool
+
 	// Force gossip mode on startup
 	ForceGossip bool
+
+	// Start as a warm standby that stays connected to peers without syncing or serving blocks
+	Standby bool
+
+	// Broadcast the node's peer ID and addresses on startup and whenever they change
+	AnnounceAddresses bool
+
+	// Broadcast a ready event once the node is serving peers and connected to ReadyMinPeers peers
+	AnnounceReady bool
+	ReadyMinPeers int
 }
 
 // NewNodeOptions creates a NodeOptions object which controls how p2p works
 func NewNodeOptions() *NodeOptions {
 	return &NodeOptions{
-		InitialPeers: make([]string, 0),
-		DirectPeers:  make([]string, 0),
-		ForceGossip:  false,
+		InitialPeers:      make([]string, 0),
+		DirectPeers:       make([]string, 0),
+		KeyType:           "",
+		Security:          "all",
+		EnableNAT:         true,
+		ForceGossip:       false,
+		Standby:           false,
+		AnnounceAddresses: false,
+		AnnounceReady:     false,
+		ReadyMinPeers:     1,
 	}
 }
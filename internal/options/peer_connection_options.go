@@ -16,10 +16,36 @@ const (
 	localRPCTimeoutDefault       = time.Second * 6
 	remoteRPCTimeoutDefault      = time.Second * 6
 	blockRequestBatchSizeDefault = 1000
+	blockRequestMaxBytesDefault  = 1 << 25
 	blockRequestTimeoutDefault   = time.Second * 6
 	handshakeRetryTimeDefault    = time.Second * 6
 	syncedBlockDeltaDefault      = 5
 	syncedPingTimeDefault        = time.Second * 10
+	maxInitialPeersDefault       = 1024
+	shuffleInitialPeersDefault   = false
+	maxPeersDefault              = 128
+	minPeersDefault              = 0
+	skipAppliedBlocksDefault     = true
+	maxClockSkewDefault          = time.Minute
+	clockWarningPeersDefault     = 3
+	chainIDRetriesDefault        = 3
+	chainIDRetryDelayDefault     = time.Millisecond * 500
+	headRegressionDepthDefault   = 60
+	headRegressionLimitDefault   = 3
+	dialTimeoutDefault           = time.Second * 10
+	maxHandshakesDefault         = 16
+	initialConnectBackoffDefault = time.Second
+	initialConnectMaxDefault     = time.Second * 30
+	reconnectBackoffDefault      = time.Second
+	reconnectMaxDefault          = time.Second * 30
+	maxReconnectsDefault         = 8
+	backoffJitterDefault         = 0.5
+	stallTimeoutDefault          = time.Minute * 5
+	requestTimeoutMultDefault    = 4
+	minRequestTimeoutDefault     = time.Second * 2
+	maxRequestTimeoutDefault     = time.Second * 30
+	slowRequestLimitDefault      = 3
+	peerErrorQueueSizeDefault    = 16
 )
 
 // PeerConnectionOptions are options for PeerConnection
@@ -32,6 +58,70 @@ type PeerConnectionOptions struct {
 	HandshakeRetryTime    time.Duration
 	SyncedBlockDelta      uint64
 	SyncedPingTime        time.Duration
+	MaxInitialPeers       int
+
+	// BlockRequestMaxBytes limits the bytes of each block request based on the peer's average block size, zero disables the limit
+	BlockRequestMaxBytes uint64
+
+	// ShuffleInitialPeers connects to initial peers in random order rather than the order they were configured
+	ShuffleInitialPeers bool
+
+	// MaxPeers is the most peers that may be connected at once, zero disables the limit
+	MaxPeers int
+
+	// MinPeers is the number of connected peers below which initial peers are reconnected without backing off
+	MinPeers int
+
+	// DialTimeout limits how long a single attempt to connect to or identify a peer may take
+	DialTimeout time.Duration
+
+	// MaxHandshakes is the most peer handshakes that may query the local node at once, zero disables the limit
+	MaxHandshakes int
+
+	// SkipAppliedBlocks skips requested blocks the block store already has rather than applying them again
+	SkipAppliedBlocks bool
+
+	// MaxClockSkew is how far past local time a peer's block timestamps may be, zero disables the check
+	MaxClockSkew time.Duration
+
+	// ClockWarningPeers is the fewest peers, and a majority, serving blocks ahead of local time before the local clock is reported wrong
+	ClockWarningPeers int
+
+	// ChainIDRetries is how many more times the peer's chain ID is requested during the handshake if the request fails
+	ChainIDRetries    uint
+	ChainIDRetryDelay time.Duration
+
+	// HeadRegressionDepth is how many blocks a peer's reported head may move backward before it counts as a regression
+	HeadRegressionDepth uint64
+	HeadRegressionLimit uint
+
+	// InitialConnectBackoff is the first delay between attempts to connect to initial peers on startup
+	InitialConnectBackoff    time.Duration
+	InitialConnectMaxBackoff time.Duration
+
+	// ReconnectBackoff is the first delay between attempts to reconnect to an initial peer after it disconnects
+	ReconnectBackoff    time.Duration
+	ReconnectMaxBackoff time.Duration
+
+	// MaxReconnects is the number of workers reconnecting to disconnected initial peers
+	MaxReconnects int
+
+	// BackoffJitter randomly scales each connection backoff delay by up to this fraction, zero disables jitter
+	BackoffJitter float64
+
+	// StallTimeout is how long a started peer connection may go without activity before it is restarted, zero disables the check
+	StallTimeout time.Duration
+
+	// BlockRequestTimeoutMultiplier scales the peer's average latency per block into the block request timeout, zero disables adapting it
+	BlockRequestTimeoutMultiplier float64
+	MinBlockRequestTimeout        time.Duration
+	MaxBlockRequestTimeout        time.Duration
+
+	// SlowRequestLimit is how many consecutive block requests may time out at MaxBlockRequestTimeout before the peer is reported
+	SlowRequestLimit uint
+
+	// PeerErrorQueueSize is how many of a peer connection's errors may wait to be handled before more are dropped
+	PeerErrorQueueSize int
 }
 
 // NewPeerConnectionOptions returns default initialized PeerConnectionOptions
@@ -41,9 +131,37 @@ func NewPeerConnectionOptions() *PeerConnectionOptions {
 		LocalRPCTimeout:       localRPCTimeoutDefault,
 		RemoteRPCTimeout:      remoteRPCTimeoutDefault,
 		BlockRequestBatchSize: blockRequestBatchSizeDefault,
+		BlockRequestMaxBytes:  blockRequestMaxBytesDefault,
 		BlockRequestTimeout:   blockRequestTimeoutDefault,
 		HandshakeRetryTime:    handshakeRetryTimeDefault,
 		SyncedBlockDelta:      syncedBlockDeltaDefault,
 		SyncedPingTime:        syncedPingTimeDefault,
+		MaxInitialPeers:       maxInitialPeersDefault,
+		ShuffleInitialPeers:   shuffleInitialPeersDefault,
+		MaxPeers:              maxPeersDefault,
+		MinPeers:              minPeersDefault,
+		DialTimeout:           dialTimeoutDefault,
+		MaxHandshakes:         maxHandshakesDefault,
+		SkipAppliedBlocks:     skipAppliedBlocksDefault,
+		MaxClockSkew:          maxClockSkewDefault,
+		ClockWarningPeers:     clockWarningPeersDefault,
+		ChainIDRetries:        chainIDRetriesDefault,
+		ChainIDRetryDelay:     chainIDRetryDelayDefault,
+		HeadRegressionDepth:   headRegressionDepthDefault,
+		HeadRegressionLimit:   headRegressionLimitDefault,
+
+		InitialConnectBackoff:    initialConnectBackoffDefault,
+		InitialConnectMaxBackoff: initialConnectMaxDefault,
+		ReconnectBackoff:         reconnectBackoffDefault,
+		ReconnectMaxBackoff:      reconnectMaxDefault,
+		MaxReconnects:            maxReconnectsDefault,
+		BackoffJitter:            backoffJitterDefault,
+		StallTimeout:             stallTimeoutDefault,
+
+		BlockRequestTimeoutMultiplier: requestTimeoutMultDefault,
+		MinBlockRequestTimeout:        minRequestTimeoutDefault,
+		MaxBlockRequestTimeout:        maxRequestTimeoutDefault,
+		SlowRequestLimit:              slowRequestLimitDefault,
+		PeerErrorQueueSize:            peerErrorQueueSizeDefault,
 	}
 }
@@ -0,0 +1,76 @@
+package options
+
+import (
+	"time"
+)
+
+const (
+	serveTimeoutDefault = time.Second * 6
+	requestRateDefault  = 100
+	requestBurstDefault = 200
+	maxBlockSizeDefault = 0
+
+	maxBlocksPerRequestDefault = 1000
+
+	leecherRequestRateDefault  = 1
+	leecherRequestBurstDefault = 5
+)
+
+// HeightRange is an inclusive range of block heights. A High of zero leaves the range unbounded above.
+type HeightRange struct {
+	Low  uint64
+	High uint64
+}
+
+// Contains returns true if the height is within the range
+func (r HeightRange) Contains(height uint64) bool {
+	return height >= r.Low && (r.High == 0 || height <= r.High)
+}
+
+// PeerRPCServiceOptions are options for PeerRPCService
+type PeerRPCServiceOptions struct {
+	// ServableHeightRange limits the blocks served to peers. The default range serves all heights.
+	ServableHeightRange HeightRange
+
+	// ClientOnly disables serving blocks to peers while still answering handshake requests
+	ClientOnly bool
+
+	// ServeTimeout is how long a request may wait on the local node before it is aborted, zero disables the timeout
+	ServeTimeout time.Duration
+
+	// RequestRate is the number of requests per second each peer may make on average. Zero disables rate limiting.
+	RequestRate float64
+
+	// RequestBurst is the number of requests a peer may make at once before being rate limited
+	RequestBurst int
+
+	// MaxBlockSize is the largest serialized block in bytes served to or accepted from peers, zero disables the limit
+	MaxBlockSize int
+
+	// MaxBlocksPerRequest is the most blocks a peer may request at once, zero disables the limit
+	MaxBlocksPerRequest uint32
+
+	// Reciprocity limits block requests from peers that have never served blocks to this node to LeecherRequestRate
+	Reciprocity bool
+
+	// LeecherRequestRate is the number of block requests per second a peer that has never served blocks may make, zero refuses them
+	LeecherRequestRate float64
+
+	// LeecherRequestBurst is the number of block requests a peer that has never served blocks may make at once
+	LeecherRequestBurst int
+}
+
+// NewPeerRPCServiceOptions returns default initialized PeerRPCServiceOptions
+func NewPeerRPCServiceOptions() *PeerRPCServiceOptions {
+	return &PeerRPCServiceOptions{
+		ServeTimeout: serveTimeoutDefault,
+		RequestRate:  requestRateDefault,
+		RequestBurst: requestBurstDefault,
+		MaxBlockSize: maxBlockSizeDefault,
+
+		MaxBlocksPerRequest: maxBlocksPerRequestDefault,
+
+		LeecherRequestRate:  leecherRequestRateDefault,
+		LeecherRequestBurst: leecherRequestBurstDefault,
+	}
+}
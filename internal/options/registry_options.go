@@ -0,0 +1,43 @@
+package options
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RegistryOptions are options for verifying connecting peers against a signed peer registry
+type RegistryOptions struct {
+	// Path is the registry file. When empty, peers are not checked against a registry.
+	Path string
+
+	// PublicKey is the base64 encoded, protobuf serialized public key the registry must be signed with
+	PublicKey string
+
+	// RoleLimits is the most inbound peers of each registry role that may be connected
+	RoleLimits map[string]int
+}
+
+// NewRegistryOptions returns default initialized RegistryOptions
+func NewRegistryOptions() *RegistryOptions {
+	return &RegistryOptions{
+		Path:       "",
+		PublicKey:  "",
+		RoleLimits: make(map[string]int),
+	}
+}
+
+// ParseRoleLimit parses a role connection limit in the form role:count
+func ParseRoleLimit(roleLimit string) (string, int, error) {
+	parts := strings.SplitN(roleLimit, ":", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", 0, fmt.Errorf("role limit must be in form role:count, was '%s'", roleLimit)
+	}
+
+	limit, err := strconv.ParseUint(parts[1], 10, 31)
+	if err != nil {
+		return "", 0, fmt.Errorf("could not parse count of role limit '%s': %w", roleLimit, err)
+	}
+
+	return parts[0], int(limit), nil
+}
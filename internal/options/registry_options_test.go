@@ -0,0 +1,22 @@
+package options
+
+import (
+	"testing"
+)
+
+func TestParseRoleLimit(t *testing.T) {
+	role, limit, err := ParseRoleLimit("observer:4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if role != "observer" || limit != 4 {
+		t.Errorf("Incorrect role limit. Expected observer:4, was %s:%v", role, limit)
+	}
+
+	for _, roleLimit := range []string{"observer", ":4", "observer:-1", "observer:four"} {
+		if _, _, err := ParseRoleLimit(roleLimit); err == nil {
+			t.Errorf("Expected role limit '%s' to be invalid", roleLimit)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package options
+
+// WhitelistOptions are options restricting which peers the node connects with
+type WhitelistOptions struct {
+	// Peers are the IDs of the peers allowed to connect, any peer may connect when empty
+	Peers []string
+}
+
+// NewWhitelistOptions returns default initialized WhitelistOptions
+func NewWhitelistOptions() *WhitelistOptions {
+	return &WhitelistOptions{
+		Peers: make([]string, 0),
+	}
+}
@@ -0,0 +1,95 @@
+package p2p
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/koinos/koinos-log-golang"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// ClockMonitor detects when the local clock is likely wrong, because most peers serve
+// head blocks timestamped ahead of local time by a consistent offset. A nil ClockMonitor
+// ignores all observations.
+type ClockMonitor struct {
+	offsets  map[peer.ID]time.Duration
+	maxSkew  time.Duration
+	minPeers int
+	warned   bool
+	mutex    sync.Mutex
+}
+
+// NewClockMonitor creates a ClockMonitor that warns once at least minPeers peers, and a majority of
+// observed peers, serve blocks more than maxSkew ahead of local time
+func NewClockMonitor(maxSkew time.Duration, minPeers int) *ClockMonitor {
+	return &ClockMonitor{
+		offsets:  make(map[peer.ID]time.Duration),
+		maxSkew:  maxSkew,
+		minPeers: minPeers,
+	}
+}
+
+// Observe records how far ahead of local time the peer's newest block is, returning true if
+// the local clock now appears to be wrong
+func (c *ClockMonitor) Observe(id peer.ID, offset time.Duration) bool {
+	if c == nil {
+		return false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.offsets[id] = offset
+	return c.checkLocalClock()
+}
+
+// Remove forgets the peer's observed offset
+func (c *ClockMonitor) Remove(id peer.ID) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.offsets, id)
+	c.checkLocalClock()
+}
+
+func (c *ClockMonitor) checkLocalClock() bool {
+	if c.maxSkew == 0 || c.minPeers == 0 {
+		return false
+	}
+
+	var skewed []time.Duration
+	for _, offset := range c.offsets {
+		if offset > c.maxSkew {
+			skewed = append(skewed, offset)
+		}
+	}
+
+	sort.Slice(skewed, func(i, j int) bool { return skewed[i] < skewed[j] })
+
+	// Peers with skewed clocks are unlikely to agree with each other, while a wrong local clock
+	// offsets every peer by about the same amount
+	wrong := len(skewed) >= c.minPeers &&
+		len(skewed)*2 > len(c.offsets) &&
+		skewed[len(skewed)-1]-skewed[0] <= c.maxSkew
+
+	if !wrong {
+		if c.warned {
+			log.Info("Peer block timestamps agree with the local clock again")
+		}
+		c.warned = false
+		return false
+	}
+
+	if !c.warned {
+		log.Warnf("The local clock appears to be behind by about %v, %v of %v peers serve blocks from the future. Check the system clock.",
+			skewed[len(skewed)/2].Round(time.Second), len(skewed), len(c.offsets))
+		c.warned = true
+	}
+
+	return true
+}
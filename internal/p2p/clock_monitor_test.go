@@ -0,0 +1,58 @@
+package p2p
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+func TestClockMonitor(t *testing.T) {
+	monitor := NewClockMonitor(time.Minute, 3)
+
+	// Every peer serves blocks about 5 minutes ahead of local time
+	var warned bool
+	for i := 0; i < 4; i++ {
+		warned = monitor.Observe(peer.ID(fmt.Sprintf("peer%v", i)), time.Minute*5+time.Second*time.Duration(i))
+		if i < 2 && warned {
+			t.Errorf("Expected no warning with only %v skewed peers", i+1)
+		}
+	}
+	if !warned {
+		t.Error("Expected a warning when all peers report a consistent skew")
+	}
+
+	// The warning clears once skewed peers are no longer a majority
+	for i := 4; i < 8; i++ {
+		warned = monitor.Observe(peer.ID(fmt.Sprintf("peer%v", i)), -time.Second*3)
+	}
+	if warned {
+		t.Error("Expected no warning when skewed peers are not a majority")
+	}
+
+	for i := 4; i < 8; i++ {
+		monitor.Remove(peer.ID(fmt.Sprintf("peer%v", i)))
+	}
+	if !monitor.Observe("peer0", time.Minute*5) {
+		t.Error("Expected a warning once skewed peers are a majority again")
+	}
+}
+
+func TestClockMonitorInconsistentSkew(t *testing.T) {
+	monitor := NewClockMonitor(time.Minute, 3)
+
+	// Peers with individually skewed clocks do not agree on an offset
+	offsets := []time.Duration{time.Minute * 2, time.Minute * 10, time.Hour}
+	for i, offset := range offsets {
+		if monitor.Observe(peer.ID(fmt.Sprintf("peer%v", i)), offset) {
+			t.Errorf("Expected no warning for inconsistent skews, warned at peer %v", i)
+		}
+	}
+
+	var nilMonitor *ClockMonitor
+	if nilMonitor.Observe("peer0", time.Hour) {
+		t.Error("Expected a nil monitor not to warn")
+	}
+	nilMonitor.Remove("peer0")
+}
@@ -3,10 +3,15 @@ package p2p
 import (
 	"context"
 	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	log "github.com/koinos/koinos-log-golang"
+	"github.com/koinos/koinos-p2p/internal/metrics"
 	"github.com/koinos/koinos-p2p/internal/options"
+	"github.com/koinos/koinos-p2p/internal/p2perrors"
 	"github.com/koinos/koinos-p2p/internal/rpc"
 	util "github.com/koinos/koinos-util-golang"
 
@@ -18,13 +23,30 @@ import (
 	multiaddr "github.com/multiformats/go-multiaddr"
 )
 
-const maxSleepBackoff = 30
+// jitterBackoff scales the delay by a random factor in [1-jitter, 1+jitter)
+func jitterBackoff(delay time.Duration, jitter float64) time.Duration {
+	if jitter <= 0 {
+		return delay
+	}
+
+	return time.Duration(float64(delay) * (1 - jitter + 2*jitter*rand.Float64()))
+}
 
-func min(a, b int) int {
-	if a < b {
-		return a
+// sleepBackoff waits for the given delay, with jitter, and returns the next delay, doubled up to max.
+// It returns false if the context is done before the delay has elapsed.
+func sleepBackoff(ctx context.Context, delay time.Duration, max time.Duration, jitter float64) (time.Duration, bool) {
+	select {
+	case <-time.After(jitterBackoff(delay, jitter)):
+	case <-ctx.Done():
+		return delay, false
 	}
-	return b
+
+	delay *= 2
+	if delay > max {
+		delay = max
+	}
+
+	return delay, true
 }
 
 type connectionMessage struct {
@@ -33,25 +55,117 @@ type connectionMessage struct {
 }
 
 type peerConnectionContext struct {
-	peer   *PeerConnection
-	cancel context.CancelFunc
+	peer      *PeerConnection
+	address   multiaddr.Multiaddr
+	direction network.Direction
+	ctx       context.Context
+	cancel    context.CancelFunc
+}
+
+// peerHistory tracks a peer across connections, it outlives the peer's connection context
+type peerHistory struct {
+	firstConnected time.Time
+	connectedSince time.Time
+	lastSeen       time.Time
+	uptime         time.Duration
+	servedBlocks   bool
+}
+
+// PeerInfo describes the state of a connected peer
+type PeerInfo struct {
+	ID        peer.ID
+	Address   multiaddr.Multiaddr
+	Direction network.Direction
+	Synced    bool
+	// Head is the head block last reported by the peer
+	Head PeerHead
+
+	// FirstConnected is when the peer was first connected since the node started
+	FirstConnected time.Time
+	// LastSeen is the last time the peer responded to a request or changed connection state
+	LastSeen time.Time
+	// Uptime is the cumulative time the peer has been connected, across reconnects
+	Uptime time.Duration
+	// Downloads are the block download stats for the peer's current connection
+	Downloads DownloadStats
+}
+
+// ReconnectStats are the counts of connection attempts made to a peer by the connection manager
+type ReconnectStats struct {
+	Attempts  uint64
+	Successes uint64
+	Failures  uint64
+}
+
+type peerInfoRequest struct {
+	resultChan chan<- []PeerInfo
+}
+
+type servedBlocksRequest struct {
+	id         peer.ID
+	resultChan chan<- bool
+}
+
+type disconnectRequest struct {
+	id         peer.ID
+	resultChan chan<- error
+}
+
+type promoteRequest struct {
+	resultChan chan<- bool
+}
+
+type stopRequest struct {
+	resultChan chan<- []*PeerConnection
 }
 
 // ConnectionManager attempts to reconnect to peers using the network.Notifiee interface.
 type ConnectionManager struct {
-	host   host.Host
-	server *gorpc.Server
-	client *gorpc.Client
+	host       host.Host
+	server     *gorpc.Server
+	client     *gorpc.Client
+	rpcService *rpc.PeerRPCService
+
+	localRPC       rpc.LocalRPC
+	peerOpts       *options.PeerConnectionOptions
+	isolationOpts  *options.IsolationOptions
+	rpcServiceOpts *options.PeerRPCServiceOptions
+	libProvider    LastIrreversibleBlockProvider
+	metrics        *metrics.Collector
 
-	localRPC    rpc.LocalRPC
-	peerOpts    *options.PeerConnectionOptions
-	libProvider LastIrreversibleBlockProvider
+	initialPeers      map[peer.ID]peer.AddrInfo
+	initialPeerOrder  []peer.ID
+	initialPeersMutex sync.RWMutex
+	directPeers       map[peer.ID]util.Void
+	whitelist         *Whitelist
+	registry          *PeerRegistry
+	unidentifiedPeers []multiaddr.Multiaddr
+	connectedPeers    map[peer.ID]*peerConnectionContext
+	peerHistories     map[peer.ID]*peerHistory
+	handshakeSlots    chan struct{}
+	clockMonitor      *ClockMonitor
+	stopping          bool
 
-	initialPeers   map[peer.ID]peer.AddrInfo
-	connectedPeers map[peer.ID]*peerConnectionContext
+	standby         atomic.Value
+	started         atomic.Value
+	isolated        atomic.Value
+	outage          atomic.Value
+	isolationCancel context.CancelFunc
+
+	reconnectStats map[peer.ID]*ReconnectStats
+	reconnectMutex sync.Mutex
 
 	peerConnectedChan        chan connectionMessage
 	peerDisconnectedChan     chan connectionMessage
+	peerInfoChan             chan peerInfoRequest
+	servedBlocksChan         chan servedBlocksRequest
+	disconnectChan           chan disconnectRequest
+	promoteChan              chan promoteRequest
+	stopChan                 chan stopRequest
+	startupIsolationChan     chan struct{}
+	reconnectChan            chan peer.AddrInfo
+	reconnectWorkChan        chan reconnectJob
+	reconnectResultChan      chan reconnectResult
 	peerErrorChan            chan<- PeerError
 	gossipVoteChan           chan<- GossipVote
 	signalPeerDisconnectChan chan<- peer.ID
@@ -62,8 +176,15 @@ func NewConnectionManager(
 	host host.Host,
 	localRPC rpc.LocalRPC,
 	peerOpts *options.PeerConnectionOptions,
+	isolationOpts *options.IsolationOptions,
+	rpcServiceOpts *options.PeerRPCServiceOptions,
+	whitelist *Whitelist,
+	registry *PeerRegistry,
 	libProvider LastIrreversibleBlockProvider,
+	metrics *metrics.Collector,
 	initialPeers []string,
+	directPeers []string,
+	standby bool,
 	peerErrorChan chan<- PeerError,
 	gossipVoteChan chan<- GossipVote,
 	signalPeerDisconnectChan chan<- peer.ID) *ConnectionManager {
@@ -71,44 +192,112 @@ func NewConnectionManager(
 	connectionManager := ConnectionManager{
 		host:                     host,
 		client:                   gorpc.NewClient(host, rpc.PeerRPCID),
-		server:                   gorpc.NewServer(host, rpc.PeerRPCID),
 		localRPC:                 localRPC,
 		peerOpts:                 peerOpts,
+		isolationOpts:            isolationOpts,
+		rpcServiceOpts:           rpcServiceOpts,
 		libProvider:              libProvider,
+		metrics:                  metrics,
 		initialPeers:             make(map[peer.ID]peer.AddrInfo),
+		directPeers:              make(map[peer.ID]util.Void),
+		whitelist:                whitelist,
+		registry:                 registry,
+		clockMonitor:             NewClockMonitor(peerOpts.MaxClockSkew, peerOpts.ClockWarningPeers),
 		connectedPeers:           make(map[peer.ID]*peerConnectionContext),
+		peerHistories:            make(map[peer.ID]*peerHistory),
+		reconnectStats:           make(map[peer.ID]*ReconnectStats),
 		peerConnectedChan:        make(chan connectionMessage),
 		peerDisconnectedChan:     make(chan connectionMessage),
+		peerInfoChan:             make(chan peerInfoRequest),
+		servedBlocksChan:         make(chan servedBlocksRequest),
+		disconnectChan:           make(chan disconnectRequest),
+		promoteChan:              make(chan promoteRequest),
+		stopChan:                 make(chan stopRequest),
+		startupIsolationChan:     make(chan struct{}, 1),
+		reconnectChan:            make(chan peer.AddrInfo),
+		reconnectWorkChan:        make(chan reconnectJob),
+		reconnectResultChan:      make(chan reconnectResult),
 		peerErrorChan:            peerErrorChan,
 		gossipVoteChan:           gossipVoteChan,
 		signalPeerDisconnectChan: signalPeerDisconnectChan,
 	}
 
-	log.Debug("Registering Peer RPC Service")
-	err := connectionManager.server.Register(rpc.NewPeerRPCService(connectionManager.localRPC))
-	if err != nil {
-		log.Errorf("Error registering Peer RPC Service: %s", err.Error())
-		panic(err)
+	if peerOpts.MaxHandshakes > 0 {
+		connectionManager.handshakeSlots = make(chan struct{}, peerOpts.MaxHandshakes)
+	}
+
+	connectionManager.standby.Store(standby)
+	connectionManager.started.Store(false)
+	connectionManager.isolated.Store(false)
+	connectionManager.outage.Store(false)
+
+	if rpcServiceOpts.ClientOnly {
+		log.Info("Running in client only mode, blocks will not be served to peers")
+	}
+
+	connectionManager.server = gorpc.NewServer(host, rpc.PeerRPCID)
+	connectionManager.rpcService = rpc.NewPeerRPCService(connectionManager.localRPC, rpcServiceOpts, connectionManager.isServing, connectionManager.reportPeerError, connectionManager.hasServedBlocks)
+	connectionManager.registerPeerRPCService()
+
+	if standby {
+		log.Info("Running in standby mode, peer RPC requests will be refused until promoted")
+	}
+
+	if peerOpts.MaxInitialPeers > 0 && len(initialPeers) > peerOpts.MaxInitialPeers {
+		log.Warnf("%v initial peers were provided, only the first %v will be used", len(initialPeers), peerOpts.MaxInitialPeers)
+		initialPeers = initialPeers[:peerOpts.MaxInitialPeers]
 	}
-	log.Debug("Peer RPC Service successfully registered")
 
 	for _, peerStr := range initialPeers {
 		ma, err := multiaddr.NewMultiaddr(peerStr)
 		if err != nil {
 			log.Warnf("Error parsing peer address: %v", err)
+			continue
+		}
+
+		if _, err := ma.ValueForProtocol(multiaddr.P_P2P); err != nil {
+			log.Infof("Peer address %s has no peer ID, the ID will be identified when connecting", ma)
+			connectionManager.unidentifiedPeers = append(connectionManager.unidentifiedPeers, ma)
+			continue
 		}
 
 		addr, err := peer.AddrInfoFromP2pAddr(ma)
 		if err != nil {
 			log.Warnf("Error parsing peer address: %v", err)
+			continue
 		}
 
+		if _, ok := connectionManager.initialPeers[addr.ID]; !ok {
+			connectionManager.initialPeerOrder = append(connectionManager.initialPeerOrder, addr.ID)
+		}
 		connectionManager.initialPeers[addr.ID] = *addr
+		whitelist.Allow(addr.ID)
+	}
+
+	for _, peerStr := range directPeers {
+		addr, err := peer.AddrInfoFromString(peerStr)
+		if err != nil {
+			log.Warnf("Error parsing direct peer address: %v", err)
+			continue
+		}
+
+		connectionManager.directPeers[addr.ID] = util.Void{}
+		whitelist.Allow(addr.ID)
 	}
 
 	return &connectionManager
 }
 
+func (c *ConnectionManager) registerPeerRPCService() {
+	log.Debug("Registering Peer RPC Service")
+	err := c.server.Register(c.rpcService)
+	if err != nil {
+		log.Errorf("Error registering Peer RPC Service: %s", err.Error())
+		panic(err)
+	}
+	log.Debug("Peer RPC Service successfully registered")
+}
+
 // OpenedStream is part of the libp2p network.Notifiee interface
 func (c *ConnectionManager) OpenedStream(n network.Network, s network.Stream) {
 }
@@ -139,34 +328,283 @@ func (c *ConnectionManager) handleConnected(ctx context.Context, msg connectionM
 	pid := msg.conn.RemotePeer()
 	s := fmt.Sprintf("%s/p2p/%s", msg.conn.RemoteMultiaddr(), pid)
 
+	if c.isOverPeerLimit(pid, msg.conn) {
+		log.Infof("Closing connection from peer %s, the limit of %v peers has been reached", s, c.peerOpts.MaxPeers)
+		go msg.conn.Close()
+		return
+	}
+
+	if role, over := c.isOverRoleLimit(pid, msg.conn); over {
+		log.Infof("Closing connection from peer %s, the limit of %s peers has been reached", s, role)
+		go msg.conn.Close()
+		return
+	}
+
 	log.Infof("Connected to peer: %s", s)
 
 	if _, ok := c.connectedPeers[pid]; !ok {
 		childCtx, cancel := context.WithCancel(ctx)
 		peerConn := &peerConnectionContext{
-			peer: NewPeerConnection(
-				pid,
-				c.libProvider,
-				c.localRPC,
-				rpc.NewPeerRPC(c.client, pid),
-				c.peerErrorChan,
-				c.gossipVoteChan,
-				c.peerOpts,
-			),
-			cancel: cancel,
+			peer:      c.newPeerConnection(pid),
+			address:   msg.conn.RemoteMultiaddr(),
+			direction: msg.conn.Stat().Direction,
+			ctx:       childCtx,
+			cancel:    cancel,
 		}
 
-		peerConn.peer.Start(childCtx)
+		// A standby node stays connected, but does not sync until it is promoted
+		if !c.IsStandby() && !c.stopping {
+			peerConn.peer.Start(childCtx)
+		}
 		c.connectedPeers[pid] = peerConn
+		c.metrics.SetConnectedPeers(len(c.connectedPeers))
+
+		now := time.Now()
+		history, ok := c.peerHistories[pid]
+		if !ok {
+			history = &peerHistory{firstConnected: now}
+			c.peerHistories[pid] = history
+		}
+		history.connectedSince = now
+		history.lastSeen = now
+	}
+
+	if c.IsIsolated() {
+		c.exitIsolation()
+	}
+}
+
+func (c *ConnectionManager) newPeerConnection(pid peer.ID) *PeerConnection {
+	return NewPeerConnection(
+		pid,
+		c.libProvider,
+		c.localRPC,
+		rpc.NewPeerRPC(c.client, pid, c.rpcServiceOpts.MaxBlockSize),
+		c.peerErrorChan,
+		c.gossipVoteChan,
+		c.handshakeSlots,
+		c.clockMonitor,
+		c.metrics,
+		c.peerOpts,
+	)
+}
+
+// restartStalledPeers replaces started peer connections that have not finished a handshake attempt or
+// block request within StallTimeout. The stalled connection is cancelled, the peer stays connected.
+func (c *ConnectionManager) restartStalledPeers(ctx context.Context) {
+	if c.stopping || c.IsStandby() {
+		return
+	}
+
+	now := time.Now()
+	for pid, peerConn := range c.connectedPeers {
+		lastActivity := peerConn.peer.LastActivity()
+		if lastActivity.IsZero() || now.Sub(lastActivity) < c.peerOpts.StallTimeout {
+			continue
+		}
+
+		log.Warnf("Peer connection to %s has been stalled for %s, restarting it", pid, now.Sub(lastActivity).Round(time.Second))
+		peerConn.cancel()
+
+		if history, ok := c.peerHistories[pid]; ok {
+			history.servedBlocks = history.servedBlocks || peerConn.peer.DownloadStats().Blocks > 0
+		}
+
+		childCtx, cancel := context.WithCancel(ctx)
+		peerConn.peer = c.newPeerConnection(pid)
+		peerConn.ctx = childCtx
+		peerConn.cancel = cancel
+		peerConn.peer.Start(childCtx)
 	}
 }
 
+// isOverPeerLimit returns true if a new inbound connection from the peer would exceed MaxPeers.
+// Initial and direct peers are always allowed.
+func (c *ConnectionManager) isOverPeerLimit(pid peer.ID, conn network.Conn) bool {
+	if c.peerOpts.MaxPeers <= 0 || len(c.connectedPeers) < c.peerOpts.MaxPeers {
+		return false
+	}
+
+	return !c.isExemptFromLimits(pid, conn)
+}
+
+// isOverRoleLimit returns the peer's registry role, and true if a new inbound connection from the peer
+// would exceed the limit for that role. Initial and direct peers are always allowed.
+func (c *ConnectionManager) isOverRoleLimit(pid peer.ID, conn network.Conn) (string, bool) {
+	role, limit, ok := c.registry.RoleLimit(pid)
+	if !ok || c.isExemptFromLimits(pid, conn) {
+		return role, false
+	}
+
+	count := 0
+	for id := range c.connectedPeers {
+		if entry, ok := c.registry.Lookup(id); ok && entry.Role == role {
+			count++
+		}
+	}
+
+	return role, count >= limit
+}
+
+// isExemptFromLimits returns true if the connection is not subject to connection limits, because the peer
+// is already connected, was dialed by this node, or is an initial or direct peer
+func (c *ConnectionManager) isExemptFromLimits(pid peer.ID, conn network.Conn) bool {
+	if _, ok := c.connectedPeers[pid]; ok {
+		return true
+	}
+
+	if conn.Stat().Direction != network.DirInbound {
+		return true
+	}
+
+	if _, ok := c.getInitialPeer(pid); ok {
+		return true
+	}
+
+	_, ok := c.directPeers[pid]
+	return ok
+}
+
+// GetConnectedPeers returns information about all currently connected peers
+func (c *ConnectionManager) GetConnectedPeers(ctx context.Context) []PeerInfo {
+	resultChan := make(chan []PeerInfo, 1)
+
+	select {
+	case c.peerInfoChan <- peerInfoRequest{resultChan: resultChan}:
+	case <-ctx.Done():
+		return nil
+	}
+
+	select {
+	case res := <-resultChan:
+		return res
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+func (c *ConnectionManager) handleGetConnectedPeers() []PeerInfo {
+	peers := make([]PeerInfo, 0, len(c.connectedPeers))
+	now := time.Now()
+	for pid, peerConn := range c.connectedPeers {
+		info := PeerInfo{
+			ID:        pid,
+			Address:   peerConn.address,
+			Direction: peerConn.direction,
+			Synced:    peerConn.peer.IsSynced(),
+			Head:      peerConn.peer.Head(),
+			Downloads: peerConn.peer.DownloadStats(),
+		}
+
+		if history, ok := c.peerHistories[pid]; ok {
+			info.FirstConnected = history.firstConnected
+			info.LastSeen = history.lastSeen
+			info.Uptime = history.uptime + now.Sub(history.connectedSince)
+		}
+
+		if lastSeen := peerConn.peer.LastSeen(); lastSeen.After(info.LastSeen) {
+			info.LastSeen = lastSeen
+		}
+
+		peers = append(peers, info)
+	}
+
+	return peers
+}
+
+// hasServedBlocks returns true if the peer has served blocks to this node since it started, or if
+// the peer is behind this node's last irreversible block and so has had no blocks to serve
+func (c *ConnectionManager) hasServedBlocks(ctx context.Context, id peer.ID) bool {
+	resultChan := make(chan bool, 1)
+
+	select {
+	case c.servedBlocksChan <- servedBlocksRequest{id: id, resultChan: resultChan}:
+	case <-ctx.Done():
+		return false
+	}
+
+	select {
+	case res := <-resultChan:
+		return res
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (c *ConnectionManager) handleHasServedBlocks(id peer.ID) bool {
+	if history, ok := c.peerHistories[id]; ok && history.servedBlocks {
+		return true
+	}
+
+	if peerConn, ok := c.connectedPeers[id]; ok {
+		if peerConn.peer.DownloadStats().Blocks > 0 {
+			return true
+		}
+
+		// A peer that is behind this node has had no blocks to serve, so it is not a leecher
+		head := peerConn.peer.Head()
+		return head.Height > 0 && head.Height <= c.libProvider.GetLastIrreversibleBlock().Height
+	}
+
+	return false
+}
+
+// DisconnectPeer stops syncing with a connected peer and closes the connection to it. If the peer
+// is an initial peer, it is removed from the initial peers so it is not reconnected. Returns
+// ErrPeerNotConnected if the peer is not connected.
+func (c *ConnectionManager) DisconnectPeer(ctx context.Context, id peer.ID) error {
+	resultChan := make(chan error, 1)
+
+	select {
+	case c.disconnectChan <- disconnectRequest{id: id, resultChan: resultChan}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-resultChan:
+		if err != nil {
+			return err
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	// Closing the connection notifies the manager loop, so it can not be done from within the loop
+	return c.host.Network().ClosePeer(id)
+}
+
+func (c *ConnectionManager) handleDisconnectPeer(id peer.ID) error {
+	peerConn, ok := c.connectedPeers[id]
+	if !ok {
+		return fmt.Errorf("%w, %s", p2perrors.ErrPeerNotConnected, id)
+	}
+
+	peerConn.cancel()
+
+	if c.removeInitialPeer(id) {
+		log.Infof("Removed initial peer %s, it will not be reconnected", id)
+	}
+
+	log.Infof("Disconnecting from peer %s by request", id)
+	return nil
+}
+
 func (c *ConnectionManager) handleDisconnected(ctx context.Context, msg connectionMessage) {
 	pid := msg.conn.RemotePeer()
 
 	if peerConn, ok := c.connectedPeers[pid]; ok {
 		peerConn.cancel()
 		delete(c.connectedPeers, pid)
+		c.clockMonitor.Remove(pid)
+		c.metrics.SetConnectedPeers(len(c.connectedPeers))
+
+		if history, ok := c.peerHistories[pid]; ok {
+			now := time.Now()
+			history.uptime += now.Sub(history.connectedSince)
+			history.lastSeen = now
+			history.servedBlocks = history.servedBlocks || peerConn.peer.DownloadStats().Blocks > 0
+		}
 	} else {
 		return
 	}
@@ -174,22 +612,12 @@ func (c *ConnectionManager) handleDisconnected(ctx context.Context, msg connecti
 	s := fmt.Sprintf("%s/p2p/%s", msg.conn.RemoteMultiaddr(), msg.conn.RemotePeer())
 	log.Infof("Disconnected from peer: %s", s)
 
-	if addr, ok := c.initialPeers[pid]; ok {
-		go func() {
-			sleepTimeSeconds := 1
-			for {
-				log.Infof("Attempting to connect to peer %v", addr.ID)
-				err := c.host.Connect(ctx, addr)
-				if err != nil {
-					log.Infof("Error connecting to peer %v: %s", addr.ID, err)
-				} else {
-					return
-				}
+	if len(c.connectedPeers) == 0 {
+		c.enterIsolation(ctx)
+	}
 
-				time.Sleep(time.Duration(sleepTimeSeconds) * time.Second)
-				sleepTimeSeconds = min(maxSleepBackoff, sleepTimeSeconds*2)
-			}
-		}()
+	if addr, ok := c.getInitialPeer(pid); ok {
+		c.queueReconnect(ctx, addr)
 	}
 
 	go func() {
@@ -200,44 +628,495 @@ func (c *ConnectionManager) handleDisconnected(ctx context.Context, msg connecti
 	}()
 }
 
+// reconnectJob is a pending reconnect to a dropped initial peer
+type reconnectJob struct {
+	addr  peer.AddrInfo
+	delay time.Duration
+	due   time.Time
+}
+
+// reconnectResult is the outcome of a reconnect attempt, jobs to retry are scheduled again
+type reconnectResult struct {
+	job   reconnectJob
+	retry bool
+}
+
+// queueReconnect schedules a reconnect to the peer. Reconnects are attempted by a fixed pool of workers,
+// so peers dropping at once do not each hold a goroutine while backing off.
+func (c *ConnectionManager) queueReconnect(ctx context.Context, addr peer.AddrInfo) {
+	select {
+	case c.reconnectChan <- addr:
+	case <-ctx.Done():
+	}
+}
+
+// reconnectLoop schedules reconnect jobs, handing each to a worker once its backoff has elapsed.
+// Each peer has at most one pending or running job.
+func (c *ConnectionManager) reconnectLoop(ctx context.Context) {
+	pending := make(map[peer.ID]*reconnectJob)
+	running := make(map[peer.ID]util.Void)
+
+	for {
+		var next *reconnectJob
+		for _, job := range pending {
+			if next == nil || job.due.Before(next.due) {
+				next = job
+			}
+		}
+
+		var workChan chan<- reconnectJob
+		var nextJob reconnectJob
+		var timer *time.Timer
+		var timerChan <-chan time.Time
+		if next != nil {
+			if wait := time.Until(next.due); wait > 0 {
+				timer = time.NewTimer(wait)
+				timerChan = timer.C
+			} else {
+				workChan = c.reconnectWorkChan
+				nextJob = *next
+			}
+		}
+
+		select {
+		case addr := <-c.reconnectChan:
+			_, isPending := pending[addr.ID]
+			_, isRunning := running[addr.ID]
+			if !isPending && !isRunning {
+				pending[addr.ID] = &reconnectJob{addr: addr, delay: c.peerOpts.ReconnectBackoff, due: time.Now()}
+			}
+		case workChan <- nextJob:
+			delete(pending, nextJob.addr.ID)
+			running[nextJob.addr.ID] = util.Void{}
+		case result := <-c.reconnectResultChan:
+			delete(running, result.job.addr.ID)
+			if result.retry {
+				pending[result.job.addr.ID] = &result.job
+			}
+		case <-timerChan:
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// reconnectWorker attempts the reconnect jobs it is handed, scheduling failed jobs to be retried after a backoff.
+// A peer that is no longer an initial peer, such as one disconnected by request, is not dialed.
+func (c *ConnectionManager) reconnectWorker(ctx context.Context) {
+	for {
+		select {
+		case job := <-c.reconnectWorkChan:
+			retry := false
+			if _, ok := c.getInitialPeer(job.addr.ID); !ok {
+				log.Debugf("Peer %s is no longer an initial peer, it will not be reconnected", job.addr.ID)
+			} else if err := c.connectToPeer(ctx, job.addr); err != nil {
+				retry = true
+				job.due = time.Now().Add(jitterBackoff(job.delay, c.peerOpts.BackoffJitter))
+				job.delay *= 2
+				if job.delay > c.peerOpts.ReconnectMaxBackoff {
+					job.delay = c.peerOpts.ReconnectMaxBackoff
+				}
+
+				// Below the minimum number of peers, keep retrying without backing off
+				if len(c.host.Network().Peers()) < c.peerOpts.MinPeers {
+					job.delay = c.peerOpts.ReconnectBackoff
+				}
+			}
+
+			select {
+			case c.reconnectResultChan <- reconnectResult{job: job, retry: retry}:
+			case <-ctx.Done():
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// startReconnects starts the reconnect scheduler and its pool of MaxReconnects workers
+func (c *ConnectionManager) startReconnects(ctx context.Context) {
+	go c.reconnectLoop(ctx)
+	for i := 0; i < c.peerOpts.MaxReconnects; i++ {
+		go c.reconnectWorker(ctx)
+	}
+}
+
+func (c *ConnectionManager) identifyPeer(ctx context.Context, ma multiaddr.Multiaddr) (peer.AddrInfo, error) {
+	dialCtx, cancel := context.WithTimeout(ctx, c.peerOpts.DialTimeout)
+	defer cancel()
+	id, err := identifyPeerAddress(dialCtx, c.host, ma)
+	if err != nil {
+		return peer.AddrInfo{}, err
+	}
+
+	log.Infof("Identified peer %v at %s", id, ma)
+	addr := peer.AddrInfo{ID: id, Addrs: []multiaddr.Multiaddr{ma}}
+
+	c.initialPeersMutex.Lock()
+	if _, ok := c.initialPeers[id]; !ok {
+		c.initialPeerOrder = append(c.initialPeerOrder, id)
+	}
+	c.initialPeers[id] = addr
+	c.initialPeersMutex.Unlock()
+	c.whitelist.Allow(id)
+
+	return addr, nil
+}
+
+func (c *ConnectionManager) getInitialPeer(id peer.ID) (peer.AddrInfo, bool) {
+	c.initialPeersMutex.RLock()
+	defer c.initialPeersMutex.RUnlock()
+
+	addr, ok := c.initialPeers[id]
+	return addr, ok
+}
+
+// removeInitialPeer removes the peer from the initial peers, returning false if it was not an initial peer
+func (c *ConnectionManager) removeInitialPeer(id peer.ID) bool {
+	c.initialPeersMutex.Lock()
+	defer c.initialPeersMutex.Unlock()
+
+	if _, ok := c.initialPeers[id]; !ok {
+		return false
+	}
+
+	delete(c.initialPeers, id)
+	for i, orderedID := range c.initialPeerOrder {
+		if orderedID == id {
+			c.initialPeerOrder = append(c.initialPeerOrder[:i], c.initialPeerOrder[i+1:]...)
+			break
+		}
+	}
+
+	return true
+}
+
+func (c *ConnectionManager) getInitialPeers() map[peer.ID]peer.AddrInfo {
+	c.initialPeersMutex.RLock()
+	defer c.initialPeersMutex.RUnlock()
+
+	peers := make(map[peer.ID]peer.AddrInfo, len(c.initialPeers))
+	for id, addr := range c.initialPeers {
+		peers[id] = addr
+	}
+
+	return peers
+}
+
+// getOrderedInitialPeers returns the initial peers in the order they were configured, with peers
+// identified while connecting last, or in random order if ShuffleInitialPeers is set
+func (c *ConnectionManager) getOrderedInitialPeers() []peer.AddrInfo {
+	c.initialPeersMutex.RLock()
+	peers := make([]peer.AddrInfo, 0, len(c.initialPeerOrder))
+	for _, id := range c.initialPeerOrder {
+		peers = append(peers, c.initialPeers[id])
+	}
+	c.initialPeersMutex.RUnlock()
+
+	if c.peerOpts.ShuffleInitialPeers {
+		rand.Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+	}
+
+	return peers
+}
+
+func (c *ConnectionManager) connectToPeer(ctx context.Context, addr peer.AddrInfo) error {
+	log.Infof("Attempting to connect to peer %v", addr.ID)
+	dialCtx, cancel := context.WithTimeout(ctx, c.peerOpts.DialTimeout)
+	defer cancel()
+	err := c.host.Connect(dialCtx, addr)
+
+	c.reconnectMutex.Lock()
+	stats, ok := c.reconnectStats[addr.ID]
+	if !ok {
+		stats = &ReconnectStats{}
+		c.reconnectStats[addr.ID] = stats
+	}
+	stats.Attempts++
+	if err != nil {
+		stats.Failures++
+	} else {
+		stats.Successes++
+	}
+	c.reconnectMutex.Unlock()
+
+	if err != nil {
+		log.Infof("Error connecting to peer %v: %s", addr.ID, err)
+	}
+
+	return err
+}
+
+// GetReconnectStats returns the connection attempt counts for each peer the connection manager has dialed
+func (c *ConnectionManager) GetReconnectStats() map[peer.ID]ReconnectStats {
+	c.reconnectMutex.Lock()
+	defer c.reconnectMutex.Unlock()
+
+	stats := make(map[peer.ID]ReconnectStats, len(c.reconnectStats))
+	for id, s := range c.reconnectStats {
+		stats[id] = *s
+	}
+
+	return stats
+}
+
+// IsIsolated returns whether the node has lost all of its peers
+func (c *ConnectionManager) IsIsolated() bool {
+	return c.isolated.Load().(bool)
+}
+
+func (c *ConnectionManager) isStarted() bool {
+	return c.started.Load().(bool)
+}
+
+// isServing returns true if the peer RPC service should answer requests. A standby node refuses them until promoted.
+func (c *ConnectionManager) isServing() bool {
+	return c.isStarted() && !c.IsStandby()
+}
+
+// reportPeerError reports an error caused by a peer's requests to the peer RPC service. The request
+// waits for the error to be handled, giving up if the request is cancelled.
+func (c *ConnectionManager) reportPeerError(ctx context.Context, id peer.ID, err error) {
+	select {
+	case c.peerErrorChan <- PeerError{id: id, err: err}:
+	case <-ctx.Done():
+	}
+}
+
+// IsStandby returns true if the node is a warm standby that does not sync or serve blocks
+func (c *ConnectionManager) IsStandby() bool {
+	return c.standby.Load().(bool)
+}
+
+// Promote ends standby, syncing with connected peers and serving peer RPC requests.
+// It returns false if the node was not in standby.
+func (c *ConnectionManager) Promote(ctx context.Context) bool {
+	resultChan := make(chan bool, 1)
+
+	select {
+	case c.promoteChan <- promoteRequest{resultChan: resultChan}:
+	case <-ctx.Done():
+		return false
+	}
+
+	select {
+	case res := <-resultChan:
+		return res
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (c *ConnectionManager) handlePromote() bool {
+	if !c.IsStandby() || c.stopping {
+		return false
+	}
+
+	log.Info("Promoting node from standby")
+	c.standby.Store(false)
+
+	for _, peerConn := range c.connectedPeers {
+		peerConn.peer.Start(peerConn.ctx)
+	}
+
+	return true
+}
+
+// Stop all peer connections from making new requests and wait for the requests in flight to finish.
+// It returns the context's error if the context is done first.
+func (c *ConnectionManager) Stop(ctx context.Context) error {
+	if !c.isStarted() {
+		return nil
+	}
+
+	resultChan := make(chan []*PeerConnection, 1)
+
+	select {
+	case c.stopChan <- stopRequest{resultChan: resultChan}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	var peers []*PeerConnection
+	select {
+	case peers = <-resultChan:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for _, peer := range peers {
+			peer.Wait()
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *ConnectionManager) handleStop() []*PeerConnection {
+	c.stopping = true
+
+	peers := make([]*PeerConnection, 0, len(c.connectedPeers))
+	for _, peerConn := range c.connectedPeers {
+		peerConn.peer.Stop()
+		peers = append(peers, peerConn.peer)
+	}
+
+	return peers
+}
+
+// IsInOutage returns true if the node has exhausted its isolation retry budget without reconnecting
+func (c *ConnectionManager) IsInOutage() bool {
+	return c.outage.Load().(bool)
+}
+
+func (c *ConnectionManager) enterIsolation(ctx context.Context) {
+	if c.IsIsolated() {
+		return
+	}
+
+	log.Warn("No peers are connected, node is isolated")
+	c.isolated.Store(true)
+
+	isolationCtx, cancel := context.WithCancel(ctx)
+	c.isolationCancel = cancel
+	go c.isolationLoop(isolationCtx)
+}
+
+func (c *ConnectionManager) exitIsolation() {
+	log.Info("Node is no longer isolated")
+	c.isolated.Store(false)
+	c.outage.Store(false)
+
+	if c.isolationCancel != nil {
+		c.isolationCancel()
+		c.isolationCancel = nil
+	}
+}
+
+func (c *ConnectionManager) isolationLoop(ctx context.Context) {
+	// While isolated, ignore the dial backoff and retry all initial peers on a fixed interval.
+	// Once the retry budget is spent, fall back to probing on the slower outage interval.
+	dialCtx := network.WithForceDirectDial(ctx, "isolated")
+	interval := c.isolationOpts.ReconnectInterval
+	var attempts uint64
+
+	for {
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+
+		for _, addr := range c.getInitialPeers() {
+			_ = c.connectToPeer(dialCtx, addr)
+			attempts++
+		}
+
+		if c.isolationOpts.RetryBudget > 0 && attempts >= c.isolationOpts.RetryBudget && !c.IsInOutage() {
+			log.Warnf("Could not reconnect to any peer after %v attempts, node is in an outage", attempts)
+			c.outage.Store(true)
+			interval = c.isolationOpts.OutageProbeInterval
+		}
+	}
+}
+
 func (c *ConnectionManager) connectInitialPeers(ctx context.Context) {
-	newlyConnectedPeers := make(map[peer.ID]util.Void)
 	peersToConnect := make(map[peer.ID]peer.AddrInfo)
-	sleepTimeSeconds := 1
+	delay := c.peerOpts.InitialConnectBackoff
 
-	for k, v := range c.initialPeers {
+	for k, v := range c.getInitialPeers() {
 		peersToConnect[k] = v
 	}
 
-	for len(peersToConnect) > 0 {
-		for peer, addr := range c.initialPeers {
-			log.Infof("Attempting to connect to peer %v", peer)
-			err := c.host.Connect(ctx, addr)
+	unidentifiedPeers := c.unidentifiedPeers
+	firstPass := true
+
+	for len(peersToConnect) > 0 || len(unidentifiedPeers) > 0 {
+		stillUnidentified := make([]multiaddr.Multiaddr, 0, len(unidentifiedPeers))
+		for _, ma := range unidentifiedPeers {
+			addr, err := c.identifyPeer(ctx, ma)
 			if err != nil {
-				log.Infof("Error connecting to peer %v: %s", peer, err)
-			} else {
-				newlyConnectedPeers[peer] = util.Void{}
+				log.Infof("Error identifying peer at %s: %s", ma, err)
+				stillUnidentified = append(stillUnidentified, ma)
+				continue
 			}
+
+			peersToConnect[addr.ID] = addr
 		}
+		unidentifiedPeers = stillUnidentified
+
+		for _, addr := range c.getOrderedInitialPeers() {
+			if _, ok := peersToConnect[addr.ID]; !ok {
+				continue
+			}
 
-		for peer := range newlyConnectedPeers {
-			delete(peersToConnect, peer)
+			if err := c.connectToPeer(ctx, addr); err == nil {
+				delete(peersToConnect, addr.ID)
+			}
 		}
 
-		newlyConnectedPeers = make(map[peer.ID]util.Void)
+		// A node that could not reach any initial peer on its first pass is isolated from the start
+		if firstPass {
+			firstPass = false
+			select {
+			case c.startupIsolationChan <- struct{}{}:
+			default:
+			}
+		}
 
-		time.Sleep(time.Duration(sleepTimeSeconds) * time.Second)
-		sleepTimeSeconds = min(maxSleepBackoff, sleepTimeSeconds*2)
+		var ok bool
+		if delay, ok = sleepBackoff(ctx, delay, c.peerOpts.InitialConnectMaxBackoff, c.peerOpts.BackoffJitter); !ok {
+			return
+		}
 	}
 }
 
 func (c *ConnectionManager) managerLoop(ctx context.Context) {
+	var stallCheck <-chan time.Time
+	if c.peerOpts.StallTimeout > 0 {
+		ticker := time.NewTicker(c.peerOpts.StallTimeout / 2)
+		defer ticker.Stop()
+		stallCheck = ticker.C
+	}
+
 	for {
 		select {
 		case connMsg := <-c.peerConnectedChan:
 			c.handleConnected(ctx, connMsg)
 		case connMsg := <-c.peerDisconnectedChan:
 			c.handleDisconnected(ctx, connMsg)
+		case req := <-c.peerInfoChan:
+			req.resultChan <- c.handleGetConnectedPeers()
+		case req := <-c.servedBlocksChan:
+			req.resultChan <- c.handleHasServedBlocks(req.id)
+		case req := <-c.disconnectChan:
+			req.resultChan <- c.handleDisconnectPeer(req.id)
+		case req := <-c.promoteChan:
+			req.resultChan <- c.handlePromote()
+		case req := <-c.stopChan:
+			req.resultChan <- c.handleStop()
+		case <-c.startupIsolationChan:
+			if len(c.connectedPeers) == 0 && !c.stopping {
+				c.enterIsolation(ctx)
+			}
+		case <-stallCheck:
+			c.restartStalledPeers(ctx)
 
 		case <-ctx.Done():
 			for _, conn := range c.connectedPeers {
@@ -252,6 +1131,9 @@ func (c *ConnectionManager) managerLoop(ctx context.Context) {
 
 // Start the connection manager
 func (c *ConnectionManager) Start(ctx context.Context) {
+	// The connection manager is started once the local node is initialized
+	c.started.Store(true)
+
 	go func() {
 		for _, peer := range c.host.Network().Peers() {
 			conns := c.host.Network().ConnsToPeer(peer)
@@ -260,6 +1142,7 @@ func (c *ConnectionManager) Start(ctx context.Context) {
 			}
 		}
 
+		c.startReconnects(ctx)
 		go c.connectInitialPeers(ctx)
 		go c.managerLoop(ctx)
 	}()
@@ -0,0 +1,1072 @@
+package p2p
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koinos/koinos-p2p/internal/options"
+	"github.com/koinos/koinos-p2p/internal/p2perrors"
+	"github.com/koinos/koinos-p2p/internal/rpc"
+	libp2p "github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/test"
+	noise "github.com/libp2p/go-libp2p-noise"
+	libp2ptls "github.com/libp2p/go-libp2p-tls"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+func newTestHost(t *testing.T) host.Host {
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return h
+}
+
+func newTestConnectionManager(t *testing.T, h host.Host, peerOpts *options.PeerConnectionOptions, initialPeers []string) *ConnectionManager {
+	return newTestConnectionManagerWithOptions(t, h, &testLocalRPC{chainID: 1}, peerOpts, options.NewIsolationOptions(), options.NewPeerRPCServiceOptions(), nil, initialPeers, false)
+}
+
+func newTestConnectionManagerWithOptions(t *testing.T, h host.Host, localRPC rpc.LocalRPC, peerOpts *options.PeerConnectionOptions, isolationOpts *options.IsolationOptions, rpcServiceOpts *options.PeerRPCServiceOptions, whitelist *Whitelist, initialPeers []string, standby bool) *ConnectionManager {
+	return NewConnectionManager(
+		h,
+		localRPC,
+		peerOpts,
+		isolationOpts,
+		rpcServiceOpts,
+		whitelist,
+		nil,
+		&testLIBProvider{height: 1},
+		nil,
+		initialPeers,
+		nil,
+		standby,
+		make(chan PeerError),
+		make(chan GossipVote),
+		make(chan peer.ID),
+	)
+}
+
+func randomPeerAddresses(t *testing.T, count int) ([]string, []peer.ID) {
+	addrs := make([]string, 0, count)
+	ids := make([]peer.ID, 0, count)
+	for i := 0; i < count; i++ {
+		id, err := test.RandPeerID()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		addrs = append(addrs, fmt.Sprintf("/ip4/127.0.0.1/tcp/%v/p2p/%s", 10000+i, id))
+		ids = append(ids, id)
+	}
+
+	return addrs, ids
+}
+
+func TestMaxInitialPeers(t *testing.T) {
+	h := newTestHost(t)
+	defer h.Close()
+
+	opts := options.NewPeerConnectionOptions()
+	opts.MaxInitialPeers = 10
+
+	addrs, ids := randomPeerAddresses(t, 25)
+	cm := newTestConnectionManager(t, h, opts, addrs)
+
+	if len(cm.initialPeers) != opts.MaxInitialPeers {
+		t.Errorf("Initial peers were not capped. Expected %v, was %v", opts.MaxInitialPeers, len(cm.initialPeers))
+	}
+
+	for i, id := range ids {
+		_, ok := cm.initialPeers[id]
+		if i < opts.MaxInitialPeers && !ok {
+			t.Errorf("Expected initial peer %v to be kept", i)
+		} else if i >= opts.MaxInitialPeers && ok {
+			t.Errorf("Expected initial peer %v to be dropped", i)
+		}
+	}
+}
+
+func TestReconnectStats(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	h := newTestHost(t)
+	defer h.Close()
+
+	remote := newTestHost(t)
+	defer remote.Close()
+
+	cm := newTestConnectionManager(t, h, options.NewPeerConnectionOptions(), []string{})
+
+	// Nothing is listening on this address, so the first attempt must fail
+	badAddr, err := multiaddr.NewMultiaddr("/ip4/127.0.0.1/tcp/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cm.connectToPeer(ctx, peer.AddrInfo{ID: remote.ID(), Addrs: []multiaddr.Multiaddr{badAddr}}); err == nil {
+		t.Fatal("Expected connecting to an unreachable address to fail")
+	}
+
+	if err := cm.connectToPeer(ctx, peer.AddrInfo{ID: remote.ID(), Addrs: remote.Addrs()}); err != nil {
+		t.Fatalf("Unexpected error connecting to peer: %s", err)
+	}
+
+	stats, ok := cm.GetReconnectStats()[remote.ID()]
+	if !ok {
+		t.Fatal("Expected reconnect stats for remote peer")
+	}
+
+	expected := ReconnectStats{Attempts: 2, Successes: 1, Failures: 1}
+	if stats != expected {
+		t.Errorf("Incorrect reconnect stats. Expected %+v, was %+v", expected, stats)
+	}
+}
+
+func TestJitterBackoff(t *testing.T) {
+	delay := time.Second
+
+	if jittered := jitterBackoff(delay, 0); jittered != delay {
+		t.Errorf("Expected no jitter, was %v", jittered)
+	}
+
+	min, max := delay, delay
+	for i := 0; i < 1000; i++ {
+		jittered := jitterBackoff(delay, 0.5)
+		if jittered < delay/2 || jittered >= delay*3/2 {
+			t.Fatalf("Expected jittered delay in [%v, %v), was %v", delay/2, delay*3/2, jittered)
+		}
+		if jittered < min {
+			min = jittered
+		}
+		if jittered > max {
+			max = jittered
+		}
+	}
+
+	if min == delay || max == delay {
+		t.Errorf("Expected delays both shorter and longer than %v, was between %v and %v", delay, min, max)
+	}
+}
+
+func TestConnectBackoff(t *testing.T) {
+	h := newTestHost(t)
+	defer h.Close()
+
+	fast := time.Millisecond * 10
+	slow := time.Hour
+
+	tests := []struct {
+		name                   string
+		initialBackoff         time.Duration
+		reconnectBackoff       time.Duration
+		expectInitialRetries   bool
+		expectReconnectRetries bool
+	}{
+		{"fast initial connect", fast, slow, true, false},
+		{"fast reconnect", slow, fast, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := options.NewPeerConnectionOptions()
+			opts.InitialConnectBackoff = tt.initialBackoff
+			opts.InitialConnectMaxBackoff = tt.initialBackoff
+			opts.ReconnectBackoff = tt.reconnectBackoff
+			opts.ReconnectMaxBackoff = tt.reconnectBackoff
+
+			// Neither peer is reachable, so both loops keep retrying until the context is done.
+			// Each initial peer has its own connection manager, one connecting and the other reconnecting.
+			addrs, ids := randomPeerAddresses(t, 2)
+			initialCM := newTestConnectionManager(t, h, opts, addrs[:1])
+			reconnectCM := newTestConnectionManager(t, h, opts, addrs[1:])
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*300)
+			defer cancel()
+
+			done := make(chan struct{})
+			go func() {
+				initialCM.connectInitialPeers(ctx)
+				done <- struct{}{}
+			}()
+
+			addrInfo, err := peer.AddrInfoFromString(addrs[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			reconnectCM.startReconnects(ctx)
+			reconnectCM.queueReconnect(ctx, *addrInfo)
+			<-done
+
+			initialStats := initialCM.GetReconnectStats()
+			if retried := initialStats[ids[0]].Attempts > 1; retried != tt.expectInitialRetries {
+				t.Errorf("Unexpected initial connect attempts. Expected retries %v, was %v attempts", tt.expectInitialRetries, initialStats[ids[0]].Attempts)
+			}
+			reconnectStats := reconnectCM.GetReconnectStats()
+			if retried := reconnectStats[ids[1]].Attempts > 1; retried != tt.expectReconnectRetries {
+				t.Errorf("Unexpected reconnect attempts. Expected retries %v, was %v attempts", tt.expectReconnectRetries, reconnectStats[ids[1]].Attempts)
+			}
+		})
+	}
+}
+
+func TestIdentifyPeerAddress(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	tests := []struct {
+		name     string
+		security libp2p.Option
+	}{
+		{"noise", libp2p.Security(noise.ID, noise.New)},
+		{"tls", libp2p.Security(libp2ptls.ID, libp2ptls.New)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"), tt.security)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer h.Close()
+
+			remote, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0", "/ip4/127.0.0.1/udp/0/quic"), tt.security)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer remote.Close()
+
+			for _, addr := range remote.Addrs() {
+				id, err := identifyPeerAddress(ctx, h, addr)
+				if err != nil {
+					t.Fatalf("Could not identify peer at %s: %s", addr, err)
+				}
+				if id != remote.ID() {
+					t.Errorf("Incorrect peer identified at %s. Expected %s, was %s", addr, remote.ID(), id)
+				}
+			}
+		})
+	}
+}
+
+func TestConnectWithoutPeerID(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	h := newTestHost(t)
+	defer h.Close()
+
+	remote := newTestHost(t)
+	defer remote.Close()
+
+	// Only the transport address is known, not the /p2p/ peer ID
+	cm := newTestConnectionManager(t, h, options.NewPeerConnectionOptions(), []string{remote.Addrs()[0].String()})
+
+	if len(cm.initialPeers) != 0 || len(cm.unidentifiedPeers) != 1 {
+		t.Fatalf("Expected one unidentified initial peer, was %v identified and %v unidentified", len(cm.initialPeers), len(cm.unidentifiedPeers))
+	}
+
+	go cm.connectInitialPeers(ctx)
+
+	for h.Network().Connectedness(remote.ID()) != network.Connected {
+		select {
+		case <-time.After(time.Millisecond * 10):
+		case <-ctx.Done():
+			t.Fatal("Never connected to peer at an address without a peer ID")
+		}
+	}
+
+	if _, ok := cm.getInitialPeer(remote.ID()); !ok {
+		t.Errorf("Expected identified peer %v to be kept as an initial peer", remote.ID())
+	}
+}
+
+func waitForConnectedPeers(ctx context.Context, t *testing.T, cm *ConnectionManager, count int) []PeerInfo {
+	for {
+		peers := cm.GetConnectedPeers(ctx)
+		if len(peers) == count {
+			return peers
+		}
+
+		select {
+		case <-time.After(time.Millisecond * 10):
+		case <-ctx.Done():
+			t.Fatalf("Expected %v connected peers, was %v", count, len(peers))
+		}
+	}
+}
+
+func TestPeerUptime(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	h := newTestHost(t)
+	defer h.Close()
+
+	remote := newTestHost(t)
+	defer remote.Close()
+
+	cm := newTestConnectionManager(t, h, options.NewPeerConnectionOptions(), []string{})
+	h.Network().Notify(cm)
+	cm.Start(ctx)
+
+	remoteAddr := peer.AddrInfo{ID: remote.ID(), Addrs: remote.Addrs()}
+	if err := h.Connect(ctx, remoteAddr); err != nil {
+		t.Fatal(err)
+	}
+
+	first := waitForConnectedPeers(ctx, t, cm, 1)[0]
+	if first.FirstConnected.IsZero() || first.LastSeen.Before(first.FirstConnected) {
+		t.Fatalf("Expected first connected and last seen to be set, was %v and %v", first.FirstConnected, first.LastSeen)
+	}
+
+	session := time.Millisecond * 200
+	time.Sleep(session)
+
+	if err := h.Network().ClosePeer(remote.ID()); err != nil {
+		t.Fatal(err)
+	}
+	waitForConnectedPeers(ctx, t, cm, 0)
+	disconnectedAt := time.Now()
+
+	time.Sleep(session)
+
+	if err := h.Connect(ctx, remoteAddr); err != nil {
+		t.Fatal(err)
+	}
+	second := waitForConnectedPeers(ctx, t, cm, 1)[0]
+
+	if !second.FirstConnected.Equal(first.FirstConnected) {
+		t.Errorf("First connected changed after reconnect. Expected %v, was %v", first.FirstConnected, second.FirstConnected)
+	}
+
+	if !second.LastSeen.After(disconnectedAt) {
+		t.Errorf("Expected last seen to update after reconnect, was %v", second.LastSeen)
+	}
+
+	// Uptime includes the first session but not the time spent disconnected
+	if second.Uptime < session {
+		t.Errorf("Expected uptime to include the first session of %v, was %v", session, second.Uptime)
+	}
+	if second.Uptime >= time.Since(first.FirstConnected)-session {
+		t.Errorf("Expected uptime to exclude time disconnected, was %v", second.Uptime)
+	}
+}
+
+func TestClientOnly(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	client := newTestHost(t)
+	defer client.Close()
+
+	server := newTestHost(t)
+	defer server.Close()
+
+	clientOpts := options.NewPeerRPCServiceOptions()
+	clientOpts.ClientOnly = true
+	clientCM := newTestConnectionManagerWithOptions(t, client, &testLocalRPC{chainID: 1}, options.NewPeerConnectionOptions(), options.NewIsolationOptions(), clientOpts, nil, []string{}, false)
+	serverCM := newTestConnectionManager(t, server, options.NewPeerConnectionOptions(), []string{})
+
+	// Neither node is started, so mark them ready to serve directly
+	serverCM.started.Store(true)
+	clientCM.started.Store(true)
+
+	if err := client.Connect(ctx, peer.AddrInfo{ID: server.ID(), Addrs: server.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A client only node still answers handshake requests, but refuses to serve blocks
+	toClient := rpc.NewPeerRPC(serverCM.client, client.ID(), 0)
+	if _, err := toClient.GetChainID(ctx); err != nil {
+		t.Errorf("Client only node did not serve its chain ID: %s", err)
+	}
+
+	if _, err := toClient.GetBlocks(ctx, testBlockID(10), 1, 10); !errors.Is(err, p2perrors.ErrHeightNotServable) {
+		t.Errorf("Expected ErrHeightNotServable from a client only node, was %v", err)
+	}
+
+	blocks, err := rpc.NewPeerRPC(clientCM.client, server.ID(), 0).GetBlocks(ctx, testBlockID(10), 1, 10)
+	if err != nil {
+		t.Fatalf("Client only node could not download blocks: %s", err)
+	}
+	if len(blocks) != 10 {
+		t.Errorf("Incorrect number of blocks downloaded. Expected 10, was %v", len(blocks))
+	}
+}
+
+func TestOutage(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	h := newTestHost(t)
+	defer h.Close()
+
+	isolationOpts := options.NewIsolationOptions()
+	isolationOpts.ReconnectInterval = time.Millisecond * 10
+	isolationOpts.RetryBudget = 4
+	isolationOpts.OutageProbeInterval = time.Millisecond * 250
+
+	// Neither initial peer is reachable, so every attempt counts against the budget
+	addrs, ids := randomPeerAddresses(t, 2)
+	cm := newTestConnectionManagerWithOptions(t, h, &testLocalRPC{chainID: 1}, options.NewPeerConnectionOptions(), isolationOpts, options.NewPeerRPCServiceOptions(), nil, addrs, false)
+
+	totalAttempts := func() uint64 {
+		var total uint64
+		stats := cm.GetReconnectStats()
+		for _, id := range ids {
+			total += stats[id].Attempts
+		}
+		return total
+	}
+
+	cm.enterIsolation(ctx)
+
+	for !cm.IsInOutage() {
+		select {
+		case <-time.After(time.Millisecond * 10):
+		case <-ctx.Done():
+			t.Fatal("Node never entered outage after exhausting its retry budget")
+		}
+	}
+
+	if attempts := totalAttempts(); attempts != isolationOpts.RetryBudget {
+		t.Errorf("Incorrect number of attempts before outage. Expected %v, was %v", isolationOpts.RetryBudget, attempts)
+	}
+
+	// At the reconnect interval there would be dozens of rounds, probing allows at most one
+	time.Sleep(time.Millisecond * 400)
+	if probes := totalAttempts() - isolationOpts.RetryBudget; probes > uint64(len(ids)) {
+		t.Errorf("Expected at most one probe round during outage, was %v attempts", probes)
+	}
+
+	// Leaving isolation clears the outage
+	cm.exitIsolation()
+	if cm.IsInOutage() {
+		t.Error("Expected outage to clear when isolation ends")
+	}
+}
+
+func TestStandby(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	h := newTestHost(t)
+	defer h.Close()
+
+	remote := newTestHost(t)
+	defer remote.Close()
+
+	peerOpts := options.NewPeerConnectionOptions()
+	peerOpts.SyncedPingTime = time.Millisecond * 50
+
+	localRPC := &testLocalRPC{chainID: 1}
+	cm := newTestConnectionManagerWithOptions(t, h, localRPC, peerOpts, options.NewIsolationOptions(), options.NewPeerRPCServiceOptions(), nil, []string{}, true)
+	h.Network().Notify(cm)
+	cm.Start(ctx)
+
+	// The remote node serves blocks up to height 3
+	remoteCM := newTestConnectionManagerWithOptions(t, remote, &testLocalRPC{chainID: 1, headHeight: 3}, peerOpts, options.NewIsolationOptions(), options.NewPeerRPCServiceOptions(), nil, []string{}, false)
+	remoteCM.started.Store(true)
+
+	if err := h.Connect(ctx, peer.AddrInfo{ID: remote.ID(), Addrs: remote.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForConnectedPeers(ctx, t, cm, 1)
+	time.Sleep(time.Millisecond * 200)
+
+	if !cm.IsStandby() {
+		t.Error("Expected node to be in standby")
+	}
+	if localRPC.numApplied() != 0 {
+		t.Fatalf("Expected standby node not to sync, applied %v blocks", localRPC.numApplied())
+	}
+	if cm.hasServedBlocks(ctx, remote.ID()) {
+		t.Error("Expected remote not to have served blocks to a standby node")
+	}
+
+	toStandby := rpc.NewPeerRPC(remoteCM.client, h.ID(), 0)
+	if _, err := toStandby.GetChainID(ctx); !errors.Is(err, p2perrors.ErrPeerNotReady) {
+		t.Errorf("Expected ErrPeerNotReady from a standby node, was %v", err)
+	}
+
+	if !cm.Promote(ctx) {
+		t.Fatal("Expected standby node to be promoted")
+	}
+	if cm.IsStandby() {
+		t.Error("Expected node not to be in standby after promotion")
+	}
+	if cm.Promote(ctx) {
+		t.Error("Expected promoting an active node to return false")
+	}
+
+	if _, err := toStandby.GetChainID(ctx); err != nil {
+		t.Errorf("Promoted node did not serve its chain ID: %s", err)
+	}
+
+	for localRPC.numApplied() < 2 {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("Timed out waiting for promoted node to sync, applied %v blocks", localRPC.numApplied())
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+
+	if !cm.hasServedBlocks(ctx, remote.ID()) {
+		t.Error("Expected remote to have served blocks once the node synced from it")
+	}
+}
+
+func TestDialTimeout(t *testing.T) {
+	h := newTestHost(t)
+	defer h.Close()
+
+	remote := newTestHost(t)
+	defer remote.Close()
+
+	// Accept connections but never complete the libp2p handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	stalledAddr, err := manet.FromNetAddr(listener.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := options.NewPeerConnectionOptions()
+	opts.DialTimeout = time.Millisecond * 200
+	cm := newTestConnectionManager(t, h, opts, []string{})
+
+	start := time.Now()
+	if err := cm.connectToPeer(context.Background(), peer.AddrInfo{ID: remote.ID(), Addrs: []multiaddr.Multiaddr{stalledAddr}}); err == nil {
+		t.Fatal("Expected connecting to a stalled peer to fail")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second*2 {
+		t.Errorf("Expected connection attempt to time out after %v, took %v", opts.DialTimeout, elapsed)
+	}
+
+	start = time.Now()
+	if _, err := cm.identifyPeer(context.Background(), stalledAddr); err == nil {
+		t.Fatal("Expected identifying a stalled peer to fail")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second*2 {
+		t.Errorf("Expected identify attempt to time out after %v, took %v", opts.DialTimeout, elapsed)
+	}
+}
+
+func TestMaxPeers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	h := newTestHost(t)
+	defer h.Close()
+
+	opts := options.NewPeerConnectionOptions()
+	opts.MaxPeers = 2
+	cm := newTestConnectionManager(t, h, opts, []string{})
+	h.Network().Notify(cm)
+	cm.Start(ctx)
+
+	hostAddr := peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()}
+	remotes := make([]host.Host, 0, opts.MaxPeers+1)
+	for i := 0; i < opts.MaxPeers+1; i++ {
+		remote := newTestHost(t)
+		defer remote.Close()
+		remotes = append(remotes, remote)
+
+		if err := remote.Connect(ctx, hostAddr); err != nil {
+			t.Fatal(err)
+		}
+		if i < opts.MaxPeers {
+			waitForConnectedPeers(ctx, t, cm, i+1)
+		}
+	}
+
+	last := remotes[len(remotes)-1]
+	for h.Network().Connectedness(last.ID()) == network.Connected {
+		select {
+		case <-time.After(time.Millisecond * 10):
+		case <-ctx.Done():
+			t.Fatal("Expected the connection over the peer limit to be closed")
+		}
+	}
+
+	for _, p := range cm.GetConnectedPeers(ctx) {
+		if p.ID == last.ID() {
+			t.Errorf("Expected peer over the limit not to be connected")
+		}
+	}
+}
+
+func TestRoleLimits(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	observers := []host.Host{newTestHost(t), newTestHost(t)}
+	validator := newTestHost(t)
+	for _, remote := range append(observers, validator) {
+		defer remote.Close()
+	}
+
+	key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := writeTestRegistry(t, key, []RegistryEntry{
+		{ID: observers[0].ID().String(), Role: "observer"},
+		{ID: observers[1].ID().String(), Role: "observer"},
+		{ID: validator.ID().String(), Role: "validator"},
+	})
+	defer os.Remove(path)
+
+	registryOpts := testRegistryOptions(t, key, path)
+	registryOpts.RoleLimits["observer"] = 1
+	registry, err := LoadPeerRegistry(registryOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := newTestHost(t)
+	defer h.Close()
+
+	cm := NewConnectionManager(h, &testLocalRPC{chainID: 1}, options.NewPeerConnectionOptions(), options.NewIsolationOptions(), options.NewPeerRPCServiceOptions(), nil, registry, &testLIBProvider{height: 1}, nil, nil, nil, false, make(chan PeerError), make(chan GossipVote), make(chan peer.ID))
+	h.Network().Notify(cm)
+	cm.Start(ctx)
+
+	hostAddr := peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()}
+	if err := observers[0].Connect(ctx, hostAddr); err != nil {
+		t.Fatal(err)
+	}
+	waitForConnectedPeers(ctx, t, cm, 1)
+
+	// The second observer is over its role's limit
+	if err := observers[1].Connect(ctx, hostAddr); err != nil {
+		t.Fatal(err)
+	}
+	for h.Network().Connectedness(observers[1].ID()) == network.Connected {
+		select {
+		case <-time.After(time.Millisecond * 10):
+		case <-ctx.Done():
+			t.Fatal("Expected the connection over the observer limit to be closed")
+		}
+	}
+
+	// Roles without a limit are not affected
+	if err := validator.Connect(ctx, hostAddr); err != nil {
+		t.Fatal(err)
+	}
+
+	connected := make(map[peer.ID]bool)
+	for _, p := range waitForConnectedPeers(ctx, t, cm, 2) {
+		connected[p.ID] = true
+	}
+
+	if !connected[observers[0].ID()] || !connected[validator.ID()] || connected[observers[1].ID()] {
+		t.Errorf("Expected one observer and the validator to be connected, was %v", connected)
+	}
+}
+
+func TestWhitelist(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	allowed := newTestHost(t)
+	defer allowed.Close()
+
+	initial := newTestHost(t)
+	defer initial.Close()
+
+	other := newTestHost(t)
+	defer other.Close()
+
+	whitelistOpts := options.NewWhitelistOptions()
+	whitelistOpts.Peers = []string{allowed.ID().String()}
+	whitelist := NewWhitelist(whitelistOpts)
+	initialPeers := []string{fmt.Sprintf("%s/p2p/%s", initial.Addrs()[0], initial.ID())}
+
+	errorHandler := NewPeerErrorHandler(make(chan peer.ID), make(chan PeerError), make(chan peer.ID), nil, nil, whitelist, *options.NewPeerErrorHandlerOptions())
+	errorHandler.Start(ctx)
+
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"), libp2p.ConnectionGater(errorHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	cm := newTestConnectionManagerWithOptions(t, h, &testLocalRPC{chainID: 1}, options.NewPeerConnectionOptions(), options.NewIsolationOptions(), options.NewPeerRPCServiceOptions(), whitelist, initialPeers, false)
+	h.Network().Notify(cm)
+	cm.Start(ctx)
+
+	// The initial peer is implicitly whitelisted
+	waitForConnectedPeers(ctx, t, cm, 1)
+
+	hostAddr := peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()}
+	if err := allowed.Connect(ctx, hostAddr); err != nil {
+		t.Fatal(err)
+	}
+
+	// The gater rejects the connection before it is reported to the connection manager
+	other.Connect(ctx, hostAddr)
+	if h.Network().Connectedness(other.ID()) == network.Connected {
+		t.Error("Expected the connection from a peer that is not whitelisted to be rejected")
+	}
+
+	connected := make(map[peer.ID]bool)
+	for _, p := range waitForConnectedPeers(ctx, t, cm, 2) {
+		connected[p.ID] = true
+	}
+
+	if !connected[allowed.ID()] || !connected[initial.ID()] || connected[other.ID()] {
+		t.Errorf("Expected only the whitelisted and initial peers to be connected, was %v", connected)
+	}
+
+	if err := h.Connect(ctx, peer.AddrInfo{ID: other.ID(), Addrs: other.Addrs()}); err == nil {
+		t.Error("Expected the dial to a peer that is not whitelisted to be rejected")
+	}
+}
+
+func TestMaxReconnects(t *testing.T) {
+	h := newTestHost(t)
+	defer h.Close()
+
+	// Accept connections but never complete the libp2p handshake, recording when each was opened.
+	// Each attempt holds its slot until the dial times out, so attempts beyond the limit would be
+	// opened in the same burst as the others.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	var mutex sync.Mutex
+	var accepted []time.Time
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			mutex.Lock()
+			accepted = append(accepted, time.Now())
+			mutex.Unlock()
+
+			go func() {
+				_, _ = ioutil.ReadAll(conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	stalledAddr, err := manet.FromNetAddr(listener.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := options.NewPeerConnectionOptions()
+	opts.DialTimeout = time.Millisecond * 100
+	opts.ReconnectBackoff = time.Millisecond * 10
+	opts.ReconnectMaxBackoff = time.Millisecond * 10
+	opts.MaxReconnects = 2
+
+	// Many initial peers drop at once, all reachable only at the stalled address
+	_, ids := randomPeerAddresses(t, 10)
+	initialPeers := make([]string, 0, len(ids))
+	for _, id := range ids {
+		initialPeers = append(initialPeers, fmt.Sprintf("%s/p2p/%s", stalledAddr, id))
+	}
+	cm := newTestConnectionManager(t, h, opts, initialPeers)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	cm.startReconnects(ctx)
+	baseGoroutines := runtime.NumGoroutine()
+
+	for _, id := range ids {
+		cm.queueReconnect(ctx, peer.AddrInfo{ID: id, Addrs: []multiaddr.Multiaddr{stalledAddr}})
+		cm.queueReconnect(ctx, peer.AddrInfo{ID: id, Addrs: []multiaddr.Multiaddr{stalledAddr}})
+	}
+
+	// Queued reconnects do not each hold a goroutine, only the dials of the workers do
+	time.Sleep(opts.DialTimeout / 2)
+	if goroutines := runtime.NumGoroutine(); goroutines > baseGoroutines+len(ids) {
+		t.Errorf("Expected queued reconnects not to start a goroutine each, %v goroutines were started", goroutines-baseGoroutines)
+	}
+
+	<-ctx.Done()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(accepted) == 0 {
+		t.Fatal("Expected reconnect attempts to be made")
+	}
+	for i := opts.MaxReconnects; i < len(accepted); i++ {
+		if gap := accepted[i].Sub(accepted[i-opts.MaxReconnects]); gap < opts.DialTimeout/2 {
+			t.Errorf("Expected at most %v concurrent reconnect attempts, %v were opened within %s", opts.MaxReconnects, opts.MaxReconnects+1, gap)
+			break
+		}
+	}
+}
+
+func TestDisconnectPendingReconnect(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	h := newTestHost(t)
+	defer h.Close()
+
+	remote := newTestHost(t)
+	defer remote.Close()
+
+	// Accept connections but never complete the libp2p handshake, so dials to it last until they time out
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				_, _ = ioutil.ReadAll(conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	stalledAddr, err := manet.FromNetAddr(listener.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stalledID, err := test.RandPeerID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := options.NewPeerConnectionOptions()
+	opts.DialTimeout = time.Millisecond * 500
+	opts.MaxReconnects = 1
+	initialPeers := []string{
+		fmt.Sprintf("%s/p2p/%s", remote.Addrs()[0], remote.ID()),
+		fmt.Sprintf("%s/p2p/%s", stalledAddr, stalledID),
+	}
+	cm := newTestConnectionManager(t, h, opts, initialPeers)
+	h.Network().Notify(cm)
+	cm.Start(ctx)
+
+	waitForConnectedPeers(ctx, t, cm, 1)
+
+	// The only reconnect worker is busy dialing the stalled peer while the reconnect to the remote is pending
+	cm.queueReconnect(ctx, peer.AddrInfo{ID: stalledID, Addrs: []multiaddr.Multiaddr{stalledAddr}})
+	time.Sleep(time.Millisecond * 50)
+	cm.queueReconnect(ctx, peer.AddrInfo{ID: remote.ID(), Addrs: remote.Addrs()})
+
+	if err := cm.DisconnectPeer(ctx, remote.ID()); err != nil {
+		t.Fatal(err)
+	}
+	waitForConnectedPeers(ctx, t, cm, 0)
+
+	// Once the worker is free, the disconnected peer is not dialed
+	time.Sleep(opts.DialTimeout * 2)
+	if h.Network().Connectedness(remote.ID()) == network.Connected {
+		t.Error("Expected the disconnected initial peer not to be reconnected")
+	}
+}
+
+func TestInitialPeerOrder(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	h := newTestHost(t)
+	defer h.Close()
+
+	var dialed []peer.ID
+	var dialedMutex sync.Mutex
+	h.Network().Notify(&network.NotifyBundle{
+		ConnectedF: func(_ network.Network, conn network.Conn) {
+			dialedMutex.Lock()
+			defer dialedMutex.Unlock()
+			dialed = append(dialed, conn.RemotePeer())
+		},
+	})
+
+	const numPeers = 5
+	initialPeers := make([]string, 0, numPeers)
+	expected := make([]peer.ID, 0, numPeers)
+	for i := 0; i < numPeers; i++ {
+		remote := newTestHost(t)
+		defer remote.Close()
+
+		initialPeers = append(initialPeers, fmt.Sprintf("%s/p2p/%s", remote.Addrs()[0], remote.ID()))
+		expected = append(expected, remote.ID())
+	}
+
+	opts := options.NewPeerConnectionOptions()
+	opts.InitialConnectBackoff = time.Millisecond * 10
+	cm := newTestConnectionManager(t, h, opts, initialPeers)
+	cm.connectInitialPeers(ctx)
+
+	dialedMutex.Lock()
+	defer dialedMutex.Unlock()
+
+	if len(dialed) != numPeers {
+		t.Fatalf("Expected %v peers to be dialed, was %v", numPeers, len(dialed))
+	}
+	for i := range expected {
+		if dialed[i] != expected[i] {
+			t.Errorf("Expected peer %v to be dialed in position %v, was %v", expected[i], i, dialed[i])
+		}
+	}
+}
+
+func TestHasServedBlocks(t *testing.T) {
+	h := newTestHost(t)
+	defer h.Close()
+
+	cm := newTestConnectionManager(t, h, options.NewPeerConnectionOptions(), []string{})
+
+	// The local LIB is at height 1
+	heads := map[peer.ID]uint64{"behind": 1, "ahead": 5, "unknown": 0}
+	for id, height := range heads {
+		peerConn := cm.newPeerConnection(id)
+		if height > 0 {
+			peerConn.head.Store(PeerHead{ID: testBlockID(height), Height: height})
+		}
+		cm.connectedPeers[id] = &peerConnectionContext{peer: peerConn, cancel: func() {}}
+	}
+
+	if !cm.handleHasServedBlocks("behind") {
+		t.Error("Expected a peer behind the local node not to be treated as a leecher")
+	}
+	if cm.handleHasServedBlocks("ahead") {
+		t.Error("Expected a peer ahead of the local node that has not served blocks to be treated as a leecher")
+	}
+	if cm.handleHasServedBlocks("unknown") {
+		t.Error("Expected a peer that has not reported its head to be treated as a leecher")
+	}
+}
+
+func TestReportPeerError(t *testing.T) {
+	h := newTestHost(t)
+	defer h.Close()
+
+	cm := newTestConnectionManager(t, h, options.NewPeerConnectionOptions(), []string{})
+	peerErrorChan := make(chan PeerError, 1)
+	cm.peerErrorChan = peerErrorChan
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	cm.reportPeerError(ctx, "peerA", p2perrors.ErrRateLimited)
+	if peerErr := <-peerErrorChan; peerErr.id != "peerA" || !errors.Is(peerErr.err, p2perrors.ErrRateLimited) {
+		t.Errorf("Expected the reported error to be queued, was %v", peerErr)
+	}
+
+	// Once the queue is full, a report gives up when the request is cancelled instead of leaving a goroutine behind
+	peerErrorChan <- PeerError{}
+	before := runtime.NumGoroutine()
+	cm.reportPeerError(ctx, "peerA", p2perrors.ErrRateLimited)
+	if ctx.Err() == nil {
+		t.Error("Expected the report to wait for the request to be cancelled")
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("Expected no goroutines to be left behind, %v were started", after-before)
+	}
+}
+
+func TestRestartStalledPeers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	h := newTestHost(t)
+	defer h.Close()
+
+	peerOpts := options.NewPeerConnectionOptions()
+	peerOpts.StallTimeout = time.Millisecond * 100
+	peerOpts.BlockRequestTimeout = time.Minute
+	peerOpts.MaxBlockRequestTimeout = time.Minute
+
+	cm := newTestConnectionManager(t, h, peerOpts, []string{})
+
+	// The peer's block request never returns, wedging the connection after the handshake
+	remoteRPC := &testRemoteRPC{chainID: 1, headHeight: 10, blocksDelay: time.Hour}
+	wedged := newTestPeerConnection(&testLocalRPC{chainID: 1}, remoteRPC, make(chan PeerError, 1), make(chan GossipVote, 1), peerOpts)
+
+	wedgedCtx, wedgedCancel := context.WithCancel(ctx)
+	wedged.Start(wedgedCtx)
+	cm.connectedPeers[wedged.id] = &peerConnectionContext{peer: wedged, ctx: wedgedCtx, cancel: wedgedCancel}
+
+	for remoteRPC.numBlocksCalls() == 0 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for the block request")
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+
+	cm.restartStalledPeers(ctx)
+	if cm.connectedPeers[wedged.id].peer != wedged {
+		t.Fatal("Expected an active peer connection not to be restarted")
+	}
+
+	time.Sleep(peerOpts.StallTimeout)
+
+	cm.restartStalledPeers(ctx)
+	restarted := cm.connectedPeers[wedged.id].peer
+	if restarted == wedged {
+		t.Fatal("Expected the stalled peer connection to be restarted")
+	}
+	if restarted.LastActivity().IsZero() {
+		t.Error("Expected the restarted peer connection to be started")
+	}
+
+	select {
+	case <-wedgedCtx.Done():
+	default:
+		t.Error("Expected the stalled peer connection to be cancelled")
+	}
+
+	// A connection that was never started, as on a standby node, is not stalled
+	cm.connectedPeers["idle"] = &peerConnectionContext{peer: cm.newPeerConnection("idle"), ctx: ctx, cancel: func() {}}
+	cm.restartStalledPeers(ctx)
+	if !cm.connectedPeers["idle"].peer.LastActivity().IsZero() {
+		t.Error("Expected an unstarted peer connection not to be restarted")
+	}
+}
@@ -3,10 +3,12 @@ package p2p
 import (
 	"context"
 	"errors"
+	"fmt"
 	"math"
 	"time"
 
 	log "github.com/koinos/koinos-log-golang"
+	"github.com/koinos/koinos-p2p/internal/metrics"
 	"github.com/koinos/koinos-p2p/internal/options"
 	"github.com/koinos/koinos-p2p/internal/p2perrors"
 	"github.com/libp2p/go-libp2p-core/control"
@@ -24,6 +26,9 @@ type PeerError struct {
 type errorScoreRecord struct {
 	lastUpdate time.Time
 	score      uint64
+
+	rewardWindowStart time.Time
+	windowReward      uint64
 }
 
 type canConnectRequest struct {
@@ -31,13 +36,30 @@ type canConnectRequest struct {
 	resultChan chan<- bool
 }
 
+type banRequest struct {
+	id       peer.ID
+	duration time.Duration
+}
+
+type errorScoreRequest struct {
+	id         peer.ID
+	resultChan chan<- uint64
+}
+
 // PeerErrorHandler handles PeerErrors and tracks errors over time
 // to determine if a peer should be disconnected from
 type PeerErrorHandler struct {
 	errorScores        map[peer.ID]*errorScoreRecord
+	bans               map[peer.ID]time.Time
 	disconnectPeerChan chan<- peer.ID
 	peerErrorChan      <-chan PeerError
+	peerRewardChan     <-chan peer.ID
 	canConnectChan     chan canConnectRequest
+	errorScoreChan     chan errorScoreRequest
+	banChan            chan banRequest
+	metrics            *metrics.Collector
+	registry           *PeerRegistry
+	whitelist          *Whitelist
 
 	opts options.PeerErrorHandlerOptions
 }
@@ -59,6 +81,13 @@ func (p *PeerErrorHandler) CanConnect(ctx context.Context, id peer.ID) bool {
 }
 
 func (p *PeerErrorHandler) handleCanConnect(id peer.ID) bool {
+	if until, ok := p.bans[id]; ok {
+		if time.Now().Before(until) {
+			return false
+		}
+		delete(p.bans, id)
+	}
+
 	if record, ok := p.errorScores[id]; ok {
 		p.decayErrorScore(record)
 		return record.score < p.opts.ErrorScoreThreshold
@@ -67,6 +96,49 @@ func (p *PeerErrorHandler) handleCanConnect(id peer.ID) bool {
 	return true
 }
 
+// Ban prevents connections to and from the peer for the given duration, regardless of its error score.
+// Returns an error if the ban could not be recorded before ctx was done.
+func (p *PeerErrorHandler) Ban(ctx context.Context, id peer.ID, duration time.Duration) error {
+	select {
+	case p.banChan <- banRequest{id: id, duration: duration}:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("could not ban peer %s: %w", id, ctx.Err())
+	}
+}
+
+func (p *PeerErrorHandler) handleBan(req banRequest) {
+	log.Infof("Banning peer %s for %s", req.id, req.duration)
+	p.bans[req.id] = time.Now().Add(req.duration)
+}
+
+// GetErrorScore returns the peer's current error score, after decay
+func (p *PeerErrorHandler) GetErrorScore(ctx context.Context, id peer.ID) uint64 {
+	resultChan := make(chan uint64, 1)
+
+	select {
+	case p.errorScoreChan <- errorScoreRequest{id: id, resultChan: resultChan}:
+	case <-ctx.Done():
+		return 0
+	}
+
+	select {
+	case res := <-resultChan:
+		return res
+	case <-ctx.Done():
+		return 0
+	}
+}
+
+func (p *PeerErrorHandler) handleGetErrorScore(id peer.ID) uint64 {
+	if record, ok := p.errorScores[id]; ok {
+		p.decayErrorScore(record)
+		return record.score
+	}
+
+	return 0
+}
+
 func (p *PeerErrorHandler) handleError(ctx context.Context, peerErr PeerError) {
 	if record, ok := p.errorScores[peerErr.id]; ok {
 		p.decayErrorScore(record)
@@ -79,6 +151,7 @@ func (p *PeerErrorHandler) handleError(ctx context.Context, peerErr PeerError) {
 	}
 
 	log.Infof("Encountered peer error: %s, %s. Current error score: %v", peerErr.id, peerErr.err.Error(), p.errorScores[peerErr.id].score)
+	p.metrics.RecordPeerError(errorReason(peerErr.err))
 
 	if p.errorScores[peerErr.id].score >= p.opts.ErrorScoreThreshold {
 		go func() {
@@ -90,6 +163,35 @@ func (p *PeerErrorHandler) handleError(ctx context.Context, peerErr PeerError) {
 	}
 }
 
+func (p *PeerErrorHandler) handleReward(id peer.ID) {
+	record, ok := p.errorScores[id]
+	if !ok {
+		return
+	}
+
+	p.decayErrorScore(record)
+
+	now := time.Now()
+	if now.Sub(record.rewardWindowStart) >= p.opts.TransactionRewardWindow {
+		record.rewardWindowStart = now
+		record.windowReward = 0
+	}
+
+	reward := p.opts.TransactionAcceptedReward
+	if record.windowReward >= p.opts.MaxTransactionRewardPerWindow {
+		return
+	} else if remaining := p.opts.MaxTransactionRewardPerWindow - record.windowReward; reward > remaining {
+		reward = remaining
+	}
+	record.windowReward += reward
+
+	if record.score > reward {
+		record.score -= reward
+	} else {
+		record.score = 0
+	}
+}
+
 func (p *PeerErrorHandler) getScoreForError(err error) uint64 {
 	// These should be ordered from most common error to least
 	switch {
@@ -99,14 +201,38 @@ func (p *PeerErrorHandler) getScoreForError(err error) uint64 {
 		return p.opts.TransactionApplicationErrorScore
 	case errors.Is(err, p2perrors.ErrBlockApplication):
 		return p.opts.BlockApplicationErrorScore
+	case errors.Is(err, p2perrors.ErrBlockMismatch):
+		return p.opts.BlockMismatchErrorScore
+	case errors.Is(err, p2perrors.ErrBlockTooLarge):
+		return p.opts.BlockTooLargeErrorScore
 	case errors.Is(err, p2perrors.ErrDeserialization):
 		return p.opts.DeserializationErrorScore
+	case errors.Is(err, p2perrors.ErrMessageTooLarge):
+		return p.opts.MessageTooLargeErrorScore
 	case errors.Is(err, p2perrors.ErrBlockIrreversibility):
 		return p.opts.BlockIrreversibilityErrorScore
 	case errors.Is(err, p2perrors.ErrPeerRPC):
 		return p.opts.PeerRPCErrorScore
 	case errors.Is(err, p2perrors.ErrPeerRPCTimeout):
 		return p.opts.PeerRPCTimeoutErrorScore
+	case errors.Is(err, p2perrors.ErrRateLimited):
+		return p.opts.RateLimitedErrorScore
+	case errors.Is(err, p2perrors.ErrMalformedRequest):
+		return p.opts.MalformedRequestErrorScore
+	case errors.Is(err, p2perrors.ErrPeerNotReady):
+		return p.opts.PeerNotReadyErrorScore
+	case errors.Is(err, p2perrors.ErrHeightNotServable):
+		return p.opts.HeightNotServableErrorScore
+	case errors.Is(err, p2perrors.ErrReciprocityRefused):
+		return p.opts.ReciprocityRefusedErrorScore
+	case errors.Is(err, p2perrors.ErrUnexpectedBlockCount):
+		return p.opts.PeerRPCErrorScore
+	case errors.Is(err, p2perrors.ErrClockSkew):
+		return p.opts.ClockSkewErrorScore
+	case errors.Is(err, p2perrors.ErrHeadRegression):
+		return p.opts.HeadRegressionErrorScore
+	case errors.Is(err, p2perrors.ErrSlowPeer):
+		return p.opts.SlowPeerErrorScore
 
 	// These errors are expected, but result in instant disconnection
 	case errors.Is(err, p2perrors.ErrChainIDMismatch):
@@ -131,6 +257,51 @@ func (p *PeerErrorHandler) getScoreForError(err error) uint64 {
 	}
 }
 
+// otherErrorReason labels errors that do not wrap a p2perrors sentinel
+const otherErrorReason = "other"
+
+// errorReasons are the p2perrors sentinels peer errors are labelled with in metrics
+var errorReasons = []error{
+	p2perrors.ErrDeserialization,
+	p2perrors.ErrMessageTooLarge,
+	p2perrors.ErrSerialization,
+	p2perrors.ErrBlockIrreversibility,
+	p2perrors.ErrBlockApplication,
+	p2perrors.ErrTransactionApplication,
+	p2perrors.ErrChainIDMismatch,
+	p2perrors.ErrChainNotConnected,
+	p2perrors.ErrCheckpointMismatch,
+	p2perrors.ErrLocalRPC,
+	p2perrors.ErrPeerRPC,
+	p2perrors.ErrLocalRPCTimeout,
+	p2perrors.ErrPeerRPCTimeout,
+	p2perrors.ErrUnexpectedBlockCount,
+	p2perrors.ErrBlockTooLarge,
+	p2perrors.ErrBlockMismatch,
+	p2perrors.ErrClockSkew,
+	p2perrors.ErrHeadRegression,
+	p2perrors.ErrSlowPeer,
+	p2perrors.ErrPeerNotReady,
+	p2perrors.ErrRateLimited,
+	p2perrors.ErrReciprocityRefused,
+	p2perrors.ErrMalformedRequest,
+	p2perrors.ErrHeightNotServable,
+	p2perrors.ErrPeerNotConnected,
+	p2perrors.ErrProcessRequestTimeout,
+}
+
+// errorReason returns the message of the p2perrors sentinel the error wraps, or otherErrorReason, so the
+// metric labels are bounded
+func errorReason(err error) string {
+	for _, reason := range errorReasons {
+		if errors.Is(err, reason) {
+			return reason.Error()
+		}
+	}
+
+	return otherErrorReason
+}
+
 func (p *PeerErrorHandler) decayErrorScore(record *errorScoreRecord) {
 	decayConstant := math.Log(2) / float64(p.opts.ErrorScoreDecayHalflife)
 	now := time.Now()
@@ -138,9 +309,29 @@ func (p *PeerErrorHandler) decayErrorScore(record *errorScoreRecord) {
 	record.lastUpdate = now
 }
 
+// isRegistered returns true if the peer may connect according to the peer registry
+func (p *PeerErrorHandler) isRegistered(pid peer.ID) bool {
+	if p.registry.IsRegistered(pid) {
+		return true
+	}
+
+	log.Debugf("Rejecting connection with unregistered peer %s", pid)
+	return false
+}
+
+// isWhitelisted returns true if the peer may connect according to the whitelist
+func (p *PeerErrorHandler) isWhitelisted(pid peer.ID) bool {
+	if p.whitelist.IsAllowed(pid) {
+		return true
+	}
+
+	log.Debugf("Rejecting connection with peer %s, the peer is not whitelisted", pid)
+	return false
+}
+
 // InterceptPeerDial implements the libp2p ConnectionGater interface
 func (p *PeerErrorHandler) InterceptPeerDial(pid peer.ID) bool {
-	return p.CanConnect(context.Background(), pid)
+	return p.isRegistered(pid) && p.CanConnect(context.Background(), pid)
 }
 
 // InterceptAddrDial implements the libp2p ConnectionGater interface
@@ -153,9 +344,10 @@ func (p *PeerErrorHandler) InterceptAccept(network.ConnMultiaddrs) bool {
 	return true
 }
 
-// InterceptSecured implements the libp2p ConnectionGater interface
+// InterceptSecured implements the libp2p ConnectionGater interface. The whitelist is enforced here rather
+// than when dialing, as initial peers without a known ID are identified by dialing a placeholder ID.
 func (p *PeerErrorHandler) InterceptSecured(_ network.Direction, pid peer.ID, _ network.ConnMultiaddrs) bool {
-	return p.CanConnect(context.Background(), pid)
+	return p.isRegistered(pid) && p.isWhitelisted(pid) && p.CanConnect(context.Background(), pid)
 }
 
 // InterceptUpgraded implements the libp2p ConnectionGater interface
@@ -170,8 +362,14 @@ func (p *PeerErrorHandler) Start(ctx context.Context) {
 			select {
 			case perr := <-p.peerErrorChan:
 				p.handleError(ctx, perr)
+			case id := <-p.peerRewardChan:
+				p.handleReward(id)
 			case req := <-p.canConnectChan:
 				req.resultChan <- p.handleCanConnect(req.id)
+			case req := <-p.errorScoreChan:
+				req.resultChan <- p.handleGetErrorScore(req.id)
+			case req := <-p.banChan:
+				p.handleBan(req)
 
 			case <-ctx.Done():
 				return
@@ -180,13 +378,21 @@ func (p *PeerErrorHandler) Start(ctx context.Context) {
 	}()
 }
 
-// NewPeerErrorHandler creates a new PeerErrorHandler
-func NewPeerErrorHandler(disconnectPeerChan chan<- peer.ID, peerErrorChan <-chan PeerError, opts options.PeerErrorHandlerOptions) *PeerErrorHandler {
+// NewPeerErrorHandler creates a new PeerErrorHandler. If registry or whitelist is not nil, connections
+// with peers missing from them are rejected.
+func NewPeerErrorHandler(disconnectPeerChan chan<- peer.ID, peerErrorChan <-chan PeerError, peerRewardChan <-chan peer.ID, metrics *metrics.Collector, registry *PeerRegistry, whitelist *Whitelist, opts options.PeerErrorHandlerOptions) *PeerErrorHandler {
 	return &PeerErrorHandler{
 		errorScores:        make(map[peer.ID]*errorScoreRecord),
+		bans:               make(map[peer.ID]time.Time),
 		disconnectPeerChan: disconnectPeerChan,
 		peerErrorChan:      peerErrorChan,
+		peerRewardChan:     peerRewardChan,
 		canConnectChan:     make(chan canConnectRequest),
+		errorScoreChan:     make(chan errorScoreRequest),
+		banChan:            make(chan banRequest),
+		metrics:            metrics,
+		registry:           registry,
+		whitelist:          whitelist,
 		opts:               opts,
 	}
 }
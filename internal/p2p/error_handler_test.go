@@ -2,9 +2,11 @@ package p2p
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/koinos/koinos-p2p/internal/metrics"
 	"github.com/koinos/koinos-p2p/internal/options"
 	"github.com/koinos/koinos-p2p/internal/p2perrors"
 	"github.com/libp2p/go-libp2p-core/peer"
@@ -20,7 +22,7 @@ func TestErrorHandler(t *testing.T) {
 	opts.ErrorScoreThreshold = 100
 	opts.ErrorScoreDecayHalflife = time.Second * 2
 
-	errorHandler := NewPeerErrorHandler(disconnectPeerChan, peerErrorChan, *opts)
+	errorHandler := NewPeerErrorHandler(disconnectPeerChan, peerErrorChan, make(chan peer.ID), nil, nil, nil, *opts)
 	errorHandler.Start(ctx)
 
 	for i := 0; i < 12; i++ {
@@ -71,3 +73,186 @@ func TestErrorHandler(t *testing.T) {
 		t.Errorf("Expected failed connection to peerA")
 	}
 }
+
+func TestErrorHandlerMetrics(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	peerErrorChan := make(chan PeerError)
+	collector := metrics.NewCollector()
+
+	errorHandler := NewPeerErrorHandler(make(chan peer.ID, 1), peerErrorChan, make(chan peer.ID), collector, nil, nil, *options.NewPeerErrorHandlerOptions())
+	errorHandler.Start(ctx)
+
+	peerErrorChan <- PeerError{id: "peerA", err: fmt.Errorf("%w, %v", p2perrors.ErrPeerRPC, "connection reset")}
+	peerErrorChan <- PeerError{id: "peerB", err: p2perrors.ErrPeerRPC}
+	peerErrorChan <- PeerError{id: "peerC", err: fmt.Errorf("failed to dial %s at height %v", "peerC", 10)}
+
+	// Wait for the errors to be handled
+	errorHandler.CanConnect(ctx, "peerA")
+
+	families, err := collector.Registry().Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != "koinos_p2p_peer_errors_total" {
+			continue
+		}
+
+		counts := make(map[string]float64)
+		for _, m := range family.GetMetric() {
+			counts[m.GetLabel()[0].GetValue()] = m.GetCounter().GetValue()
+		}
+
+		// Errors are recorded by sentinel, and errors without one share a single label
+		expected := map[string]float64{p2perrors.ErrPeerRPC.Error(): 2, otherErrorReason: 1}
+		if len(counts) != len(expected) || counts[p2perrors.ErrPeerRPC.Error()] != 2 || counts[otherErrorReason] != 1 {
+			t.Errorf("Incorrect peer error counts. Expected %v, was %v", expected, counts)
+		}
+		return
+	}
+
+	t.Error("Expected peer errors to be recorded")
+}
+
+func TestErrorHandlerScore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	peerErrorChan := make(chan PeerError)
+	opts := options.NewPeerErrorHandlerOptions()
+	opts.PeerRPCTimeoutErrorScore = 100
+	opts.BlockApplicationErrorScore = 1000
+	opts.ErrorScoreDecayHalflife = time.Millisecond * 200
+
+	errorHandler := NewPeerErrorHandler(make(chan peer.ID, 1), peerErrorChan, make(chan peer.ID), nil, nil, nil, *opts)
+	errorHandler.Start(ctx)
+
+	if score := errorHandler.GetErrorScore(ctx, "peerA"); score != 0 {
+		t.Errorf("Expected no error score for an unknown peer, was %v", score)
+	}
+
+	peerErrorChan <- PeerError{id: "peerA", err: p2perrors.ErrPeerRPCTimeout}
+	peerErrorChan <- PeerError{id: "peerA", err: p2perrors.ErrBlockApplication}
+
+	// Each error is weighted by its type
+	score := errorHandler.GetErrorScore(ctx, "peerA")
+	if score > 1100 || score < 1000 {
+		t.Errorf("Expected an error score just under 1100, was %v", score)
+	}
+
+	time.Sleep(opts.ErrorScoreDecayHalflife)
+
+	if decayed := errorHandler.GetErrorScore(ctx, "peerA"); decayed > score/2+10 {
+		t.Errorf("Expected the error score to decay by half from %v, was %v", score, decayed)
+	}
+}
+
+func TestErrorHandlerReward(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	peerErrorChan := make(chan PeerError)
+	peerRewardChan := make(chan peer.ID)
+	opts := options.NewPeerErrorHandlerOptions()
+	opts.TransactionApplicationErrorScore = 1000
+	opts.TransactionAcceptedReward = 300
+	opts.ErrorScoreDecayHalflife = time.Hour
+
+	errorHandler := NewPeerErrorHandler(make(chan peer.ID, 1), peerErrorChan, peerRewardChan, nil, nil, nil, *opts)
+	errorHandler.Start(ctx)
+
+	// Rewarding a peer without errors has no effect
+	peerRewardChan <- "peerA"
+	if score := errorHandler.GetErrorScore(ctx, "peerA"); score != 0 {
+		t.Errorf("Expected no error score for peerA, was %v", score)
+	}
+
+	peerErrorChan <- PeerError{id: "peerA", err: p2perrors.ErrTransactionApplication}
+	peerRewardChan <- "peerA"
+
+	if score := errorHandler.GetErrorScore(ctx, "peerA"); score > 700 || score < 690 {
+		t.Errorf("Expected an error score just under 700, was %v", score)
+	}
+
+	for i := 0; i < 3; i++ {
+		peerRewardChan <- "peerA"
+	}
+
+	if score := errorHandler.GetErrorScore(ctx, "peerA"); score != 0 {
+		t.Errorf("Expected rewards to reduce the error score to 0, was %v", score)
+	}
+}
+
+func TestErrorHandlerRewardCap(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	peerErrorChan := make(chan PeerError)
+	peerRewardChan := make(chan peer.ID)
+	opts := options.NewPeerErrorHandlerOptions()
+	opts.BlockApplicationErrorScore = 5000
+	opts.TransactionAcceptedReward = 100
+	opts.MaxTransactionRewardPerWindow = 1000
+	opts.TransactionRewardWindow = time.Millisecond * 200
+	opts.ErrorScoreDecayHalflife = time.Hour
+
+	errorHandler := NewPeerErrorHandler(make(chan peer.ID, 1), peerErrorChan, peerRewardChan, nil, nil, nil, *opts)
+	errorHandler.Start(ctx)
+
+	// A peer gossiping a flood of cheap transactions after a bad block can only erase the capped reward
+	peerErrorChan <- PeerError{id: "peerA", err: p2perrors.ErrBlockApplication}
+	for i := 0; i < 100; i++ {
+		peerRewardChan <- "peerA"
+	}
+
+	// Each update truncates the decayed score, so allow for a little more than the cap
+	if score := errorHandler.GetErrorScore(ctx, "peerA"); score > 4000 || score < 3800 {
+		t.Errorf("Expected rewards to be capped at 1000 per window, error score was %v", score)
+	}
+
+	// The cap resets in the next window
+	time.Sleep(opts.TransactionRewardWindow)
+	for i := 0; i < 100; i++ {
+		peerRewardChan <- "peerA"
+	}
+
+	if score := errorHandler.GetErrorScore(ctx, "peerA"); score > 3000 || score < 2600 {
+		t.Errorf("Expected a second window of rewards to reduce the error score by another 1000, was %v", score)
+	}
+}
+
+func TestErrorHandlerBan(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errorHandler := NewPeerErrorHandler(make(chan peer.ID), make(chan PeerError), make(chan peer.ID), nil, nil, nil, *options.NewPeerErrorHandlerOptions())
+	errorHandler.Start(ctx)
+
+	if err := errorHandler.Ban(ctx, "peerA", time.Millisecond*100); err != nil {
+		t.Fatal(err)
+	}
+
+	if errorHandler.CanConnect(ctx, "peerA") {
+		t.Error("Expected banned peer not to be able to connect")
+	}
+	if !errorHandler.CanConnect(ctx, "peerB") {
+		t.Error("Expected peer that was not banned to be able to connect")
+	}
+
+	time.Sleep(time.Millisecond * 150)
+
+	if !errorHandler.CanConnect(ctx, "peerA") {
+		t.Error("Expected peer to be able to connect once its ban expired")
+	}
+
+	// A ban that can not be recorded before the context is done is reported
+	stopped := NewPeerErrorHandler(make(chan peer.ID), make(chan PeerError), make(chan peer.ID), nil, nil, nil, *options.NewPeerErrorHandlerOptions())
+	timeoutCtx, timeoutCancel := context.WithTimeout(ctx, time.Millisecond*50)
+	defer timeoutCancel()
+	if err := stopped.Ban(timeoutCtx, "peerA", time.Minute); err == nil {
+		t.Error("Expected an error when the ban could not be recorded")
+	}
+}
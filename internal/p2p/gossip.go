@@ -5,8 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 
 	log "github.com/koinos/koinos-log-golang"
+	"github.com/koinos/koinos-p2p/internal/options"
 	"github.com/koinos/koinos-p2p/internal/p2perrors"
 	"github.com/koinos/koinos-p2p/internal/rpc"
 	"github.com/koinos/koinos-proto-golang/koinos/canonical"
@@ -36,16 +38,22 @@ type GossipManager struct {
 	cancel        context.CancelFunc
 	peerErrorChan chan<- PeerError
 	topicName     string
+	maxSize       int
 	enableMutex   sync.Mutex
 	Enabled       bool
+
+	// suppressed is 1 while publishing is suppressed because the topic has no peers
+	suppressed int32
 }
 
-// NewGossipManager creates and returns a new instance of gossipManager
-func NewGossipManager(ps *pubsub.PubSub, errChan chan<- PeerError, topicName string) *GossipManager {
+// NewGossipManager creates and returns a new instance of gossipManager.
+// Messages on the topic larger than maxSize bytes are rejected.
+func NewGossipManager(ps *pubsub.PubSub, errChan chan<- PeerError, topicName string, maxSize int) *GossipManager {
 	gm := GossipManager{
 		ps:            ps,
 		peerErrorChan: errChan,
 		topicName:     topicName,
+		maxSize:       maxSize,
 		Enabled:       false,
 	}
 
@@ -59,9 +67,24 @@ func NewGossipManager(ps *pubsub.PubSub, errChan chan<- PeerError, topicName str
 	return &gm
 }
 
-// RegisterValidator registers the validate function to be used for messages
-func (gm *GossipManager) RegisterValidator(val interface{}) error {
-	return gm.ps.RegisterTopicValidator(gm.topicName, val)
+// RegisterValidator registers the validate function to be used for messages.
+// Oversized messages are rejected before reaching the validate function.
+func (gm *GossipManager) RegisterValidator(val func(context.Context, peer.ID, *pubsub.Message) bool) error {
+	return gm.ps.RegisterTopicValidator(gm.topicName, func(ctx context.Context, pid peer.ID, msg *pubsub.Message) bool {
+		if len(msg.Data) > gm.maxSize {
+			err := fmt.Errorf("%w, %v byte message on topic %s, limit is %v bytes", p2perrors.ErrMessageTooLarge, len(msg.Data), gm.topicName, gm.maxSize)
+			log.Warnf("Gossiped message rejected from peer %v: %s", msg.ReceivedFrom, err)
+			go func() {
+				select {
+				case gm.peerErrorChan <- PeerError{id: msg.ReceivedFrom, err: err}:
+				case <-ctx.Done():
+				}
+			}()
+			return false
+		}
+
+		return val(ctx, pid, msg)
+	})
 }
 
 // Start starts gossiping on this topic
@@ -105,9 +128,15 @@ func (gm *GossipManager) Stop() {
 	gm.Enabled = false
 }
 
-// PublishMessage publishes the given object to this manager's topic
+// PublishMessage publishes the given object to this manager's topic.
+// Nothing is published while the topic has no peers.
 func (gm *GossipManager) PublishMessage(ctx context.Context, bytes []byte) bool {
-	if !gm.Enabled {
+	if !gm.Enabled || !gm.hasPeers() {
+		return false
+	}
+
+	if len(bytes) > gm.maxSize {
+		log.Warnf("Not publishing %v byte message on topic %s, limit is %v bytes", len(bytes), gm.topicName, gm.maxSize)
 		return false
 	}
 
@@ -117,6 +146,21 @@ func (gm *GossipManager) PublishMessage(ctx context.Context, bytes []byte) bool
 	return true
 }
 
+// hasPeers returns whether the topic has peers to publish to, logging when that changes
+func (gm *GossipManager) hasPeers() bool {
+	if len(gm.topic.ListPeers()) > 0 {
+		if atomic.CompareAndSwapInt32(&gm.suppressed, 1, 0) {
+			log.Infof("Peers joined gossip topic %s, resuming publishing", gm.topicName)
+		}
+		return true
+	}
+
+	if atomic.CompareAndSwapInt32(&gm.suppressed, 0, 1) {
+		log.Infof("No peers on gossip topic %s, suppressing publishing until peers join", gm.topicName)
+	}
+	return false
+}
+
 func (gm *GossipManager) readMessages(ctx context.Context, ch chan<- []byte) {
 	//
 	// The purpose of this function is to move messages from each topic's gm.sub.Next()
@@ -152,6 +196,7 @@ type KoinosGossip struct {
 	transaction      *GossipManager
 	PubSub           *pubsub.PubSub
 	PeerErrorChan    chan<- PeerError
+	PeerRewardChan   chan<- peer.ID
 	myPeerID         peer.ID
 	libProvider      LastIrreversibleBlockProvider
 	transactionCache *TransactionCache
@@ -163,18 +208,21 @@ func NewKoinosGossip(
 	rpc rpc.LocalRPC,
 	ps *pubsub.PubSub,
 	peerErrorChan chan<- PeerError,
+	peerRewardChan chan<- peer.ID,
 	id peer.ID,
 	libProvider LastIrreversibleBlockProvider,
-	cache *TransactionCache) *KoinosGossip {
+	cache *TransactionCache,
+	opts *options.GossipOptions) *KoinosGossip {
 
-	block := NewGossipManager(ps, peerErrorChan, BlockTopicName)
-	transaction := NewGossipManager(ps, peerErrorChan, TransactionTopicName)
+	block := NewGossipManager(ps, peerErrorChan, BlockTopicName, opts.MaxBlockMessageSize)
+	transaction := NewGossipManager(ps, peerErrorChan, TransactionTopicName, opts.MaxTransactionMessageSize)
 	kg := KoinosGossip{
 		rpc:              rpc,
 		block:            block,
 		transaction:      transaction,
 		PubSub:           ps,
 		PeerErrorChan:    peerErrorChan,
+		PeerRewardChan:   peerRewardChan,
 		myPeerID:         id,
 		libProvider:      libProvider,
 		transactionCache: cache,
@@ -217,8 +265,9 @@ func (kg *KoinosGossip) PublishTransaction(ctx context.Context, transaction *pro
 		// Add to the transaction cache
 		kg.transactionCache.CheckTransactions(transaction)
 
-		log.Infof("Publishing transaction - %s", util.TransactionString(transaction))
-		kg.transaction.PublishMessage(context.Background(), binary)
+		if kg.transaction.PublishMessage(context.Background(), binary) {
+			log.Infof("Published transaction - %s", util.TransactionString(transaction))
+		}
 	}
 
 	return nil
@@ -235,8 +284,9 @@ func (kg *KoinosGossip) PublishBlock(ctx context.Context, block *protocol.Block)
 		// Add to the transaction cache
 		kg.transactionCache.CheckBlock(block)
 
-		log.Infof("Publishing transaction - %s", util.BlockString(block))
-		kg.block.PublishMessage(context.Background(), binary)
+		if kg.block.PublishMessage(context.Background(), binary) {
+			log.Infof("Published block - %s", util.BlockString(block))
+		}
 	}
 
 	return nil
@@ -352,8 +402,10 @@ func (kg *KoinosGossip) startTransactionGossip(ctx context.Context) {
 	}()
 }
 
+// validateTransaction rebroadcasts transactions that are accepted, rewarding the peer that sent them when they
+// were newly applied. Rejected transactions are dropped and the peer that sent them is penalized.
 func (kg *KoinosGossip) validateTransaction(ctx context.Context, pid peer.ID, msg *pubsub.Message) bool {
-	err := kg.applyTransaction(ctx, pid, msg)
+	applied, err := kg.applyTransaction(ctx, pid, msg)
 	if err != nil {
 		log.Warnf("Gossiped transaction not applied from peer %v: %s", msg.ReceivedFrom, err)
 		go func() {
@@ -364,35 +416,47 @@ func (kg *KoinosGossip) validateTransaction(ctx context.Context, pid peer.ID, ms
 		}()
 		return false
 	}
+
+	if applied {
+		go func() {
+			select {
+			case kg.PeerRewardChan <- msg.ReceivedFrom:
+			case <-ctx.Done():
+			}
+		}()
+	}
+
 	return true
 }
 
-func (kg *KoinosGossip) applyTransaction(ctx context.Context, pid peer.ID, msg *pubsub.Message) error {
+// applyTransaction applies a gossiped transaction, returning whether it was newly applied.
+// Transactions from this node or already in the cache are accepted without being applied.
+func (kg *KoinosGossip) applyTransaction(ctx context.Context, pid peer.ID, msg *pubsub.Message) (bool, error) {
 	log.Debug("Received transaction via gossip")
 	transaction := &protocol.Transaction{}
 	err := proto.Unmarshal(msg.Data, transaction)
 	if err != nil {
-		return fmt.Errorf("%w, %v", p2perrors.ErrDeserialization, err.Error())
+		return false, fmt.Errorf("%w, %v", p2perrors.ErrDeserialization, err.Error())
 	}
 
 	// If the gossip message is from this node, consider it valid but do not apply it (since it has already been applied)
 	if msg.GetFrom() == kg.myPeerID {
-		return nil
+		return false, nil
 	}
 
 	if transaction.Id == nil {
-		return fmt.Errorf("%w, gossiped transaction missing id", p2perrors.ErrDeserialization)
+		return false, fmt.Errorf("%w, gossiped transaction missing id", p2perrors.ErrDeserialization)
 	}
 
 	if kg.transactionCache.CheckTransactions(transaction) > 0 {
 		log.Debugf("Gossiped transaction already in cache - %s from peer %v", util.TransactionString(transaction), msg.ReceivedFrom)
-		return nil
+		return false, nil
 	}
 
 	if _, err := kg.rpc.ApplyTransaction(ctx, transaction); err != nil {
-		return fmt.Errorf("%w - %s, %v", p2perrors.ErrTransactionApplication, util.TransactionString(transaction), err.Error())
+		return false, fmt.Errorf("%w - %s, %v", p2perrors.ErrTransactionApplication, util.TransactionString(transaction), err.Error())
 	}
 
 	log.Infof("Gossiped transaction applied - %s from peer %v", util.TransactionString(transaction), msg.ReceivedFrom)
-	return nil
+	return true, nil
 }
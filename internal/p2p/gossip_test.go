@@ -0,0 +1,254 @@
+package p2p
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/koinos/koinos-p2p/internal/options"
+	"github.com/koinos/koinos-p2p/internal/p2perrors"
+	"github.com/koinos/koinos-proto-golang/koinos/protocol"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestGossipManager(ctx context.Context, t *testing.T, h host.Host, messageChan chan<- []byte) *GossipManager {
+	ps, err := pubsub.NewGossipSub(ctx, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gm := NewGossipManager(ps, make(chan PeerError), BlockTopicName, options.NewGossipOptions().MaxBlockMessageSize)
+	if err := gm.Start(ctx, messageChan); err != nil {
+		t.Fatal(err)
+	}
+
+	return gm
+}
+
+func TestPublishWithoutPeers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	publisher := newTestHost(t)
+	defer publisher.Close()
+
+	subscriber := newTestHost(t)
+	defer subscriber.Close()
+
+	publisherGM := newTestGossipManager(ctx, t, publisher, make(chan []byte, 1))
+	messageChan := make(chan []byte, 1)
+	newTestGossipManager(ctx, t, subscriber, messageChan)
+
+	message := []byte("block")
+	if publisherGM.PublishMessage(ctx, message) {
+		t.Fatal("Expected publishing without peers to be suppressed")
+	}
+
+	if err := publisher.Connect(ctx, peer.AddrInfo{ID: subscriber.ID(), Addrs: subscriber.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Publishing resumes once the subscriber has joined the topic
+	for {
+		if publisherGM.PublishMessage(ctx, message) {
+			select {
+			case received := <-messageChan:
+				if !bytes.Equal(received, message) {
+					t.Errorf("Incorrect message received. Expected %s, was %s", message, received)
+				}
+				return
+			case <-time.After(time.Millisecond * 100):
+			}
+		}
+
+		select {
+		case <-time.After(time.Millisecond * 10):
+		case <-ctx.Done():
+			t.Fatal("Expected publishing to resume after a peer connected")
+		}
+	}
+}
+
+func newTestTransactionMessage(t *testing.T, from peer.ID, id byte) *pubsub.Message {
+	data, err := proto.Marshal(&protocol.Transaction{Id: []byte{id}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &pubsub.Message{
+		Message:      &pb.Message{Data: data, From: []byte(from)},
+		ReceivedFrom: from,
+	}
+}
+
+func TestValidateTransaction(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	h := newTestHost(t)
+	defer h.Close()
+
+	ps, err := pubsub.NewGossipSub(ctx, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	localRPC := &testLocalRPC{}
+	peerErrorChan := make(chan PeerError, 1)
+	peerRewardChan := make(chan peer.ID, 1)
+	kg := NewKoinosGossip(ctx, localRPC, ps, peerErrorChan, peerRewardChan, h.ID(), &testLIBProvider{}, NewTransactionCache(time.Minute), options.NewGossipOptions())
+
+	var sender peer.ID = "sender"
+
+	// An accepted transaction is rebroadcast and its sender rewarded
+	if !kg.validateTransaction(ctx, sender, newTestTransactionMessage(t, sender, 1)) {
+		t.Error("Expected accepted transaction to be rebroadcast")
+	}
+
+	select {
+	case id := <-peerRewardChan:
+		if id != sender {
+			t.Errorf("Incorrect peer rewarded. Expected %s, was %s", sender, id)
+		}
+	case err := <-peerErrorChan:
+		t.Errorf("Unexpected peer error for accepted transaction: %s", err.err)
+	case <-ctx.Done():
+		t.Error("Expected sender of accepted transaction to be rewarded")
+	}
+
+	// A transaction already in the cache is rebroadcast without a reward
+	if !kg.validateTransaction(ctx, sender, newTestTransactionMessage(t, sender, 1)) {
+		t.Error("Expected cached transaction to be rebroadcast")
+	}
+
+	// A rejected transaction is dropped and its sender penalized
+	localRPC.rejectTrxErr = errors.New("transaction rejected")
+	if kg.validateTransaction(ctx, sender, newTestTransactionMessage(t, sender, 2)) {
+		t.Error("Expected rejected transaction to be dropped")
+	}
+
+	select {
+	case peerErr := <-peerErrorChan:
+		if peerErr.id != sender {
+			t.Errorf("Incorrect peer penalized. Expected %s, was %s", sender, peerErr.id)
+		}
+		if !errors.Is(peerErr.err, p2perrors.ErrTransactionApplication) {
+			t.Errorf("Expected ErrTransactionApplication, was %s", peerErr.err)
+		}
+	case id := <-peerRewardChan:
+		t.Errorf("Unexpected reward for peer %s", id)
+	case <-ctx.Done():
+		t.Error("Expected sender of rejected transaction to be penalized")
+	}
+
+	select {
+	case id := <-peerRewardChan:
+		t.Errorf("Unexpected reward for peer %s", id)
+	case <-time.After(time.Millisecond * 50):
+	}
+}
+
+func TestTopicMessageSizeLimit(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	const smallTopicName = "koinos.test.small"
+	const smallTopicLimit = 16
+
+	publisher := newTestHost(t)
+	defer publisher.Close()
+
+	subscriber := newTestHost(t)
+	defer subscriber.Close()
+
+	publisherPS, err := pubsub.NewGossipSub(ctx, publisher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subscriberPS, err := pubsub.NewGossipSub(ctx, subscriber)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := options.NewGossipOptions()
+	publisherBlock := NewGossipManager(publisherPS, make(chan PeerError, 1), BlockTopicName, opts.MaxBlockMessageSize)
+	publisherSmall := NewGossipManager(publisherPS, make(chan PeerError, 1), smallTopicName, smallTopicLimit)
+
+	peerErrorChan := make(chan PeerError, 1)
+	acceptAll := func(context.Context, peer.ID, *pubsub.Message) bool { return true }
+
+	blockChan := make(chan []byte, 1)
+	subscriberBlock := NewGossipManager(subscriberPS, peerErrorChan, BlockTopicName, opts.MaxBlockMessageSize)
+	if err := subscriberBlock.RegisterValidator(acceptAll); err != nil {
+		t.Fatal(err)
+	}
+	if err := subscriberBlock.Start(ctx, blockChan); err != nil {
+		t.Fatal(err)
+	}
+
+	smallChan := make(chan []byte, 1)
+	subscriberSmall := NewGossipManager(subscriberPS, peerErrorChan, smallTopicName, smallTopicLimit)
+	if err := subscriberSmall.RegisterValidator(acceptAll); err != nil {
+		t.Fatal(err)
+	}
+	if err := subscriberSmall.Start(ctx, smallChan); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := publisher.Connect(ctx, peer.AddrInfo{ID: subscriber.ID(), Addrs: subscriber.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Large payloads are delivered on the block topic
+	largeMessage := bytes.Repeat([]byte{1}, 1<<16)
+	for received := false; !received; {
+		_ = publisherBlock.topic.Publish(ctx, largeMessage)
+
+		select {
+		case msg := <-blockChan:
+			if !bytes.Equal(msg, largeMessage) {
+				t.Errorf("Incorrect block message received, was %v bytes", len(msg))
+			}
+			received = true
+		case <-time.After(time.Millisecond * 100):
+		case <-ctx.Done():
+			t.Fatal("Expected large message to be delivered on the block topic")
+		}
+	}
+
+	// The same payload is rejected on the small topic, and the sender penalized
+	for rejected := false; !rejected; {
+		_ = publisherSmall.topic.Publish(ctx, largeMessage)
+
+		select {
+		case peerErr := <-peerErrorChan:
+			if peerErr.id != publisher.ID() {
+				t.Errorf("Incorrect peer penalized. Expected %s, was %s", publisher.ID(), peerErr.id)
+			}
+			if !errors.Is(peerErr.err, p2perrors.ErrMessageTooLarge) {
+				t.Errorf("Expected ErrMessageTooLarge, was %s", peerErr.err)
+			}
+			rejected = true
+		case <-smallChan:
+			t.Fatal("Expected oversized message to be rejected on the small topic")
+		case <-time.After(time.Millisecond * 100):
+		case <-ctx.Done():
+			t.Fatal("Expected oversized message to be rejected on the small topic")
+		}
+	}
+
+	// Oversized messages are not published from this node
+	if err := publisherSmall.Start(ctx, make(chan []byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if publisherSmall.PublishMessage(ctx, largeMessage) {
+		t.Error("Expected oversized message not to be published")
+	}
+}
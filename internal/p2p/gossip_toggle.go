@@ -2,7 +2,11 @@ package p2p
 
 import (
 	"context"
+	"sync/atomic"
+	"time"
 
+	log "github.com/koinos/koinos-log-golang"
+	"github.com/koinos/koinos-p2p/internal/metrics"
 	"github.com/koinos/koinos-p2p/internal/options"
 	"github.com/koinos/koinos-p2p/internal/rpc"
 	"github.com/libp2p/go-libp2p-core/peer"
@@ -17,6 +21,15 @@ type GossipVote struct {
 	synced bool
 }
 
+// GossipToggleState is the state of a GossipToggle as of the last vote
+type GossipToggleState struct {
+	Enabled bool
+	// VoteRatio is the fraction of voting peers that reported the node as synced
+	VoteRatio float64
+	// Peers is the number of peers that have voted
+	Peers int
+}
+
 // GossipToggle tracks peer gossip votes and toggles gossip accordingly
 type GossipToggle struct {
 	rpc                  rpc.LocalRPC
@@ -26,35 +39,103 @@ type GossipToggle struct {
 	yesCount             int
 	voteChan             <-chan GossipVote
 	peerDisconnectedChan <-chan peer.ID
+	metrics              *metrics.Collector
+	state                atomic.Value
+
+	// lastTransition is when gossip was last toggled. recheckChan is signaled once a toggle held back by
+	// the cooldown can be made.
+	lastTransition time.Time
+	recheckPending bool
+	recheckChan    chan struct{}
 
 	opts options.GossipToggleOptions
 }
 
 // IsEnabled returns whether gossip is enabled
 func (g *GossipToggle) IsEnabled() bool {
-	return g.enabled
+	return g.State().Enabled
+}
+
+// State returns the gossip toggle state as of the last vote
+func (g *GossipToggle) State() GossipToggleState {
+	if state, ok := g.state.Load().(GossipToggleState); ok {
+		return state
+	}
+
+	return GossipToggleState{}
+}
+
+func (g *GossipToggle) voteRatio() float64 {
+	if len(g.peerVotes) == 0 {
+		return 0
+	}
+
+	return float64(g.yesCount) / float64(len(g.peerVotes))
+}
+
+func (g *GossipToggle) storeState() {
+	ratio := g.voteRatio()
+	g.state.Store(GossipToggleState{Enabled: g.enabled, VoteRatio: ratio, Peers: len(g.peerVotes)})
+	g.metrics.SetGossipVoteRatio(ratio)
+}
+
+// canTransition returns true if gossip has been in its current state for at least ToggleCooldown.
+// Otherwise the thresholds are checked again once the cooldown has passed.
+func (g *GossipToggle) canTransition(ctx context.Context) bool {
+	remaining := g.opts.ToggleCooldown - time.Since(g.lastTransition)
+	if remaining <= 0 {
+		return true
+	}
+
+	if !g.recheckPending {
+		g.recheckPending = true
+		time.AfterFunc(remaining, func() {
+			select {
+			case g.recheckChan <- struct{}{}:
+			case <-ctx.Done():
+			}
+		})
+	}
+
+	return false
 }
 
 func (g *GossipToggle) checkThresholds(ctx context.Context) {
+	defer g.storeState()
+
 	if len(g.peerVotes) == 0 {
-		if g.enabled && !g.opts.AlwaysEnable {
+		if g.enabled && !g.opts.AlwaysEnable && g.canTransition(ctx) {
+			log.Info("Disabling gossip, no peers are connected")
+			g.lastTransition = time.Now()
 			g.enabled = false
 			g.gossipEnabler.EnableGossip(ctx, false)
+			g.metrics.SetGossipEnabled(false)
 		}
 		return
 	}
 
-	threshold := float64(g.yesCount) / float64(len(g.peerVotes))
+	// Too few peers to trust the ratio, the toggle stays put
+	if len(g.peerVotes) < g.opts.MinPeers {
+		return
+	}
+
+	threshold := g.voteRatio()
 
-	if threshold-g.opts.EnableThreshold >= -epsilon && !g.enabled {
+	if threshold-g.opts.EnableThreshold >= -epsilon && !g.enabled && g.canTransition(ctx) {
+		log.Infof("Enabling gossip, %v of %v peers are synced (ratio %.2f, enable threshold %.2f)", g.yesCount, len(g.peerVotes), threshold, g.opts.EnableThreshold)
+		g.lastTransition = time.Now()
 		g.enabled = true
 		g.gossipEnabler.EnableGossip(ctx, true)
+		g.metrics.SetGossipEnabled(true)
 		if g.rpc != nil {
 			_ = g.rpc.BroadcastGossipStatus(true)
 		}
-	} else if g.opts.DisableThreshold-threshold >= -epsilon && g.enabled {
+	} else if g.opts.DisableThreshold-threshold >= -epsilon && g.enabled && g.canTransition(ctx) {
+		log.Infof("Disabling gossip, %v of %v peers are synced (ratio %.2f, disable threshold %.2f)", g.yesCount, len(g.peerVotes), threshold, g.opts.DisableThreshold)
+		g.lastTransition = time.Now()
 		g.enabled = false
 		g.gossipEnabler.EnableGossip(ctx, false)
+		g.metrics.SetGossipEnabled(false)
 		if g.rpc != nil {
 			_ = g.rpc.BroadcastGossipStatus(false)
 		}
@@ -62,6 +143,8 @@ func (g *GossipToggle) checkThresholds(ctx context.Context) {
 }
 
 func (g *GossipToggle) handleVote(ctx context.Context, vote GossipVote) {
+	g.metrics.RecordGossipVote(vote.synced)
+
 	if g.opts.AlwaysEnable || g.opts.AlwaysDisable {
 		return
 	}
@@ -104,6 +187,7 @@ func (g *GossipToggle) Start(ctx context.Context) {
 	go func() {
 		if g.opts.AlwaysEnable {
 			g.gossipEnabler.EnableGossip(ctx, true)
+			g.metrics.SetGossipEnabled(true)
 		}
 
 		for {
@@ -112,6 +196,9 @@ func (g *GossipToggle) Start(ctx context.Context) {
 				g.handleVote(ctx, vote)
 			case peer := <-g.peerDisconnectedChan:
 				g.handlepeerDisconnected(ctx, peer)
+			case <-g.recheckChan:
+				g.recheckPending = false
+				g.checkThresholds(ctx)
 
 			case <-ctx.Done():
 				return
@@ -121,7 +208,7 @@ func (g *GossipToggle) Start(ctx context.Context) {
 }
 
 // NewGossipToggle creates a GossipToggle
-func NewGossipToggle(gossipEnabler GossipEnableHandler, rpc rpc.LocalRPC, voteChan <-chan GossipVote, peerDisconnectedChan <-chan peer.ID, opts options.GossipToggleOptions) *GossipToggle {
+func NewGossipToggle(gossipEnabler GossipEnableHandler, rpc rpc.LocalRPC, voteChan <-chan GossipVote, peerDisconnectedChan <-chan peer.ID, metrics *metrics.Collector, opts options.GossipToggleOptions) *GossipToggle {
 	return &GossipToggle{
 		rpc:                  rpc,
 		gossipEnabler:        gossipEnabler,
@@ -130,6 +217,8 @@ func NewGossipToggle(gossipEnabler GossipEnableHandler, rpc rpc.LocalRPC, voteCh
 		yesCount:             0,
 		voteChan:             voteChan,
 		peerDisconnectedChan: peerDisconnectedChan,
+		metrics:              metrics,
+		recheckChan:          make(chan struct{}),
 		opts:                 opts,
 	}
 }
@@ -2,6 +2,7 @@ package p2p
 
 import (
 	"context"
+	"sync"
 	"testing"
 	"time"
 
@@ -28,7 +29,7 @@ func TestNormalGossipToggle(t *testing.T) {
 	opts.AlwaysDisable = false
 	opts.AlwaysEnable = false
 
-	gossipToggle := NewGossipToggle(&testHandler, nil, voteChan, peerDisconnectedChan, *opts)
+	gossipToggle := NewGossipToggle(&testHandler, nil, voteChan, peerDisconnectedChan, nil, *opts)
 	gossipToggle.Start(ctx)
 	time.Sleep(time.Millisecond * 5)
 
@@ -160,7 +161,7 @@ func TestAlwaysEnabledGossipToggle(t *testing.T) {
 	opts.AlwaysDisable = false
 	opts.AlwaysEnable = true
 
-	gossipToggle := NewGossipToggle(&testHandler, nil, voteChan, peerDisconnectedChan, *opts)
+	gossipToggle := NewGossipToggle(&testHandler, nil, voteChan, peerDisconnectedChan, nil, *opts)
 	gossipToggle.Start(ctx)
 	time.Sleep(time.Millisecond * 5)
 
@@ -197,7 +198,7 @@ func TestAlwaysDisabledGossipToggle(t *testing.T) {
 	opts.AlwaysDisable = true
 	opts.AlwaysEnable = false
 
-	gossipToggle := NewGossipToggle(&testHandler, nil, voteChan, peerDisconnectedChan, *opts)
+	gossipToggle := NewGossipToggle(&testHandler, nil, voteChan, peerDisconnectedChan, nil, *opts)
 	gossipToggle.Start(ctx)
 	time.Sleep(time.Millisecond * 5)
 
@@ -224,3 +225,146 @@ func TestAlwaysDisabledGossipToggle(t *testing.T) {
 		t.Errorf("Gossip was incorrectly enabled from votes")
 	}
 }
+
+func TestGossipToggleMinPeers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	testHandler := TestGossipEnableHandler{false}
+	voteChan := make(chan GossipVote)
+	peerDisconnectedChan := make(chan peer.ID)
+	opts := options.NewGossipToggleOptions()
+	opts.MinPeers = 3
+
+	gossipToggle := NewGossipToggle(&testHandler, nil, voteChan, peerDisconnectedChan, nil, *opts)
+	gossipToggle.Start(ctx)
+
+	// All voting peers are synced, but there are too few of them to enable gossip
+	for _, p := range []peer.ID{"a", "b"} {
+		voteChan <- GossipVote{p, true}
+		time.Sleep(time.Millisecond * 5)
+		if gossipToggle.IsEnabled() {
+			t.Errorf("Gossip was enabled with fewer than %v peers", opts.MinPeers)
+		}
+	}
+
+	state := gossipToggle.State()
+	if state.Peers != 2 || state.VoteRatio != 1 {
+		t.Errorf("Incorrect gossip toggle state. Expected 2 peers with ratio 1, was %+v", state)
+	}
+
+	voteChan <- GossipVote{"c", true}
+	time.Sleep(time.Millisecond * 5)
+	if !gossipToggle.IsEnabled() {
+		t.Errorf("Gossip was not enabled once %v peers voted", opts.MinPeers)
+	}
+
+	// Dropping below the minimum leaves gossip enabled, until no peers remain
+	peerDisconnectedChan <- "c"
+	voteChan <- GossipVote{"a", false}
+	voteChan <- GossipVote{"b", false}
+	time.Sleep(time.Millisecond * 5)
+	state = gossipToggle.State()
+	if !state.Enabled || state.Peers != 2 || state.VoteRatio != 0 {
+		t.Errorf("Expected gossip to stay enabled with 2 peers at ratio 0, was %+v", state)
+	}
+
+	peerDisconnectedChan <- "a"
+	peerDisconnectedChan <- "b"
+	time.Sleep(time.Millisecond * 5)
+	if gossipToggle.IsEnabled() {
+		t.Error("Expected gossip to be disabled once no peers remain")
+	}
+}
+
+// countingGossipEnableHandler counts the times gossip is toggled
+type countingGossipEnableHandler struct {
+	enabled     bool
+	transitions int
+	mutex       sync.Mutex
+}
+
+func (c *countingGossipEnableHandler) EnableGossip(ctx context.Context, enabled bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.enabled = enabled
+	c.transitions++
+}
+
+func (c *countingGossipEnableHandler) state() (bool, int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.enabled, c.transitions
+}
+
+func TestGossipToggleCooldown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	testHandler := &countingGossipEnableHandler{}
+	voteChan := make(chan GossipVote)
+	opts := options.NewGossipToggleOptions()
+	opts.ToggleCooldown = time.Millisecond * 300
+
+	gossipToggle := NewGossipToggle(testHandler, nil, voteChan, make(chan peer.ID), nil, *opts)
+	gossipToggle.Start(ctx)
+
+	start := time.Now()
+	for _, p := range []peer.ID{"a", "b", "c"} {
+		voteChan <- GossipVote{p, true}
+	}
+
+	// The ratio crosses the disable and enable thresholds repeatedly within the cooldown
+	for i := 0; i < 3; i++ {
+		voteChan <- GossipVote{"a", false}
+		voteChan <- GossipVote{"b", false}
+		voteChan <- GossipVote{"a", true}
+		voteChan <- GossipVote{"b", true}
+	}
+	voteChan <- GossipVote{"a", false}
+	voteChan <- GossipVote{"b", false}
+	time.Sleep(time.Millisecond * 10)
+
+	if time.Since(start) >= opts.ToggleCooldown {
+		t.Fatal("Votes took longer than the cooldown to send")
+	}
+
+	enabled, transitions := testHandler.state()
+	if !enabled || transitions != 1 {
+		t.Errorf("Expected gossip to be enabled once during the cooldown, was enabled %v after %v transitions", enabled, transitions)
+	}
+
+	// Once the cooldown has passed, the accumulated votes disable gossip
+	deadline := start.Add(opts.ToggleCooldown + time.Second)
+	for (enabled || gossipToggle.IsEnabled()) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+		enabled, transitions = testHandler.state()
+	}
+	if enabled || transitions != 2 {
+		t.Errorf("Expected gossip to be disabled after the cooldown, was enabled %v after %v transitions", enabled, transitions)
+	}
+	if gossipToggle.IsEnabled() {
+		t.Error("Expected gossip toggle to report gossip disabled after the cooldown")
+	}
+}
+
+func TestGossipToggleSinglePeer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	testHandler := TestGossipEnableHandler{false}
+	voteChan := make(chan GossipVote)
+
+	gossipToggle := NewGossipToggle(&testHandler, nil, voteChan, make(chan peer.ID), nil, *options.NewGossipToggleOptions())
+	gossipToggle.Start(ctx)
+
+	// With the default options, a node with a single synced peer gossips
+	voteChan <- GossipVote{"a", true}
+	time.Sleep(time.Millisecond * 5)
+
+	if !testHandler.enabled || !gossipToggle.IsEnabled() {
+		t.Error("Expected gossip to be enabled by a single synced peer")
+	}
+}
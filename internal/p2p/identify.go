@@ -0,0 +1,51 @@
+package p2p
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// peerIDMismatch matches the remote peer ID in the mismatch errors of the Noise and TLS security transports
+var peerIDMismatch = regexp.MustCompile(`(?:remote key matches|got) (\w+)`)
+
+// identifyPeerAddress learns the ID of the peer listening on an address that lacks a /p2p/ component.
+// A libp2p dial requires the remote peer ID, so the host dials a placeholder ID through its own transports
+// and security protocols. The handshake fails on the ID mismatch, and the ID is taken from the error,
+// which reports the key the remote presented.
+func identifyPeerAddress(ctx context.Context, h host.Host, addr multiaddr.Multiaddr) (peer.ID, error) {
+	key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+
+	placeholder, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	h.Peerstore().AddAddr(placeholder, addr, peerstore.TempAddrTTL)
+	defer h.Peerstore().RemovePeer(placeholder)
+	defer h.Peerstore().ClearAddrs(placeholder)
+
+	conn, err := h.Network().DialPeer(ctx, placeholder)
+	if err == nil {
+		conn.Close()
+		return "", errors.New("peer accepted a placeholder peer ID")
+	}
+
+	match := peerIDMismatch.FindStringSubmatch(err.Error())
+	if match == nil {
+		return "", fmt.Errorf("could not identify peer: %w", err)
+	}
+
+	return peer.Decode(match[1])
+}
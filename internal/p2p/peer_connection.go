@@ -5,51 +5,180 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	log "github.com/koinos/koinos-log-golang"
+	"github.com/koinos/koinos-p2p/internal/metrics"
 	"github.com/koinos/koinos-p2p/internal/options"
 	"github.com/koinos/koinos-p2p/internal/p2perrors"
 	"github.com/koinos/koinos-p2p/internal/rpc"
+	"github.com/koinos/koinos-proto-golang/koinos"
+	"github.com/koinos/koinos-proto-golang/koinos/protocol"
+	"github.com/koinos/koinos-proto-golang/koinos/rpc/chain"
+	util "github.com/koinos/koinos-util-golang"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/multiformats/go-multihash"
+	"google.golang.org/protobuf/proto"
 )
 
 type signalRequestBlocks struct{}
 
+// rollingAverageWeight is the weight of the newest sample in a peer's rolling average block latency and block size
+const rollingAverageWeight = 0.25
+
+// PeerHead is the head block last reported by a peer
+type PeerHead struct {
+	ID     multihash.Multihash
+	Height uint64
+}
+
+// DownloadStats are the counts of block requests made to a peer while syncing
+type DownloadStats struct {
+	// Requests is the number of block requests made to the peer
+	Requests uint64
+	// Failures is the number of block requests that errored or returned invalid blocks
+	Failures uint64
+	// Blocks is the number of valid blocks downloaded from the peer
+	Blocks uint64
+	// Bytes is the serialized size of the valid blocks downloaded from the peer
+	Bytes uint64
+	// Latency is the cumulative time spent waiting on block requests
+	Latency time.Duration
+}
+
+// AverageLatency returns the mean time taken by a block request, or 0 if none were made
+func (s DownloadStats) AverageLatency() time.Duration {
+	if s.Requests == 0 {
+		return 0
+	}
+
+	return s.Latency / time.Duration(s.Requests)
+}
+
+// SuccessRatio returns the fraction of block requests that succeeded, or 0 if none were made
+func (s DownloadStats) SuccessRatio() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+
+	return float64(s.Requests-s.Failures) / float64(s.Requests)
+}
+
 // PeerConnection handles the sync portion of a connection to a peer
 type PeerConnection struct {
 	id         peer.ID
 	isSynced   bool
 	gossipVote bool
+	synced     atomic.Value
+	lastSeen   atomic.Value
+	head       atomic.Value
 	opts       *options.PeerConnectionOptions
 
+	// lastActivity is the last time a handshake attempt or block request finished, successful or not
+	lastActivity atomic.Value
+
+	lastHeadHeight  uint64
+	headRegressions uint
+
+	// servable is the range of heights the peer serves, as reported during the handshake
+	servable options.HeightRange
+
+	// blockLatency is the rolling average latency of a block request per requested block, used to adapt
+	// the block request timeout to the size of each request
+	blockLatency time.Duration
+	slowRequests uint
+
+	// blockSize is the rolling average size of the peer's blocks, used to limit the bytes of each block request
+	blockSize uint64
+
 	requestBlockChan chan signalRequestBlocks
 
+	// handshakeSlots is shared between peer connections to limit concurrent handshakes, nil if unlimited
+	handshakeSlots chan struct{}
+	clockMonitor   *ClockMonitor
+
+	downloadStats     DownloadStats
+	downloadStatsLock sync.Mutex
+
+	// stopping is set by Stop, after which no new requests are made. inFlight tracks the request
+	// being handled so Wait can block until it is done.
+	stopping     bool
+	stoppingLock sync.Mutex
+	inFlight     sync.WaitGroup
+
 	libProvider    LastIrreversibleBlockProvider
 	localRPC       rpc.LocalRPC
 	peerRPC        rpc.RemoteRPC
 	peerErrorChan  chan<- PeerError
 	gossipVoteChan chan<- GossipVote
+	metrics        *metrics.Collector
+
+	// errorQueue and voteQueue hold reports until they are forwarded, so a slow consumer does not block the connection
+	errorQueue chan PeerError
+	voteQueue  chan GossipVote
+}
+
+func (p *PeerConnection) requestBlocks(ctx context.Context) {
+	select {
+	case p.requestBlockChan <- signalRequestBlocks{}:
+	case <-ctx.Done():
+	}
+}
+
+// beginRequest marks a request as in flight, returning false if the connection is stopping
+func (p *PeerConnection) beginRequest() bool {
+	p.stoppingLock.Lock()
+	defer p.stoppingLock.Unlock()
+
+	if p.stopping {
+		return false
+	}
+
+	p.inFlight.Add(1)
+	return true
+}
+
+// Stop the connection from making new requests to the peer. A request already in flight continues.
+func (p *PeerConnection) Stop() {
+	p.stoppingLock.Lock()
+	defer p.stoppingLock.Unlock()
+
+	p.stopping = true
 }
 
-func (p *PeerConnection) requestBlocks() {
-	p.requestBlockChan <- signalRequestBlocks{}
+// Wait blocks until the request in flight, if any, is done. It should be called after Stop.
+func (p *PeerConnection) Wait() {
+	p.inFlight.Wait()
+}
+
+// getLocalChainID waits for a free handshake slot before requesting the local chain id. The slot is
+// only held for the local request, so a slow peer can not keep other handshakes waiting.
+func (p *PeerConnection) getLocalChainID(ctx context.Context) (*chain.GetChainIdResponse, error) {
+	if p.handshakeSlots != nil {
+		select {
+		case p.handshakeSlots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		defer func() { <-p.handshakeSlots }()
+	}
+
+	rpcContext, cancel := context.WithTimeout(ctx, p.opts.LocalRPCTimeout)
+	defer cancel()
+	return p.localRPC.GetChainID(rpcContext)
 }
 
 func (p *PeerConnection) handshake(ctx context.Context) error {
 	// Get my chain id
-	rpcContext, cancelLocalGetChainID := context.WithTimeout(ctx, p.opts.LocalRPCTimeout)
-	defer cancelLocalGetChainID()
-	myChainID, err := p.localRPC.GetChainID(rpcContext)
+	myChainID, err := p.getLocalChainID(ctx)
 	if err != nil {
 		return err
 	}
 
 	// Get peer's chain id
-	rpcContext, cancelPeerGetChainID := context.WithTimeout(ctx, p.opts.RemoteRPCTimeout)
-	defer cancelPeerGetChainID()
-	peerChainID, err := p.peerRPC.GetChainID(rpcContext)
+	peerChainID, err := p.getPeerChainID(ctx)
 	if err != nil {
 		return err
 	}
@@ -79,9 +208,38 @@ func (p *PeerConnection) handshake(ctx context.Context) error {
 		}
 	}
 
+	// Get the heights the peer serves
+	rpcContext, cancelGetServable := context.WithTimeout(ctx, p.opts.RemoteRPCTimeout)
+	defer cancelGetServable()
+	low, high, err := p.peerRPC.GetServableHeightRange(rpcContext)
+	if err != nil {
+		return err
+	}
+	p.servable = options.HeightRange{Low: low, High: high}
+
 	return nil
 }
 
+// getPeerChainID requests the peer's chain id, retrying failed requests in case the peer is still initializing
+func (p *PeerConnection) getPeerChainID(ctx context.Context) (multihash.Multihash, error) {
+	for attempt := uint(0); ; attempt++ {
+		rpcContext, cancel := context.WithTimeout(ctx, p.opts.RemoteRPCTimeout)
+		chainID, err := p.peerRPC.GetChainID(rpcContext)
+		cancel()
+		if err == nil || attempt >= p.opts.ChainIDRetries {
+			return chainID, err
+		}
+
+		log.Debugf("Could not get chain id from peer %s, retrying: %s", p.id, err.Error())
+
+		select {
+		case <-time.After(p.opts.ChainIDRetryDelay):
+		case <-ctx.Done():
+			return nil, err
+		}
+	}
+}
+
 func (p *PeerConnection) handleRequestBlocks(ctx context.Context) error {
 	// Get my last irreversible block
 	lib := p.libProvider.GetLastIrreversibleBlock()
@@ -94,6 +252,13 @@ func (p *PeerConnection) handleRequestBlocks(ctx context.Context) error {
 		return err
 	}
 
+	p.head.Store(PeerHead{ID: peerHeadID, Height: peerHeadHeight})
+
+	err = p.checkHeadRegression(peerHeadHeight)
+	if err != nil {
+		return err
+	}
+
 	// If the peer is in the past, it is not an error, but we don't need anything from them
 	if peerHeadHeight <= lib.Height {
 		p.isSynced = true
@@ -136,23 +301,60 @@ func (p *PeerConnection) handleRequestBlocks(ctx context.Context) error {
 		blocksToRequest = p.opts.BlockRequestBatchSize
 	}
 
+	// Only request heights the peer serves, a peer that can not serve the next block is skipped
+	if !p.servable.Contains(lib.Height + 1) {
+		return fmt.Errorf("%w, next block is at height %v, peer serves heights %v-%v", p2perrors.ErrHeightNotServable, lib.Height+1, p.servable.Low, p.servable.High)
+	}
+	if p.servable.High > 0 && lib.Height+blocksToRequest > p.servable.High {
+		blocksToRequest = p.servable.High - lib.Height
+	}
+	if limit := p.blockRequestLimit(); blocksToRequest > limit {
+		blocksToRequest = limit
+	}
+
 	// Request blocks
 	if blocksToRequest == p.opts.BlockRequestBatchSize {
 		log.Infof("Requesting blocks %v-%v from peer %s", lib.Height+1, lib.Height+1+blocksToRequest, p.id)
 	}
 
-	rpcContext, cancelGetBlocks := context.WithTimeout(ctx, p.opts.BlockRequestTimeout)
-	defer cancelGetBlocks()
-	blocks, err := p.peerRPC.GetBlocks(rpcContext, peerHeadID, lib.Height+1, uint32(blocksToRequest))
+	timeout := p.blockRequestTimeout(blocksToRequest)
+	start := time.Now()
+	blocks, err := p.downloadBlocks(ctx, timeout, lib, peerHeadID, peerHeadHeight, blocksToRequest)
+	latency := time.Since(start)
+	p.recordDownload(blocks, latency, err)
+	if slowErr := p.updateRequestLatency(timeout, latency, blocksToRequest, err); slowErr != nil {
+		return slowErr
+	}
 	if err != nil {
 		return err
 	}
 
+	now := time.Now()
+	p.clockMonitor.Observe(p.id, blockTimeOffset(&blocks[len(blocks)-1], now))
+
+	err = checkClockSkew(blocks, now, p.opts.MaxClockSkew)
+	if err != nil {
+		return err
+	}
+
+	var toApply []*protocol.Block
+	if p.opts.SkipAppliedBlocks {
+		toApply, err = p.filterAppliedBlocks(ctx, blocks)
+		if err != nil {
+			return err
+		}
+	} else {
+		toApply = make([]*protocol.Block, len(blocks))
+		for i := range blocks {
+			toApply[i] = &blocks[i]
+		}
+	}
+
 	// Apply blocks to local node
-	for i := range blocks {
+	for i := range toApply {
 		rpcContext, cancelApplyBlock := context.WithTimeout(ctx, p.opts.LocalRPCTimeout)
 		defer cancelApplyBlock()
-		_, err = p.localRPC.ApplyBlock(rpcContext, &blocks[i])
+		_, err = p.localRPC.ApplyBlock(rpcContext, toApply[i])
 		if err != nil {
 			// If it was a local RPC timeout, do not wrap it
 			if errors.Is(err, p2perrors.ErrLocalRPCTimeout) {
@@ -169,14 +371,381 @@ func (p *PeerConnection) handleRequestBlocks(ctx context.Context) error {
 	return nil
 }
 
-func (p *PeerConnection) reportGossipVote(ctx context.Context) {
+// downloadBlocks requests up to blocksToRequest blocks following lib from the peer and validates them
+func (p *PeerConnection) downloadBlocks(ctx context.Context, timeout time.Duration, lib *koinos.BlockTopology, peerHeadID multihash.Multihash, peerHeadHeight uint64, blocksToRequest uint64) ([]protocol.Block, error) {
+	rpcContext, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	blocks, err := p.peerRPC.GetBlocks(rpcContext, peerHeadID, lib.Height+1, uint32(blocksToRequest))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("%w, requested %v, peer returned none", p2perrors.ErrUnexpectedBlockCount, blocksToRequest)
+	}
+
+	err = validateBlocks(blocks, lib, peerHeadID, peerHeadHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	return blocks, nil
+}
+
+// blockRequestLimit returns the most blocks to request from the peer, so a request for blocks of the
+// peer's average size stays within BlockRequestMaxBytes. At least one block is always requested.
+func (p *PeerConnection) blockRequestLimit() uint64 {
+	if p.opts.BlockRequestMaxBytes == 0 || p.blockSize == 0 {
+		return p.opts.BlockRequestBatchSize
+	}
+
+	limit := p.opts.BlockRequestMaxBytes / p.blockSize
+	if limit == 0 {
+		return 1
+	}
+
+	return limit
+}
+
+// blockRequestTimeout returns the timeout for the next block request to the peer, for numBlocks blocks
+func (p *PeerConnection) blockRequestTimeout(numBlocks uint64) time.Duration {
+	if p.opts.BlockRequestTimeoutMultiplier <= 0 {
+		return p.opts.BlockRequestTimeout
+	}
+
+	timeout := p.opts.BlockRequestTimeout
+	if p.blockLatency > 0 {
+		timeout = time.Duration(float64(p.blockLatency) * float64(numBlocks) * p.opts.BlockRequestTimeoutMultiplier)
+	}
+
+	if timeout < p.opts.MinBlockRequestTimeout {
+		timeout = p.opts.MinBlockRequestTimeout
+	}
+	if p.opts.MaxBlockRequestTimeout > 0 && timeout > p.opts.MaxBlockRequestTimeout {
+		timeout = p.opts.MaxBlockRequestTimeout
+	}
+
+	return timeout
+}
+
+// updateRequestLatency adds the latency of a request for numBlocks blocks to the peer's rolling average
+// latency per block. A request that timed out counts as taking the full timeout, other errors are ignored.
+// Returns an error once SlowRequestLimit consecutive requests have timed out at MaxBlockRequestTimeout.
+func (p *PeerConnection) updateRequestLatency(timeout time.Duration, latency time.Duration, numBlocks uint64, err error) error {
+	if p.opts.BlockRequestTimeoutMultiplier <= 0 {
+		return nil
+	}
+
+	timedOut := errors.Is(err, p2perrors.ErrPeerRPCTimeout) || errors.Is(err, context.DeadlineExceeded)
+	if err != nil && !timedOut {
+		return nil
+	}
+
+	if timedOut {
+		latency = timeout
+	}
+
+	if numBlocks == 0 {
+		numBlocks = 1
+	}
+	latency /= time.Duration(numBlocks)
+
+	if p.blockLatency == 0 {
+		p.blockLatency = latency
+	} else {
+		p.blockLatency += time.Duration(float64(latency-p.blockLatency) * rollingAverageWeight)
+	}
+
+	if !timedOut || timeout < p.opts.MaxBlockRequestTimeout {
+		p.slowRequests = 0
+		return nil
+	}
+
+	p.slowRequests++
+	log.Debugf("Block request to peer %s timed out after %s", p.id, timeout)
+
+	if p.opts.SlowRequestLimit > 0 && p.slowRequests >= p.opts.SlowRequestLimit {
+		p.slowRequests = 0
+		return fmt.Errorf("%w, %v consecutive block requests timed out after %s", p2perrors.ErrSlowPeer, p.opts.SlowRequestLimit, timeout)
+	}
+
+	return nil
+}
+
+// recordDownload adds the outcome of a block request to the peer's download stats
+func (p *PeerConnection) recordDownload(blocks []protocol.Block, latency time.Duration, err error) {
+	var size uint64
+	for i := range blocks {
+		size += uint64(proto.Size(&blocks[i]))
+	}
+
+	p.downloadStatsLock.Lock()
+	defer p.downloadStatsLock.Unlock()
+
+	p.downloadStats.Requests++
+	p.downloadStats.Latency += latency
+	if err != nil {
+		p.downloadStats.Failures++
+		return
+	}
+
+	p.downloadStats.Blocks += uint64(len(blocks))
+	p.downloadStats.Bytes += size
+	p.metrics.RecordBlocksDownloaded(len(blocks))
+
+	if len(blocks) > 0 {
+		blockSize := size / uint64(len(blocks))
+		if p.blockSize == 0 {
+			p.blockSize = blockSize
+		} else {
+			p.blockSize = uint64(float64(p.blockSize) + (float64(blockSize)-float64(p.blockSize))*rollingAverageWeight)
+		}
+	}
+}
+
+// DownloadStats returns the block download stats for the peer
+func (p *PeerConnection) DownloadStats() DownloadStats {
+	p.downloadStatsLock.Lock()
+	defer p.downloadStatsLock.Unlock()
+
+	return p.downloadStats
+}
+
+// Head returns the head block last reported by the peer, or an empty PeerHead if it has not reported one
+func (p *PeerConnection) Head() PeerHead {
+	if head, ok := p.head.Load().(PeerHead); ok {
+		return head
+	}
+
+	return PeerHead{}
+}
+
+// checkHeadRegression tracks the peer's reported head height, returning an error once the head has
+// moved backward by more than HeadRegressionDepth blocks HeadRegressionLimit times
+func (p *PeerConnection) checkHeadRegression(headHeight uint64) error {
+	lastHeadHeight := p.lastHeadHeight
+	p.lastHeadHeight = headHeight
+
+	if headHeight+p.opts.HeadRegressionDepth >= lastHeadHeight {
+		return nil
+	}
+
+	p.headRegressions++
+	log.Debugf("Peer %s head regressed from height %v to %v", p.id, lastHeadHeight, headHeight)
+
+	if p.headRegressions >= p.opts.HeadRegressionLimit {
+		p.headRegressions = 0
+		return fmt.Errorf("%w, head moved from height %v to %v", p2perrors.ErrHeadRegression, lastHeadHeight, headHeight)
+	}
+
+	return nil
+}
+
+// filterAppliedBlocks returns the blocks that are not already in the local block store
+func (p *PeerConnection) filterAppliedBlocks(ctx context.Context, blocks []protocol.Block) ([]*protocol.Block, error) {
+	blockIDs := make([]multihash.Multihash, len(blocks))
+	for i := range blocks {
+		blockIDs[i] = blocks[i].Id
+	}
+
+	rpcContext, cancel := context.WithTimeout(ctx, p.opts.LocalRPCTimeout)
+	defer cancel()
+	localBlocks, err := p.localRPC.GetBlocksByID(rpcContext, blockIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[string]util.Void)
+	for _, item := range localBlocks.BlockItems {
+		if item.BlockHeight != 0 {
+			applied[string(item.BlockId)] = util.Void{}
+		}
+	}
+
+	toApply := make([]*protocol.Block, 0, len(blocks))
+	for i := range blocks {
+		if _, ok := applied[string(blocks[i].Id)]; ok {
+			log.Debugf("Skipping already applied block %s from peer %s", util.BlockString(&blocks[i]), p.id)
+			continue
+		}
+		toApply = append(toApply, &blocks[i])
+	}
+
+	return toApply, nil
+}
+
+// validateBlocks checks that blocks requested from a peer are the consecutive blocks following lib on the
+// peer's chain, ending at the peer's head block if the batch reaches it
+func validateBlocks(blocks []protocol.Block, lib *koinos.BlockTopology, headID multihash.Multihash, headHeight uint64) error {
+	for i := range blocks {
+		block := &blocks[i]
+		expectedHeight := lib.Height + 1 + uint64(i)
+
+		if block.Header == nil {
+			return fmt.Errorf("%w, block at height %v missing header", p2perrors.ErrBlockMismatch, expectedHeight)
+		}
+
+		if block.Header.Height != expectedHeight {
+			return fmt.Errorf("%w, expected block at height %v, was %v", p2perrors.ErrBlockMismatch, expectedHeight, block.Header.Height)
+		}
+
+		// If LIB is 0, we are still at genesis and the first block has no previous block to link to
+		if i > 0 {
+			if !bytes.Equal(block.Header.Previous, blocks[i-1].Id) {
+				return fmt.Errorf("%w, block at height %v does not link to previous block", p2perrors.ErrBlockMismatch, expectedHeight)
+			}
+		} else if lib.Height > 0 && !bytes.Equal(block.Header.Previous, lib.Id) {
+			return fmt.Errorf("%w, block at height %v does not link to last irreversible block", p2perrors.ErrBlockMismatch, expectedHeight)
+		}
+
+		if expectedHeight == headHeight && !bytes.Equal(block.Id, headID) {
+			return fmt.Errorf("%w, block at height %v is not peer's head block", p2perrors.ErrBlockMismatch, expectedHeight)
+		}
+	}
+
+	return nil
+}
+
+// checkClockSkew checks that the newest of the blocks is not timestamped more than maxSkew past now
+func checkClockSkew(blocks []protocol.Block, now time.Time, maxSkew time.Duration) error {
+	if maxSkew == 0 || len(blocks) == 0 {
+		return nil
+	}
+
+	head := &blocks[len(blocks)-1]
+	if skew := blockTimeOffset(head, now); skew > maxSkew {
+		return fmt.Errorf("%w, block at height %v is %v ahead of local time", p2perrors.ErrClockSkew, head.Header.Height, skew.Round(time.Millisecond))
+	}
+
+	return nil
+}
+
+// blockTimeOffset returns how far past now the block is timestamped
+func blockTimeOffset(block *protocol.Block, now time.Time) time.Duration {
+	// Block timestamps are in milliseconds since the epoch
+	timestamp := time.Unix(0, int64(block.Header.Timestamp)*int64(time.Millisecond))
+	return timestamp.Sub(now)
+}
+
+// LastSeen returns the last time the peer successfully responded during a handshake or sync
+func (p *PeerConnection) LastSeen() time.Time {
+	if lastSeen, ok := p.lastSeen.Load().(time.Time); ok {
+		return lastSeen
+	}
+
+	return time.Time{}
+}
+
+// LastActivity returns the last time the connection finished a handshake attempt or block request,
+// or the time it was started if it has finished neither. It is zero if the connection was not started.
+func (p *PeerConnection) LastActivity() time.Time {
+	if lastActivity, ok := p.lastActivity.Load().(time.Time); ok {
+		return lastActivity
+	}
+
+	return time.Time{}
+}
+
+// IsSynced returns whether the node was synced to the peer as of the last sync attempt
+func (p *PeerConnection) IsSynced() bool {
+	if synced, ok := p.synced.Load().(bool); ok {
+		return synced
+	}
+
+	return false
+}
+
+// reportGossipVote queues the peer's current vote, replacing a queued vote that has not been sent yet
+func (p *PeerConnection) reportGossipVote() {
 	p.gossipVote = p.isSynced
-	go func() {
+	p.synced.Store(p.isSynced)
+
+	vote := GossipVote{p.id, p.gossipVote}
+	for {
+		select {
+		case p.voteQueue <- vote:
+			return
+		default:
+		}
+
 		select {
-		case p.gossipVoteChan <- GossipVote{p.id, p.gossipVote}:
+		case <-p.voteQueue:
+			p.metrics.RecordCoalescedGossipVote()
+		default:
+		}
+	}
+}
+
+// isDisconnectError returns true if the error disconnects the peer regardless of its error score
+func isDisconnectError(err error) bool {
+	return errors.Is(err, p2perrors.ErrChainIDMismatch) ||
+		errors.Is(err, p2perrors.ErrChainNotConnected) ||
+		errors.Is(err, p2perrors.ErrCheckpointMismatch)
+}
+
+// reportPeerError queues an error caused by the peer. If the queue is full, the error is dropped, unless
+// it disconnects the peer, in which case the oldest queued error is dropped to make room for it.
+func (p *PeerConnection) reportPeerError(err error) {
+	peerErr := PeerError{id: p.id, err: err}
+
+	select {
+	case p.errorQueue <- peerErr:
+		return
+	default:
+	}
+
+	if isDisconnectError(err) {
+		select {
+		case dropped := <-p.errorQueue:
+			p.dropPeerError(dropped.err)
+		default:
+		}
+
+		select {
+		case p.errorQueue <- peerErr:
+			return
+		default:
+		}
+	}
+
+	p.dropPeerError(err)
+}
+
+func (p *PeerConnection) dropPeerError(err error) {
+	log.Debugf("Dropped error from peer %s, the error queue is full: %s", p.id, err)
+	p.metrics.RecordDroppedPeerError()
+}
+
+// forwardGossipVotes sends queued votes until the context is done
+func (p *PeerConnection) forwardGossipVotes(ctx context.Context) {
+	for {
+		select {
+		case vote := <-p.voteQueue:
+			select {
+			case p.gossipVoteChan <- vote:
+			case <-ctx.Done():
+				return
+			}
 		case <-ctx.Done():
+			return
 		}
-	}()
+	}
+}
+
+// forwardPeerErrors sends queued errors until the context is done
+func (p *PeerConnection) forwardPeerErrors(ctx context.Context) {
+	for {
+		select {
+		case err := <-p.errorQueue:
+			select {
+			case p.peerErrorChan <- err:
+			case <-ctx.Done():
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
 }
 
 func (p *PeerConnection) connectionLoop(ctx context.Context) {
@@ -185,23 +754,26 @@ func (p *PeerConnection) connectionLoop(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-p.requestBlockChan:
+			if !p.beginRequest() {
+				return
+			}
+
 			err := p.handleRequestBlocks(ctx)
+			p.inFlight.Done()
+			p.lastActivity.Store(time.Now())
+
 			if err != nil {
-				go time.AfterFunc(time.Second, p.requestBlocks)
-				go func() {
-					select {
-					case p.peerErrorChan <- PeerError{id: p.id, err: err}:
-					case <-ctx.Done():
-					}
-				}()
+				go time.AfterFunc(time.Second, func() { p.requestBlocks(ctx) })
+				p.reportPeerError(err)
 			} else {
+				p.lastSeen.Store(time.Now())
 				if p.gossipVote != p.isSynced {
-					p.reportGossipVote(ctx)
+					p.reportGossipVote()
 				}
 				if p.isSynced {
-					go time.AfterFunc(p.opts.SyncedPingTime, p.requestBlocks)
+					go time.AfterFunc(p.opts.SyncedPingTime, func() { p.requestBlocks(ctx) })
 				} else {
-					go p.requestBlocks()
+					go p.requestBlocks(ctx)
 				}
 			}
 		}
@@ -210,22 +782,24 @@ func (p *PeerConnection) connectionLoop(ctx context.Context) {
 
 // Start syncing to the peer
 func (p *PeerConnection) Start(ctx context.Context) {
+	p.lastActivity.Store(time.Now())
+
+	go p.forwardGossipVotes(ctx)
+	go p.forwardPeerErrors(ctx)
+
 	go func() {
 		for {
 			// Does the handshake in a loop until we are successful
 			// or the connection is closed, sleeping between attempts
 			err := p.handshake(ctx)
+			p.lastActivity.Store(time.Now())
 			if err != nil {
-				go func() {
-					select {
-					case p.peerErrorChan <- PeerError{id: p.id, err: err}:
-					case <-ctx.Done():
-					}
-				}()
+				p.reportPeerError(err)
 			} else {
-				p.reportGossipVote(ctx)
+				p.lastSeen.Store(time.Now())
+				p.reportGossipVote()
 				go p.connectionLoop(ctx)
-				go p.requestBlocks()
+				go p.requestBlocks(ctx)
 				return
 			}
 			select {
@@ -238,7 +812,7 @@ func (p *PeerConnection) Start(ctx context.Context) {
 }
 
 // NewPeerConnection creates a PeerConnection
-func NewPeerConnection(id peer.ID, libProvider LastIrreversibleBlockProvider, localRPC rpc.LocalRPC, peerRPC rpc.RemoteRPC, peerErrorChan chan<- PeerError, gossipVoteChan chan<- GossipVote, opts *options.PeerConnectionOptions) *PeerConnection {
+func NewPeerConnection(id peer.ID, libProvider LastIrreversibleBlockProvider, localRPC rpc.LocalRPC, peerRPC rpc.RemoteRPC, peerErrorChan chan<- PeerError, gossipVoteChan chan<- GossipVote, handshakeSlots chan struct{}, clockMonitor *ClockMonitor, metrics *metrics.Collector, opts *options.PeerConnectionOptions) *PeerConnection {
 	return &PeerConnection{
 		id:               id,
 		isSynced:         false,
@@ -250,5 +824,10 @@ func NewPeerConnection(id peer.ID, libProvider LastIrreversibleBlockProvider, lo
 		peerRPC:          peerRPC,
 		peerErrorChan:    peerErrorChan,
 		gossipVoteChan:   gossipVoteChan,
+		handshakeSlots:   handshakeSlots,
+		clockMonitor:     clockMonitor,
+		metrics:          metrics,
+		errorQueue:       make(chan PeerError, opts.PeerErrorQueueSize),
+		voteQueue:        make(chan GossipVote, 1),
 	}
 }
@@ -0,0 +1,1034 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koinos/koinos-p2p/internal/metrics"
+	"github.com/koinos/koinos-p2p/internal/options"
+	"github.com/koinos/koinos-p2p/internal/p2perrors"
+	"github.com/koinos/koinos-p2p/internal/rpc"
+	"github.com/koinos/koinos-proto-golang/koinos"
+	"github.com/koinos/koinos-proto-golang/koinos/protocol"
+	"github.com/koinos/koinos-proto-golang/koinos/rpc/block_store"
+	"github.com/koinos/koinos-proto-golang/koinos/rpc/chain"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multihash"
+	"google.golang.org/protobuf/proto"
+)
+
+func testBlockID(height uint64) multihash.Multihash {
+	id, _ := multihash.Encode(make([]byte, 0), height)
+	return id
+}
+
+func testBlock(height uint64) *protocol.Block {
+	return &protocol.Block{
+		Id: testBlockID(height),
+		Header: &protocol.BlockHeader{
+			Height:   height,
+			Previous: testBlockID(height - 1),
+		},
+	}
+}
+
+type testLIBProvider struct {
+	height uint64
+}
+
+func (t *testLIBProvider) GetLastIrreversibleBlock() *koinos.BlockTopology {
+	return &koinos.BlockTopology{Id: testBlockID(t.height), Height: t.height}
+}
+
+type testLocalRPC struct {
+	chainID       uint64
+	headHeight    uint64
+	applyErr      error
+	appliedBlocks []*protocol.Block
+	rejectTrxErr  error
+	mutex         sync.Mutex
+
+	// GetChainID waits chainIDDelay, tracking the most concurrent calls
+	chainIDDelay    time.Duration
+	chainIDCalls    int
+	maxChainIDCalls int
+}
+
+func (t *testLocalRPC) GetHeadBlock(ctx context.Context) (*chain.GetHeadInfoResponse, error) {
+	return &chain.GetHeadInfoResponse{HeadTopology: &koinos.BlockTopology{Id: testBlockID(t.headHeight), Height: t.headHeight}}, nil
+}
+
+func (t *testLocalRPC) ApplyBlock(ctx context.Context, block *protocol.Block) (*chain.SubmitBlockResponse, error) {
+	if t.applyErr != nil {
+		return nil, t.applyErr
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.appliedBlocks = append(t.appliedBlocks, block)
+	return &chain.SubmitBlockResponse{}, nil
+}
+
+func (t *testLocalRPC) ApplyTransaction(ctx context.Context, trx *protocol.Transaction) (*chain.SubmitTransactionResponse, error) {
+	if t.rejectTrxErr != nil {
+		return nil, t.rejectTrxErr
+	}
+
+	return &chain.SubmitTransactionResponse{}, nil
+}
+
+func (t *testLocalRPC) GetBlocksByHeight(ctx context.Context, blockID multihash.Multihash, height uint64, numBlocks uint32) (*block_store.GetBlocksByHeightResponse, error) {
+	resp := &block_store.GetBlocksByHeightResponse{}
+	for i := uint64(0); i < uint64(numBlocks); i++ {
+		block := testBlock(height + i)
+		resp.BlockItems = append(resp.BlockItems, &block_store.BlockItem{
+			BlockId:     block.Id,
+			BlockHeight: block.Header.Height,
+			Block:       block,
+		})
+	}
+
+	return resp, nil
+}
+
+func (t *testLocalRPC) GetChainID(ctx context.Context) (*chain.GetChainIdResponse, error) {
+	if t.chainIDDelay > 0 {
+		t.mutex.Lock()
+		t.chainIDCalls++
+		if t.chainIDCalls > t.maxChainIDCalls {
+			t.maxChainIDCalls = t.chainIDCalls
+		}
+		t.mutex.Unlock()
+
+		time.Sleep(t.chainIDDelay)
+
+		t.mutex.Lock()
+		t.chainIDCalls--
+		t.mutex.Unlock()
+	}
+
+	return &chain.GetChainIdResponse{ChainId: testBlockID(t.chainID)}, nil
+}
+
+func (t *testLocalRPC) GetForkHeads(ctx context.Context) (*chain.GetForkHeadsResponse, error) {
+	return &chain.GetForkHeadsResponse{}, nil
+}
+
+func (t *testLocalRPC) GetBlocksByID(ctx context.Context, blockIDs []multihash.Multihash) (*block_store.GetBlocksByIdResponse, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	resp := &block_store.GetBlocksByIdResponse{}
+	for _, id := range blockIDs {
+		item := &block_store.BlockItem{}
+		for _, block := range t.appliedBlocks {
+			if string(block.Id) == string(id) {
+				item.BlockId = id
+				item.BlockHeight = block.Header.Height
+				item.Block = block
+			}
+		}
+		resp.BlockItems = append(resp.BlockItems, item)
+	}
+
+	return resp, nil
+}
+
+func (t *testLocalRPC) BroadcastGossipStatus(enabled bool) error {
+	return nil
+}
+
+func (t *testLocalRPC) BroadcastAddresses(announcement *rpc.AddressAnnouncement) error {
+	return nil
+}
+
+func (t *testLocalRPC) BroadcastReady(announcement *rpc.ReadyAnnouncement) error {
+	return nil
+}
+
+func (t *testLocalRPC) IsConnectedToBlockStore(ctx context.Context) (bool, error) {
+	return true, nil
+}
+
+func (t *testLocalRPC) IsConnectedToChain(ctx context.Context) (bool, error) {
+	return true, nil
+}
+
+func (t *testLocalRPC) numApplied() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return len(t.appliedBlocks)
+}
+
+type testRemoteRPC struct {
+	chainID       uint64
+	headHeight    uint64
+	forked        bool          // Ancestor block IDs do not match the local chain
+	noBlocks      bool          // GetBlocks returns no blocks
+	wrongBlock    bool          // GetBlocks returns a block from another chain in place of the last block
+	futureTime    bool          // GetBlocks returns blocks timestamped an hour in the future
+	chainIDErrors int           // GetChainID fails this many times before succeeding
+	blocksDelay   time.Duration // GetBlocks waits this long before returning
+	headDelay     time.Duration // GetHeadBlock waits this long before returning
+	servable      options.HeightRange
+	blocksCalls   int
+	lastBatchSize uint32
+	mutex         sync.Mutex
+}
+
+func (t *testRemoteRPC) GetChainID(ctx context.Context) (multihash.Multihash, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.chainIDErrors > 0 {
+		t.chainIDErrors--
+		return nil, p2perrors.ErrPeerRPC
+	}
+
+	return testBlockID(t.chainID), nil
+}
+
+func (t *testRemoteRPC) GetHeadBlock(ctx context.Context) (multihash.Multihash, uint64, error) {
+	select {
+	case <-time.After(t.headDelay):
+	case <-ctx.Done():
+		return nil, 0, ctx.Err()
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return testBlockID(t.headHeight), t.headHeight, nil
+}
+
+func (t *testRemoteRPC) GetAncestorBlockID(ctx context.Context, parentID multihash.Multihash, childHeight uint64) (multihash.Multihash, error) {
+	if t.forked {
+		return testBlockID(childHeight + 1000), nil
+	}
+
+	return testBlockID(childHeight), nil
+}
+
+func (t *testRemoteRPC) GetBlocks(ctx context.Context, headBlockID multihash.Multihash, startBlockHeight uint64, batchSize uint32) ([]protocol.Block, error) {
+	t.mutex.Lock()
+	t.blocksCalls++
+	t.lastBatchSize = batchSize
+	delay := t.blocksDelay
+	t.mutex.Unlock()
+
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if t.noBlocks {
+		return []protocol.Block{}, nil
+	}
+
+	blocks := make([]protocol.Block, 0, batchSize)
+	for i := uint64(0); i < uint64(batchSize); i++ {
+		blocks = append(blocks, *testBlock(startBlockHeight+i))
+	}
+
+	if t.futureTime {
+		for i := range blocks {
+			blocks[i].Header.Timestamp = uint64(time.Now().Add(time.Hour).UnixNano() / int64(time.Millisecond))
+		}
+	}
+
+	if t.wrongBlock {
+		last := &blocks[len(blocks)-1]
+		last.Id = testBlockID(last.Header.Height + 1000)
+		last.Header.Previous = testBlockID(last.Header.Height + 999)
+	}
+
+	return blocks, nil
+}
+
+func (t *testRemoteRPC) GetServableHeightRange(ctx context.Context) (uint64, uint64, error) {
+	return t.servable.Low, t.servable.High, nil
+}
+
+func newTestPeerConnection(localRPC *testLocalRPC, remoteRPC *testRemoteRPC, peerErrorChan chan<- PeerError, gossipVoteChan chan<- GossipVote, opts *options.PeerConnectionOptions) *PeerConnection {
+	return NewPeerConnection(
+		peer.ID("peerA"),
+		&testLIBProvider{height: 1},
+		localRPC,
+		remoteRPC,
+		peerErrorChan,
+		gossipVoteChan,
+		nil,
+		nil,
+		nil,
+		opts,
+	)
+}
+
+func TestPeerConnectionGossipVote(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	peerErrorChan := make(chan PeerError)
+	gossipVoteChan := make(chan GossipVote)
+	localRPC := &testLocalRPC{chainID: 1}
+	remoteRPC := &testRemoteRPC{chainID: 1, headHeight: 3}
+
+	peerConn := newTestPeerConnection(localRPC, remoteRPC, peerErrorChan, gossipVoteChan, options.NewPeerConnectionOptions())
+	peerConn.Start(ctx)
+
+	for _, expected := range []bool{false, true} {
+		select {
+		case vote := <-gossipVoteChan:
+			if vote.peer != "peerA" {
+				t.Errorf("Gossip vote from incorrect peer. Expected peerA, was %s", vote.peer)
+			}
+			if vote.synced != expected {
+				t.Errorf("Incorrect gossip vote. Expected %v, was %v", expected, vote.synced)
+			}
+		case err := <-peerErrorChan:
+			t.Fatalf("Unexpected peer error: %s", err.err)
+		case <-time.After(time.Second):
+			t.Fatalf("Expected gossip vote %v was never received", expected)
+		}
+	}
+
+	if localRPC.numApplied() != 2 {
+		t.Errorf("Incorrect number of blocks applied. Expected 2, was %v", localRPC.numApplied())
+	}
+
+	if !peerConn.IsSynced() {
+		t.Errorf("Expected peer connection to report synced")
+	}
+}
+
+func TestPeerConnectionStopWithPendingVote(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Nothing reads from the vote or error channels, so all sends must give up once the context is done
+	localRPC := &testLocalRPC{chainID: 1}
+	remoteRPC := &testRemoteRPC{chainID: 1, headHeight: 3}
+	opts := options.NewPeerConnectionOptions()
+	opts.SyncedPingTime = time.Millisecond * 50
+	peerConn := newTestPeerConnection(localRPC, remoteRPC, make(chan PeerError), make(chan GossipVote), opts)
+	peerConn.Start(ctx)
+
+	time.Sleep(time.Millisecond * 100)
+	cancel()
+
+	// Allow any pending sync timers to fire after the connection has stopped
+	time.Sleep(opts.SyncedPingTime * 2)
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	if runtime.NumGoroutine() > baseline {
+		t.Errorf("Peer connection goroutines blocked after stopping. Expected %v goroutines, was %v", baseline, runtime.NumGoroutine())
+	}
+}
+
+func TestPeerConnectionSlowConsumer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	// Every handshake fails until the peer's chain ID errors run out
+	const chainIDErrors = 20
+	remoteRPC := &testRemoteRPC{chainID: 1, headHeight: 3, chainIDErrors: chainIDErrors}
+	opts := options.NewPeerConnectionOptions()
+	opts.ChainIDRetries = 0
+	opts.HandshakeRetryTime = time.Millisecond
+	opts.PeerErrorQueueSize = 2
+
+	// Nothing reads from the channels until the handshake succeeds
+	peerErrorChan := make(chan PeerError)
+	gossipVoteChan := make(chan GossipVote)
+	collector := metrics.NewCollector()
+	peerConn := NewPeerConnection("peerA", &testLIBProvider{height: 1}, &testLocalRPC{chainID: 1}, remoteRPC, peerErrorChan, gossipVoteChan, nil, nil, collector, opts)
+	peerConn.Start(ctx)
+
+	for {
+		remoteRPC.mutex.Lock()
+		remaining := remoteRPC.chainIDErrors
+		remoteRPC.mutex.Unlock()
+
+		if remaining == 0 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Fatalf("Expected handshakes to continue while errors are not handled, %v attempts remaining", remaining)
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	// The latest vote is delivered once the consumer catches up
+	var vote GossipVote
+	for !vote.synced {
+		select {
+		case vote = <-gossipVoteChan:
+		case <-ctx.Done():
+			t.Fatal("Expected synced gossip vote")
+		}
+	}
+
+	families, err := collector.Registry().Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != "koinos_p2p_peer_errors_dropped_total" {
+			continue
+		}
+
+		// At most the queued errors, and one held by the forwarder, are not dropped
+		if dropped := family.GetMetric()[0].GetCounter().GetValue(); dropped < float64(chainIDErrors-1-opts.PeerErrorQueueSize) {
+			t.Errorf("Expected at least %v dropped peer errors, was %v", chainIDErrors-1-opts.PeerErrorQueueSize, dropped)
+		}
+		return
+	}
+
+	t.Error("Expected dropped peer errors to be recorded")
+}
+
+func TestPeerConnectionDisconnectErrorQueued(t *testing.T) {
+	opts := options.NewPeerConnectionOptions()
+	opts.PeerErrorQueueSize = 2
+	peerConn := newTestPeerConnection(&testLocalRPC{chainID: 1}, &testRemoteRPC{chainID: 1}, make(chan PeerError), make(chan GossipVote), opts)
+
+	// The connection is not started, so nothing is forwarded from the full queue
+	peerConn.reportPeerError(p2perrors.ErrPeerRPC)
+	peerConn.reportPeerError(p2perrors.ErrPeerRPCTimeout)
+	peerConn.reportPeerError(p2perrors.ErrChainIDMismatch)
+	peerConn.reportPeerError(p2perrors.ErrPeerRPC)
+
+	expected := []error{p2perrors.ErrPeerRPCTimeout, p2perrors.ErrChainIDMismatch}
+	for _, expectedErr := range expected {
+		select {
+		case peerErr := <-peerConn.errorQueue:
+			if !errors.Is(peerErr.err, expectedErr) {
+				t.Errorf("Expected queued error %v, was %v", expectedErr, peerErr.err)
+			}
+		default:
+			t.Fatalf("Expected queued error %v, the queue was empty", expectedErr)
+		}
+	}
+}
+
+func TestPeerConnectionErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		localRPC    *testLocalRPC
+		remoteRPC   *testRemoteRPC
+		checkpoints []options.Checkpoint
+		expected    error
+	}{
+		{
+			name:      "chain id mismatch",
+			localRPC:  &testLocalRPC{chainID: 1},
+			remoteRPC: &testRemoteRPC{chainID: 2, headHeight: 3},
+			expected:  p2perrors.ErrChainIDMismatch,
+		},
+		{
+			name:        "checkpoint mismatch",
+			localRPC:    &testLocalRPC{chainID: 1},
+			remoteRPC:   &testRemoteRPC{chainID: 1, headHeight: 3},
+			checkpoints: []options.Checkpoint{{BlockHeight: 2, BlockID: testBlockID(99)}},
+			expected:    p2perrors.ErrCheckpointMismatch,
+		},
+		{
+			name:      "chain not connected",
+			localRPC:  &testLocalRPC{chainID: 1},
+			remoteRPC: &testRemoteRPC{chainID: 1, headHeight: 3, forked: true},
+			expected:  p2perrors.ErrChainNotConnected,
+		},
+		{
+			name:      "no blocks",
+			localRPC:  &testLocalRPC{chainID: 1},
+			remoteRPC: &testRemoteRPC{chainID: 1, headHeight: 3, noBlocks: true},
+			expected:  p2perrors.ErrUnexpectedBlockCount,
+		},
+		{
+			name:      "block application",
+			localRPC:  &testLocalRPC{chainID: 1, applyErr: errors.New("invalid block")},
+			remoteRPC: &testRemoteRPC{chainID: 1, headHeight: 3},
+			expected:  p2perrors.ErrBlockApplication,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			opts := options.NewPeerConnectionOptions()
+			opts.Checkpoints = tt.checkpoints
+
+			peerErrorChan := make(chan PeerError)
+			peerConn := newTestPeerConnection(tt.localRPC, tt.remoteRPC, peerErrorChan, make(chan GossipVote, 1), opts)
+			peerConn.Start(ctx)
+
+			select {
+			case peerErr := <-peerErrorChan:
+				if !errors.Is(peerErr.err, tt.expected) {
+					t.Errorf("Unexpected peer error. Expected %v, was %v", tt.expected, peerErr.err)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Expected peer error %v was never received", tt.expected)
+			}
+		})
+	}
+}
+
+func TestPeerConnectionWrongBlock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	peerErrorChan := make(chan PeerError)
+	localRPC := &testLocalRPC{chainID: 1}
+	remoteRPC := &testRemoteRPC{chainID: 1, headHeight: 3, wrongBlock: true}
+
+	peerConn := newTestPeerConnection(localRPC, remoteRPC, peerErrorChan, make(chan GossipVote, 1), options.NewPeerConnectionOptions())
+	peerConn.Start(ctx)
+
+	select {
+	case peerErr := <-peerErrorChan:
+		if peerErr.id != "peerA" {
+			t.Errorf("Peer error for incorrect peer. Expected peerA, was %s", peerErr.id)
+		}
+		if !errors.Is(peerErr.err, p2perrors.ErrBlockMismatch) {
+			t.Errorf("Unexpected peer error. Expected %v, was %v", p2perrors.ErrBlockMismatch, peerErr.err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Peer returning the wrong block was never flagged")
+	}
+
+	if localRPC.numApplied() != 0 {
+		t.Errorf("Expected no blocks to be applied from a mismatched batch, was %v", localRPC.numApplied())
+	}
+
+	stats := peerConn.DownloadStats()
+	if stats.Failures != 1 || stats.Blocks != 0 || stats.SuccessRatio() != 0 {
+		t.Errorf("Expected mismatched batch to be counted as a failed download, was %+v", stats)
+	}
+}
+
+func TestPeerConnectionDownloadStats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const slowDelay = time.Millisecond * 20
+
+	peers := []struct {
+		id        peer.ID
+		remoteRPC *testRemoteRPC
+		blocks    uint64
+	}{
+		{id: "peerA", remoteRPC: &testRemoteRPC{chainID: 1, headHeight: 3}, blocks: 2},
+		{id: "peerB", remoteRPC: &testRemoteRPC{chainID: 1, headHeight: 5, blocksDelay: slowDelay}, blocks: 4},
+	}
+
+	peerConns := make([]*PeerConnection, len(peers))
+	gossipVoteChan := make(chan GossipVote)
+	for i, p := range peers {
+		peerConns[i] = NewPeerConnection(
+			p.id,
+			&testLIBProvider{height: 1},
+			&testLocalRPC{chainID: 1},
+			p.remoteRPC,
+			make(chan PeerError),
+			gossipVoteChan,
+			nil,
+			nil,
+			nil,
+			options.NewPeerConnectionOptions(),
+		)
+		peerConns[i].Start(ctx)
+	}
+
+	// Each peer sends a synced vote once its blocks have been downloaded and applied
+	synced := make(map[peer.ID]bool)
+	for len(synced) < len(peers) {
+		select {
+		case vote := <-gossipVoteChan:
+			if vote.synced {
+				synced[vote.peer] = true
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Peer connections never synced")
+		}
+	}
+
+	for i, p := range peers {
+		stats := peerConns[i].DownloadStats()
+		if stats.Requests != 1 || stats.Failures != 0 {
+			t.Errorf("Expected one successful request from %s, was %v requests and %v failures", p.id, stats.Requests, stats.Failures)
+		}
+		if stats.Blocks != p.blocks {
+			t.Errorf("Incorrect blocks downloaded from %s. Expected %v, was %v", p.id, p.blocks, stats.Blocks)
+		}
+		if stats.Bytes == 0 {
+			t.Errorf("Expected bytes downloaded from %s to be counted", p.id)
+		}
+		if stats.SuccessRatio() != 1 {
+			t.Errorf("Incorrect success ratio for %s. Expected 1, was %v", p.id, stats.SuccessRatio())
+		}
+	}
+
+	if stats := peerConns[1].DownloadStats(); stats.AverageLatency() < slowDelay {
+		t.Errorf("Expected average latency from peerB of at least %s, was %s", slowDelay, stats.AverageLatency())
+	}
+
+	if peerConns[1].DownloadStats().Bytes <= peerConns[0].DownloadStats().Bytes {
+		t.Error("Expected more bytes downloaded from the peer that sent more blocks")
+	}
+}
+
+func TestPeerConnectionBlocksDownloaded(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	collector := metrics.NewCollector()
+	peerConn := NewPeerConnection(
+		peer.ID("peerA"),
+		&testLIBProvider{height: 1},
+		&testLocalRPC{chainID: 1},
+		&testRemoteRPC{chainID: 1, headHeight: 3},
+		make(chan PeerError),
+		make(chan GossipVote),
+		nil,
+		nil,
+		collector,
+		options.NewPeerConnectionOptions(),
+	)
+
+	if err := peerConn.handleRequestBlocks(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	families, err := collector.Registry().Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != "koinos_p2p_blocks_downloaded_total" {
+			continue
+		}
+
+		if downloaded := family.GetMetric()[0].GetCounter().GetValue(); downloaded != 2 {
+			t.Errorf("Incorrect downloaded blocks metric. Expected 2, was %v", downloaded)
+		}
+		return
+	}
+
+	t.Error("Expected downloaded blocks to be recorded")
+}
+
+func TestPeerConnectionSkipAppliedBlocks(t *testing.T) {
+	for _, skip := range []bool{true, false} {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		// The block at height 2 has already been applied, the peer's head is at height 3
+		localRPC := &testLocalRPC{chainID: 1, appliedBlocks: []*protocol.Block{testBlock(2)}}
+		remoteRPC := &testRemoteRPC{chainID: 1, headHeight: 3}
+		gossipVoteChan := make(chan GossipVote)
+
+		opts := options.NewPeerConnectionOptions()
+		opts.SkipAppliedBlocks = skip
+		peerConn := newTestPeerConnection(localRPC, remoteRPC, make(chan PeerError), gossipVoteChan, opts)
+		peerConn.Start(ctx)
+
+		// Wait for the synced vote, sent after the first batch is applied
+		for synced := false; !synced; {
+			select {
+			case vote := <-gossipVoteChan:
+				synced = vote.synced
+			case <-time.After(time.Second):
+				t.Fatal("Peer connection never synced")
+			}
+		}
+		cancel()
+
+		expected := 2
+		if !skip {
+			expected = 3
+		}
+
+		if localRPC.numApplied() != expected {
+			t.Errorf("Incorrect number of blocks applied with SkipAppliedBlocks %v. Expected %v, was %v", skip, expected, localRPC.numApplied())
+		}
+	}
+}
+
+func TestPeerConnectionClockSkew(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	peerErrorChan := make(chan PeerError)
+	localRPC := &testLocalRPC{chainID: 1}
+	remoteRPC := &testRemoteRPC{chainID: 1, headHeight: 3, futureTime: true}
+
+	peerConn := newTestPeerConnection(localRPC, remoteRPC, peerErrorChan, make(chan GossipVote, 1), options.NewPeerConnectionOptions())
+	peerConn.Start(ctx)
+
+	select {
+	case peerErr := <-peerErrorChan:
+		if !errors.Is(peerErr.err, p2perrors.ErrClockSkew) {
+			t.Errorf("Unexpected peer error. Expected %v, was %v", p2perrors.ErrClockSkew, peerErr.err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Peer with a skewed clock was never flagged")
+	}
+
+	if localRPC.numApplied() != 0 {
+		t.Errorf("Expected no blocks to be applied from a skewed peer, was %v", localRPC.numApplied())
+	}
+}
+
+func TestCheckClockSkew(t *testing.T) {
+	now := time.Now()
+	blocks := []protocol.Block{*testBlock(2)}
+
+	tests := []struct {
+		name    string
+		offset  time.Duration
+		maxSkew time.Duration
+		skewed  bool
+	}{
+		{"past", -time.Hour, time.Minute, false},
+		{"within", time.Second * 30, time.Minute, false},
+		{"ahead", time.Minute * 2, time.Minute, true},
+		{"disabled", time.Hour, 0, false},
+	}
+
+	for _, test := range tests {
+		blocks[0].Header.Timestamp = uint64(now.Add(test.offset).UnixNano() / int64(time.Millisecond))
+		err := checkClockSkew(blocks, now, test.maxSkew)
+		if errors.Is(err, p2perrors.ErrClockSkew) != test.skewed {
+			t.Errorf("%s: expected skewed %v, error was %v", test.name, test.skewed, err)
+		}
+	}
+}
+
+func TestPeerConnectionChainIDRetry(t *testing.T) {
+	for _, retries := range []uint{2, 1} {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		peerErrorChan := make(chan PeerError)
+		gossipVoteChan := make(chan GossipVote)
+		remoteRPC := &testRemoteRPC{chainID: 1, headHeight: 3, chainIDErrors: 2}
+
+		opts := options.NewPeerConnectionOptions()
+		opts.ChainIDRetries = retries
+		opts.ChainIDRetryDelay = time.Millisecond * 10
+		peerConn := newTestPeerConnection(&testLocalRPC{chainID: 1}, remoteRPC, peerErrorChan, gossipVoteChan, opts)
+		peerConn.Start(ctx)
+
+		select {
+		case <-gossipVoteChan:
+			if retries < 2 {
+				t.Errorf("Expected handshake to fail with %v retries", retries)
+			}
+		case peerErr := <-peerErrorChan:
+			if retries >= 2 {
+				t.Errorf("Unexpected peer error with %v retries: %s", retries, peerErr.err)
+			} else if !errors.Is(peerErr.err, p2perrors.ErrPeerRPC) {
+				t.Errorf("Unexpected peer error. Expected %v, was %v", p2perrors.ErrPeerRPC, peerErr.err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Handshake with %v retries never completed", retries)
+		}
+
+		cancel()
+	}
+}
+
+func TestPeerConnectionHeadRegression(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	remoteRPC := &testRemoteRPC{chainID: 1}
+	opts := options.NewPeerConnectionOptions()
+	opts.HeadRegressionDepth = 5
+	opts.HeadRegressionLimit = 2
+	peerConn := newTestPeerConnection(&testLocalRPC{chainID: 1}, remoteRPC, make(chan PeerError), make(chan GossipVote), opts)
+
+	// Moving back within the regression depth is a normal reorg, moving back further is a regression
+	heads := []struct {
+		height    uint64
+		regressed bool
+	}{
+		{20, false},
+		{16, false},
+		{30, false},
+		{10, false},
+		{30, false},
+		{10, true},
+		{30, false},
+		{10, false},
+	}
+
+	for i, head := range heads {
+		remoteRPC.mutex.Lock()
+		remoteRPC.headHeight = head.height
+		remoteRPC.mutex.Unlock()
+
+		err := peerConn.handleRequestBlocks(ctx)
+		if errors.Is(err, p2perrors.ErrHeadRegression) != head.regressed {
+			t.Errorf("Head %v at height %v: expected regression %v, error was %v", i, head.height, head.regressed, err)
+		}
+	}
+}
+
+func TestPeerConnectionBlockRequestLimit(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	remoteRPC := &testRemoteRPC{chainID: 1, headHeight: 2000}
+	opts := options.NewPeerConnectionOptions()
+	opts.BlockRequestMaxBytes = uint64(10 * proto.Size(testBlock(1000)))
+	peerConn := newTestPeerConnection(&testLocalRPC{chainID: 1}, remoteRPC, make(chan PeerError), make(chan GossipVote), opts)
+
+	if err := peerConn.handshake(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Before the peer's block size is known, a full batch is requested
+	if err := peerConn.handleRequestBlocks(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if remoteRPC.lastBatchSize != uint32(opts.BlockRequestBatchSize) {
+		t.Errorf("Expected a full batch of %v blocks to be requested, was %v", opts.BlockRequestBatchSize, remoteRPC.lastBatchSize)
+	}
+
+	// Afterwards, only as many blocks as fit in BlockRequestMaxBytes are requested
+	if err := peerConn.handleRequestBlocks(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if remoteRPC.lastBatchSize < 5 || remoteRPC.lastBatchSize > 15 {
+		t.Errorf("Expected about 10 blocks to be requested, was %v", remoteRPC.lastBatchSize)
+	}
+
+	// Blocks larger than the limit are still requested one at a time
+	peerConn.blockSize = opts.BlockRequestMaxBytes * 2
+	if limit := peerConn.blockRequestLimit(); limit != 1 {
+		t.Errorf("Expected one block to be requested, was %v", limit)
+	}
+}
+
+func TestPeerConnectionAdaptiveTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	remoteRPC := &testRemoteRPC{chainID: 1, headHeight: 1000, blocksDelay: time.Millisecond}
+	opts := options.NewPeerConnectionOptions()
+	opts.BlockRequestBatchSize = 10
+	opts.BlockRequestTimeout = time.Second
+	opts.BlockRequestTimeoutMultiplier = 2
+	opts.MinBlockRequestTimeout = time.Millisecond * 50
+	opts.MaxBlockRequestTimeout = time.Millisecond * 200
+	opts.SlowRequestLimit = 2
+	peerConn := newTestPeerConnection(&testLocalRPC{chainID: 1}, remoteRPC, make(chan PeerError), make(chan GossipVote), opts)
+
+	if timeout := peerConn.blockRequestTimeout(opts.BlockRequestBatchSize); timeout != opts.MaxBlockRequestTimeout {
+		t.Errorf("Expected initial timeout to be clamped to %s, was %s", opts.MaxBlockRequestTimeout, timeout)
+	}
+
+	// A fast peer's timeout shrinks to the minimum
+	if err := peerConn.handleRequestBlocks(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if timeout := peerConn.blockRequestTimeout(opts.BlockRequestBatchSize); timeout != opts.MinBlockRequestTimeout {
+		t.Errorf("Expected fast peer timeout of %s, was %s", opts.MinBlockRequestTimeout, timeout)
+	}
+
+	// Once the peer slows down, its timeout grows to the maximum, after which it is reported
+	remoteRPC.mutex.Lock()
+	remoteRPC.blocksDelay = time.Second
+	remoteRPC.mutex.Unlock()
+
+	var err error
+	for i := 0; i < 20 && !errors.Is(err, p2perrors.ErrSlowPeer); i++ {
+		err = peerConn.handleRequestBlocks(ctx)
+		if err == nil {
+			t.Fatal("Expected block request to a slow peer to time out")
+		}
+	}
+
+	if !errors.Is(err, p2perrors.ErrSlowPeer) {
+		t.Errorf("Expected ErrSlowPeer, was %v", err)
+	}
+	if timeout := peerConn.blockRequestTimeout(opts.BlockRequestBatchSize); timeout != opts.MaxBlockRequestTimeout {
+		t.Errorf("Expected slow peer timeout of %s, was %s", opts.MaxBlockRequestTimeout, timeout)
+	}
+
+	// Latency is tracked per block, so a single block poll does not shorten the timeout of a full batch
+	opts.MaxBlockRequestTimeout = time.Second
+	peerConn.blockLatency = 0
+	if err := peerConn.updateRequestLatency(opts.MaxBlockRequestTimeout, time.Millisecond*10, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if timeout := peerConn.blockRequestTimeout(1); timeout != opts.MinBlockRequestTimeout {
+		t.Errorf("Expected single block timeout of %s, was %s", opts.MinBlockRequestTimeout, timeout)
+	}
+	if timeout := peerConn.blockRequestTimeout(opts.BlockRequestBatchSize); timeout != time.Millisecond*200 {
+		t.Errorf("Expected batch timeout of %s, was %s", time.Millisecond*200, timeout)
+	}
+
+	// Without a multiplier the timeout is fixed
+	opts.BlockRequestTimeoutMultiplier = 0
+	if timeout := peerConn.blockRequestTimeout(opts.BlockRequestBatchSize); timeout != opts.BlockRequestTimeout {
+		t.Errorf("Expected fixed timeout of %s, was %s", opts.BlockRequestTimeout, timeout)
+	}
+}
+
+func (t *testRemoteRPC) numBlocksCalls() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.blocksCalls
+}
+
+func TestPeerConnectionStop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	peerErrorChan := make(chan PeerError)
+	localRPC := &testLocalRPC{chainID: 1}
+	remoteRPC := &testRemoteRPC{chainID: 1, headHeight: 1000, blocksDelay: time.Millisecond * 100}
+	opts := options.NewPeerConnectionOptions()
+	opts.BlockRequestBatchSize = 10
+
+	peerConn := newTestPeerConnection(localRPC, remoteRPC, peerErrorChan, make(chan GossipVote, 10), opts)
+	peerConn.Start(ctx)
+
+	for remoteRPC.numBlocksCalls() == 0 {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	peerConn.Stop()
+	peerConn.Wait()
+
+	// The request in flight when stopped finishes, but no more are made
+	calls := remoteRPC.numBlocksCalls()
+	if localRPC.numApplied() != calls*int(opts.BlockRequestBatchSize) {
+		t.Errorf("Expected the request in flight to finish. Expected %v blocks applied, was %v", calls*int(opts.BlockRequestBatchSize), localRPC.numApplied())
+	}
+
+	select {
+	case err := <-peerErrorChan:
+		t.Fatalf("Unexpected peer error: %s", err.err)
+	case <-time.After(remoteRPC.blocksDelay * 3):
+	}
+
+	if remoteRPC.numBlocksCalls() != calls {
+		t.Errorf("Expected no requests after stopping. Expected %v, was %v", calls, remoteRPC.numBlocksCalls())
+	}
+}
+
+func TestPeerConnectionMaxHandshakes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const numPeers = 8
+	const maxHandshakes = 2
+
+	localRPC := &testLocalRPC{chainID: 1, chainIDDelay: time.Millisecond * 50}
+	gossipVoteChan := make(chan GossipVote, numPeers*2)
+	handshakeSlots := make(chan struct{}, maxHandshakes)
+
+	// Peers that stall the handshake must not hold a slot while other handshakes wait
+	for i := 0; i < maxHandshakes; i++ {
+		stalled := NewPeerConnection(
+			peer.ID(fmt.Sprintf("stalled%v", i)),
+			&testLIBProvider{height: 1},
+			localRPC,
+			&testRemoteRPC{chainID: 1, headHeight: 1, headDelay: time.Minute},
+			make(chan PeerError, 1),
+			make(chan GossipVote, 1),
+			handshakeSlots,
+			nil,
+			nil,
+			options.NewPeerConnectionOptions(),
+		)
+		stalled.Start(ctx)
+	}
+
+	for i := 0; i < numPeers; i++ {
+		peerConn := NewPeerConnection(
+			peer.ID(fmt.Sprintf("peer%v", i)),
+			&testLIBProvider{height: 1},
+			localRPC,
+			&testRemoteRPC{chainID: 1, headHeight: 1},
+			make(chan PeerError, 1),
+			gossipVoteChan,
+			handshakeSlots,
+			nil,
+			nil,
+			options.NewPeerConnectionOptions(),
+		)
+		peerConn.Start(ctx)
+	}
+
+	// Each peer votes once its handshake is done
+	for i := 0; i < numPeers; i++ {
+		select {
+		case <-gossipVoteChan:
+		case <-time.After(time.Second * 5):
+			t.Fatalf("Expected %v handshakes to finish, %v did", numPeers, i)
+		}
+	}
+
+	localRPC.mutex.Lock()
+	defer localRPC.mutex.Unlock()
+	if localRPC.maxChainIDCalls > maxHandshakes {
+		t.Errorf("Expected at most %v concurrent handshakes, was %v", maxHandshakes, localRPC.maxChainIDCalls)
+	}
+}
+
+func TestPeerConnectionServableRange(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	// The peer only serves blocks above the local LIB's next block
+	localRPC := &testLocalRPC{chainID: 1}
+	remoteRPC := &testRemoteRPC{chainID: 1, headHeight: 10, servable: options.HeightRange{Low: 5}}
+	peerConn := newTestPeerConnection(localRPC, remoteRPC, make(chan PeerError), make(chan GossipVote), options.NewPeerConnectionOptions())
+
+	if err := peerConn.handshake(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := peerConn.handleRequestBlocks(ctx); !errors.Is(err, p2perrors.ErrHeightNotServable) {
+		t.Errorf("Expected ErrHeightNotServable, was %v", err)
+	}
+	if localRPC.numApplied() != 0 {
+		t.Errorf("Expected no blocks from a peer that can not serve them, applied %v blocks", localRPC.numApplied())
+	}
+
+	// Requests to a peer serving heights up to 3 stop at height 3
+	remoteRPC.servable = options.HeightRange{High: 3}
+	if err := peerConn.handshake(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := peerConn.handleRequestBlocks(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if localRPC.numApplied() != 2 {
+		t.Errorf("Expected blocks 2-3 to be applied, applied %v blocks", localRPC.numApplied())
+	}
+}
@@ -0,0 +1,126 @@
+package p2p
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/koinos/koinos-p2p/internal/options"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// RegistryEntry describes a peer permitted by the registry
+type RegistryEntry struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// registryFile is the registry file format. Signature is the base64 encoded signature
+// of the exact bytes of the peers array, as they appear in the file.
+type registryFile struct {
+	Peers     json.RawMessage `json:"peers"`
+	Signature string          `json:"signature"`
+}
+
+// PeerRegistry is a verified set of the peers allowed to connect on a permissioned network
+type PeerRegistry struct {
+	peers      map[peer.ID]RegistryEntry
+	roleLimits map[string]int
+}
+
+// LoadPeerRegistry reads the registry at opts.Path and verifies it was signed by opts.PublicKey.
+// It returns nil if no registry is configured.
+func LoadPeerRegistry(opts *options.RegistryOptions) (*PeerRegistry, error) {
+	if opts.Path == "" {
+		return nil, nil
+	}
+
+	if opts.PublicKey == "" {
+		return nil, errors.New("a registry public key is required to verify the peer registry")
+	}
+
+	keyData, err := base64.StdEncoding.DecodeString(opts.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode registry public key: %w", err)
+	}
+
+	publicKey, err := crypto.UnmarshalPublicKey(keyData)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse registry public key: %w", err)
+	}
+
+	data, err := ioutil.ReadFile(opts.Path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read peer registry %s: %w", opts.Path, err)
+	}
+
+	file := registryFile{}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("could not parse peer registry %s: %w", opts.Path, err)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(file.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode peer registry signature: %w", err)
+	}
+
+	valid, err := publicKey.Verify(file.Peers, signature)
+	if err != nil {
+		return nil, fmt.Errorf("could not verify peer registry signature: %w", err)
+	}
+	if !valid {
+		return nil, fmt.Errorf("peer registry %s is not signed by the registry public key", opts.Path)
+	}
+
+	entries := make([]RegistryEntry, 0)
+	if err := json.Unmarshal(file.Peers, &entries); err != nil {
+		return nil, fmt.Errorf("could not parse peer registry %s: %w", opts.Path, err)
+	}
+
+	registry := &PeerRegistry{peers: make(map[peer.ID]RegistryEntry), roleLimits: opts.RoleLimits}
+	for _, entry := range entries {
+		id, err := peer.Decode(entry.ID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer ID %s in peer registry: %w", entry.ID, err)
+		}
+		registry.peers[id] = entry
+	}
+
+	return registry, nil
+}
+
+// Lookup returns the registry entry of the peer, if it is registered
+func (r *PeerRegistry) Lookup(id peer.ID) (RegistryEntry, bool) {
+	entry, ok := r.peers[id]
+	return entry, ok
+}
+
+// RoleLimit returns the role of the peer and the limit on connected peers with that role. It returns false
+// if there is no registry, the peer is not registered, or its role is not limited.
+func (r *PeerRegistry) RoleLimit(id peer.ID) (string, int, bool) {
+	if r == nil {
+		return "", 0, false
+	}
+
+	entry, ok := r.peers[id]
+	if !ok {
+		return "", 0, false
+	}
+
+	limit, ok := r.roleLimits[entry.Role]
+	return entry.Role, limit, ok
+}
+
+// IsRegistered returns true if there is no registry, or if the peer is registered
+func (r *PeerRegistry) IsRegistered(id peer.ID) bool {
+	if r == nil {
+		return true
+	}
+
+	_, ok := r.peers[id]
+	return ok
+}
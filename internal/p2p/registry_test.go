@@ -0,0 +1,139 @@
+package p2p
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/koinos/koinos-p2p/internal/options"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/test"
+)
+
+// writeTestRegistry writes a registry of the given entries signed by key, and returns its path
+func writeTestRegistry(t *testing.T, key crypto.PrivKey, entries []RegistryEntry) string {
+	peers, err := json.Marshal(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature, err := key.Sign(peers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(registryFile{Peers: peers, Signature: base64.StdEncoding.EncodeToString(signature)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := ioutil.TempFile("", "registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		t.Fatal(err)
+	}
+
+	return file.Name()
+}
+
+func testRegistryOptions(t *testing.T, key crypto.PrivKey, path string) *options.RegistryOptions {
+	keyData, err := crypto.MarshalPublicKey(key.GetPublic())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := options.NewRegistryOptions()
+	opts.Path = path
+	opts.PublicKey = base64.StdEncoding.EncodeToString(keyData)
+	return opts
+}
+
+func TestPeerRegistry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registered, err := test.RandPeerID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unregistered, err := test.RandPeerID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := writeTestRegistry(t, key, []RegistryEntry{{ID: registered.String(), Name: "validator-1", Role: "producer"}})
+	defer os.Remove(path)
+
+	registry, err := LoadPeerRegistry(testRegistryOptions(t, key, path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entry, ok := registry.Lookup(registered); !ok || entry.Name != "validator-1" || entry.Role != "producer" {
+		t.Errorf("Incorrect registry entry for registered peer, was %+v", entry)
+	}
+
+	errorHandler := NewPeerErrorHandler(make(chan peer.ID), make(chan PeerError), make(chan peer.ID), nil, registry, nil, *options.NewPeerErrorHandlerOptions())
+	errorHandler.Start(ctx)
+
+	if !errorHandler.InterceptSecured(network.DirInbound, registered, nil) {
+		t.Error("Expected connection from registered peer to be accepted")
+	}
+	if !errorHandler.InterceptPeerDial(registered) {
+		t.Error("Expected dial to registered peer to be accepted")
+	}
+	if errorHandler.InterceptSecured(network.DirInbound, unregistered, nil) {
+		t.Error("Expected connection from unregistered peer to be rejected")
+	}
+	if errorHandler.InterceptPeerDial(unregistered) {
+		t.Error("Expected dial to unregistered peer to be rejected")
+	}
+}
+
+func TestPeerRegistrySignature(t *testing.T) {
+	key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherKey, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := test.RandPeerID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := writeTestRegistry(t, otherKey, []RegistryEntry{{ID: id.String()}})
+	defer os.Remove(path)
+
+	if _, err := LoadPeerRegistry(testRegistryOptions(t, key, path)); err == nil {
+		t.Error("Expected registry signed by another key to be rejected")
+	}
+
+	registry, err := LoadPeerRegistry(options.NewRegistryOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !registry.IsRegistered(id) {
+		t.Error("Expected every peer to be allowed without a registry")
+	}
+}
@@ -0,0 +1,64 @@
+package p2p
+
+import (
+	"sync"
+
+	log "github.com/koinos/koinos-log-golang"
+	"github.com/koinos/koinos-p2p/internal/options"
+	util "github.com/koinos/koinos-util-golang"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// Whitelist is the set of peers allowed to connect when a whitelist is configured.
+// It is shared by the connection gater, which enforces it, and the connection manager,
+// which adds the initial and direct peers as they become known.
+type Whitelist struct {
+	peers map[peer.ID]util.Void
+	mutex sync.RWMutex
+}
+
+// NewWhitelist creates a Whitelist of the configured peers. It returns nil if no peers are
+// configured, in which case every peer is allowed.
+func NewWhitelist(opts *options.WhitelistOptions) *Whitelist {
+	if len(opts.Peers) == 0 {
+		return nil
+	}
+
+	w := &Whitelist{peers: make(map[peer.ID]util.Void)}
+	for _, idStr := range opts.Peers {
+		id, err := peer.Decode(idStr)
+		if err != nil {
+			log.Warnf("Error parsing whitelisted peer ID: %v", err)
+			continue
+		}
+
+		w.peers[id] = util.Void{}
+	}
+
+	return w
+}
+
+// Allow adds the peer to the whitelist. It does nothing if there is no whitelist.
+func (w *Whitelist) Allow(id peer.ID) {
+	if w == nil {
+		return
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.peers[id] = util.Void{}
+}
+
+// IsAllowed returns true if there is no whitelist, or if the peer is whitelisted
+func (w *Whitelist) IsAllowed(id peer.ID) bool {
+	if w == nil {
+		return true
+	}
+
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	_, ok := w.peers[id]
+	return ok
+}
@@ -2,12 +2,14 @@ package p2p
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/koinos/koinos-p2p/internal/node"
 	"github.com/koinos/koinos-p2p/internal/options"
+	"github.com/koinos/koinos-p2p/internal/p2perrors"
 	"github.com/koinos/koinos-p2p/internal/rpc"
 	"github.com/koinos/koinos-proto-golang/koinos"
 	"github.com/koinos/koinos-proto-golang/koinos/protocol"
@@ -30,9 +32,24 @@ type TestRPC struct {
 	ApplyBlocks      int    // Number of blocks to apply before failure. < 0 = always apply
 	BlocksApplied    []*protocol.Block
 	BlocksByID       map[string]*protocol.Block
+	Latency          time.Duration // Simulated network latency added to each request served to a peer
+	Announcements    []*rpc.AddressAnnouncement
+	ReadyEvents      []*rpc.ReadyAnnouncement
 	Mutex            sync.Mutex
 }
 
+// simulateLatency() blocks for the configured latency or until the context is done
+func (k *TestRPC) simulateLatency(ctx context.Context) {
+	if k.Latency <= 0 {
+		return
+	}
+
+	select {
+	case <-time.After(k.Latency):
+	case <-ctx.Done():
+	}
+}
+
 // getDummyBlockIDAtHeight() gets the ID of the dummy block at the given height
 func (k *TestRPC) getDummyBlockIDAtHeight(height uint64) multihash.Multihash {
 	result, _ := multihash.Encode(make([]byte, 0), height+k.HeadBlockIDDelta)
@@ -67,6 +84,8 @@ func (k *TestRPC) createDummyBlock(height uint64) *protocol.Block {
 
 // GetHeadBlock rpc call
 func (k *TestRPC) GetHeadBlock(ctx context.Context) (*chain.GetHeadInfoResponse, error) {
+	k.simulateLatency(ctx)
+
 	k.Mutex.Lock()
 	defer k.Mutex.Unlock()
 
@@ -110,6 +129,22 @@ func (k *TestRPC) BroadcastGossipStatus(enabled bool) error {
 	return nil
 }
 
+func (k *TestRPC) BroadcastAddresses(announcement *rpc.AddressAnnouncement) error {
+	k.Mutex.Lock()
+	defer k.Mutex.Unlock()
+
+	k.Announcements = append(k.Announcements, announcement)
+	return nil
+}
+
+func (k *TestRPC) BroadcastReady(announcement *rpc.ReadyAnnouncement) error {
+	k.Mutex.Lock()
+	defer k.Mutex.Unlock()
+
+	k.ReadyEvents = append(k.ReadyEvents, announcement)
+	return nil
+}
+
 func (k *TestRPC) GetBlocksByID(ctx context.Context, blockIDs []multihash.Multihash) (*block_store.GetBlocksByIdResponse, error) {
 	k.Mutex.Lock()
 	defer k.Mutex.Unlock()
@@ -131,6 +166,8 @@ func (k *TestRPC) GetBlocksByID(ctx context.Context, blockIDs []multihash.Multih
 
 // GetBlocksByHeight rpc call
 func (k *TestRPC) GetBlocksByHeight(ctx context.Context, blockID multihash.Multihash, height uint64, numBlocks uint32) (*block_store.GetBlocksByHeightResponse, error) {
+	k.simulateLatency(ctx)
+
 	k.Mutex.Lock()
 	defer k.Mutex.Unlock()
 
@@ -153,6 +190,8 @@ func (k *TestRPC) GetBlocksByHeight(ctx context.Context, blockID multihash.Multi
 
 // GetChainID rpc call
 func (k *TestRPC) GetChainID(ctx context.Context) (*chain.GetChainIdResponse, error) {
+	k.simulateLatency(ctx)
+
 	mh := &chain.GetChainIdResponse{}
 	mh.ChainId, _ = multihash.Encode(make([]byte, 0), k.ChainID)
 	return mh, nil
@@ -234,8 +273,8 @@ func TestSyncNoError(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	defer listenNode.Close()
-	defer sendNode.Close()
+	defer listenNode.Close(context.Background())
+	defer sendNode.Close(context.Background())
 
 	p, _ := peer.AddrInfoFromP2pAddr(addr)
 	err = sendNode.ConnectToPeerAddress(context.Background(), p)
@@ -254,6 +293,50 @@ func TestSyncNoError(t *testing.T) {
 	}
 }
 
+func TestSyncWithLatency(t *testing.T) {
+	listenRPC := NewTestRPC(128)
+	listenRPC.Latency = time.Millisecond * 100
+	sendRPC := NewTestRPC(5)
+	listenNode, sendNode, addr, _, err := createTestClients(listenRPC, options.NewConfig(), sendRPC, options.NewConfig())
+	if err != nil {
+		t.Error(err)
+	}
+	defer listenNode.Close(context.Background())
+	defer sendNode.Close(context.Background())
+
+	start := time.Now()
+	p, _ := peer.AddrInfoFromP2pAddr(addr)
+	err = sendNode.ConnectToPeerAddress(context.Background(), p)
+	if err != nil {
+		t.Error(err)
+	}
+
+	budget := time.Second * 3
+	for time.Since(start) < budget {
+		sendRPC.Mutex.Lock()
+		applied := len(sendRPC.BlocksApplied)
+		sendRPC.Mutex.Unlock()
+
+		if applied == 123 {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	elapsed := time.Since(start)
+
+	sendRPC.Mutex.Lock()
+	defer sendRPC.Mutex.Unlock()
+
+	if len(sendRPC.BlocksApplied) != 123 {
+		t.Errorf("Sync did not converge within %v. Expected 123 blocks applied, was %v", budget, len(sendRPC.BlocksApplied))
+	}
+
+	// The handshake and first sync cycle require at least four round trips to the peer
+	if elapsed < listenRPC.Latency*4 {
+		t.Errorf("Sync completed in %v, faster than the simulated latency allows", elapsed)
+	}
+}
+
 // Test different chain IDs
 func TestSyncChainID(t *testing.T) {
 	listenRPC := NewTestRPC(128)
@@ -263,8 +346,8 @@ func TestSyncChainID(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	defer listenNode.Close()
-	defer sendNode.Close()
+	defer listenNode.Close(context.Background())
+	defer sendNode.Close(context.Background())
 
 	p, _ := peer.AddrInfoFromP2pAddr(addr)
 	err = sendNode.ConnectToPeerAddress(context.Background(), p)
@@ -293,8 +376,8 @@ func TestApplyBlockFailure(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	defer listenNode.Close()
-	defer sendNode.Close()
+	defer listenNode.Close(context.Background())
+	defer sendNode.Close(context.Background())
 
 	p, _ := peer.AddrInfoFromP2pAddr(addr)
 	err = sendNode.ConnectToPeerAddress(context.Background(), p)
@@ -321,8 +404,8 @@ func TestCheckpointFailure(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	defer listenNode.Close()
-	defer sendNode.Close()
+	defer listenNode.Close(context.Background())
+	defer sendNode.Close(context.Background())
 
 	p, _ := peer.AddrInfoFromP2pAddr(addr)
 	err = sendNode.ConnectToPeerAddress(context.Background(), p)
@@ -339,3 +422,354 @@ func TestCheckpointFailure(t *testing.T) {
 		t.Errorf("Incorrect number of blocks applied, expected %d, got %d", expectedBlocksApplied, len(sendRPC.BlocksApplied))
 	}
 }
+
+func TestNodeStatus(t *testing.T) {
+	listenRPC := NewTestRPC(128)
+	sendRPC := NewTestRPC(5)
+	listenNode, sendNode, addr, _, err := createTestClients(listenRPC, options.NewConfig(), sendRPC, options.NewConfig())
+	if err != nil {
+		t.Error(err)
+	}
+	defer listenNode.Close(context.Background())
+	defer sendNode.Close(context.Background())
+
+	p, _ := peer.AddrInfoFromP2pAddr(addr)
+	err = sendNode.ConnectToPeerAddress(context.Background(), p)
+	if err != nil {
+		t.Error(err)
+	}
+
+	time.Sleep(time.Duration(3000) * time.Duration(time.Millisecond))
+
+	status := sendNode.GetStatus(context.Background())
+	if status.ID != sendNode.Host.ID().Pretty() {
+		t.Errorf("Incorrect node ID in status. Expected %s, was %s", sendNode.Host.ID().Pretty(), status.ID)
+	}
+
+	if len(status.Peers) != 1 {
+		t.Fatalf("Incorrect number of peers in status. Expected 1, was %v", len(status.Peers))
+	}
+
+	if status.Peers[0].ID != listenNode.Host.ID().Pretty() {
+		t.Errorf("Incorrect peer ID in status. Expected %s, was %s", listenNode.Host.ID().Pretty(), status.Peers[0].ID)
+	}
+
+	if !status.Peers[0].Synced {
+		t.Errorf("Expected peer to be reported as synced")
+	}
+}
+
+func TestNodeConnectedPeers(t *testing.T) {
+	listenRPC := NewTestRPC(128)
+	sendRPC := NewTestRPC(5)
+	listenNode, sendNode, addr, _, err := createTestClients(listenRPC, options.NewConfig(), sendRPC, options.NewConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listenNode.Close(context.Background())
+	defer sendNode.Close(context.Background())
+
+	p, _ := peer.AddrInfoFromP2pAddr(addr)
+	err = sendNode.ConnectToPeerAddress(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait for each node to learn the other's head block
+	var sendPeers, listenPeers []node.ConnectedPeer
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		sendPeers = sendNode.GetConnectedPeers(context.Background())
+		listenPeers = listenNode.GetConnectedPeers(context.Background())
+		if len(sendPeers) == 1 && len(listenPeers) == 1 && sendPeers[0].HeadID != "" && listenPeers[0].HeadID != "" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Nodes never reported each other's head blocks, was %+v and %+v", sendPeers, listenPeers)
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+
+	if sendPeers[0].ID != listenNode.Host.ID().Pretty() {
+		t.Errorf("Incorrect peer ID. Expected %s, was %s", listenNode.Host.ID().Pretty(), sendPeers[0].ID)
+	}
+	if sendPeers[0].Address == "" {
+		t.Error("Expected peer address to be reported")
+	}
+	if sendPeers[0].Direction != "outbound" {
+		t.Errorf("Incorrect direction for dialed peer. Expected outbound, was %s", sendPeers[0].Direction)
+	}
+	if sendPeers[0].HeadHeight != 128 {
+		t.Errorf("Incorrect peer head height. Expected 128, was %v", sendPeers[0].HeadHeight)
+	}
+
+	if listenPeers[0].ID != sendNode.Host.ID().Pretty() {
+		t.Errorf("Incorrect peer ID. Expected %s, was %s", sendNode.Host.ID().Pretty(), listenPeers[0].ID)
+	}
+	if listenPeers[0].Direction != "inbound" {
+		t.Errorf("Incorrect direction for accepted peer. Expected inbound, was %s", listenPeers[0].Direction)
+	}
+}
+
+func TestDisconnectPeer(t *testing.T) {
+	listenNode, err := node.NewKoinosP2PNode(context.Background(), "/ip4/127.0.0.1/tcp/0", NewTestRPC(128), nil, "test1", options.NewConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	listenNode.Start(context.Background())
+	defer listenNode.Close(context.Background())
+
+	sendConfig := options.NewConfig()
+	sendConfig.NodeOptions.InitialPeers = []string{listenNode.GetAddress().String()}
+	sendConfig.PeerConnectionOptions.ReconnectBackoff = time.Millisecond * 10
+	sendConfig.PeerConnectionOptions.ReconnectMaxBackoff = time.Millisecond * 10
+	sendNode, err := node.NewKoinosP2PNode(context.Background(), "/ip4/127.0.0.1/tcp/0", NewTestRPC(5), nil, "test2", sendConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendNode.Start(context.Background())
+	defer sendNode.Close(context.Background())
+
+	numPeers := func() int {
+		return len(sendNode.GetConnectedPeers(context.Background()))
+	}
+
+	waitForPeers := func(count int) {
+		deadline := time.Now().Add(time.Second * 3)
+		for numPeers() != count {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %v connected peers, was %v", count, numPeers())
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+	}
+
+	waitForPeers(1)
+
+	// The initial peer is disconnected and not reconnected
+	listenID := listenNode.Host.ID()
+	if err := sendNode.DisconnectPeer(context.Background(), listenID, 0); err != nil {
+		t.Fatal(err)
+	}
+	waitForPeers(0)
+
+	time.Sleep(time.Millisecond * 500)
+	if numPeers() != 0 {
+		t.Error("Expected disconnected initial peer not to be reconnected")
+	}
+
+	if err := sendNode.DisconnectPeer(context.Background(), listenID, 0); !errors.Is(err, p2perrors.ErrPeerNotConnected) {
+		t.Errorf("Expected ErrPeerNotConnected, was %v", err)
+	}
+
+	// A banned peer can not connect again
+	if err := listenNode.ConnectToPeerAddress(context.Background(), sendNode.GetAddressInfo()); err != nil {
+		t.Fatal(err)
+	}
+	waitForPeers(1)
+
+	if err := sendNode.DisconnectPeer(context.Background(), listenID, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	waitForPeers(0)
+
+	_ = listenNode.ConnectToPeerAddress(context.Background(), sendNode.GetAddressInfo())
+	time.Sleep(time.Millisecond * 200)
+	if numPeers() != 0 {
+		t.Error("Expected banned peer not to be able to connect")
+	}
+}
+
+func TestIsolation(t *testing.T) {
+	listenRPC := NewTestRPC(128)
+	sendRPC := NewTestRPC(5)
+
+	listenNode, err := node.NewKoinosP2PNode(context.Background(), "/ip4/127.0.0.1/tcp/8765", listenRPC, nil, "test1", options.NewConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	listenNode.Start(context.Background())
+	listenAddr := listenNode.GetAddress().String()
+
+	sendConfig := options.NewConfig()
+	sendConfig.NodeOptions.InitialPeers = []string{listenAddr}
+	sendConfig.IsolationOptions.ReconnectInterval = time.Millisecond * 200
+	sendNode, err := node.NewKoinosP2PNode(context.Background(), "/ip4/127.0.0.1/tcp/8888", sendRPC, nil, "test2", sendConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendNode.Start(context.Background())
+	defer sendNode.Close(context.Background())
+
+	waitFor := func(timeout time.Duration, cond func() bool) bool {
+		deadline := time.Now().Add(timeout)
+		for time.Now().Before(deadline) {
+			if cond() {
+				return true
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+		return cond()
+	}
+
+	connected := func() bool {
+		return len(sendNode.GetStatus(context.Background()).Peers) == 1
+	}
+
+	if !waitFor(time.Second*3, connected) {
+		t.Fatal("Node never connected to initial peer")
+	}
+
+	if sendNode.ConnectionManager.IsIsolated() {
+		t.Errorf("Node reported isolated while connected to a peer")
+	}
+
+	listenNode.Close(context.Background())
+
+	if !waitFor(time.Second, sendNode.ConnectionManager.IsIsolated) {
+		t.Fatal("Node did not become isolated after losing all peers")
+	}
+
+	if !sendNode.GetStatus(context.Background()).Isolated {
+		t.Errorf("Status did not report the node as isolated")
+	}
+
+	// Wait long enough that the regular reconnect backoff has grown beyond the isolation interval
+	time.Sleep(time.Millisecond * 3500)
+
+	listenNode, err = node.NewKoinosP2PNode(context.Background(), "/ip4/127.0.0.1/tcp/8765", listenRPC, nil, "test1", options.NewConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	listenNode.Start(context.Background())
+	defer listenNode.Close(context.Background())
+
+	if !waitFor(time.Second, connected) {
+		t.Fatal("Isolated node did not aggressively reconnect to its initial peer")
+	}
+
+	if sendNode.ConnectionManager.IsIsolated() {
+		t.Errorf("Node reported isolated after reconnecting to a peer")
+	}
+}
+
+func TestAddressAnnouncement(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	testRPC := NewTestRPC(5)
+	config := options.NewConfig()
+	config.NodeOptions.AnnounceAddresses = true
+
+	n, err := node.NewKoinosP2PNode(ctx, "/ip4/127.0.0.1/tcp/8766", testRPC, nil, "test1", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close(context.Background())
+	n.Start(ctx)
+
+	var announcement *rpc.AddressAnnouncement
+	for start := time.Now(); announcement == nil && time.Since(start) < time.Second; time.Sleep(time.Millisecond * 10) {
+		testRPC.Mutex.Lock()
+		if len(testRPC.Announcements) > 0 {
+			announcement = testRPC.Announcements[0]
+		}
+		testRPC.Mutex.Unlock()
+	}
+
+	if announcement == nil {
+		t.Fatal("Node addresses were never announced")
+	}
+
+	if announcement.ID != n.Host.ID().Pretty() {
+		t.Errorf("Incorrect announced ID. Expected %s, was %s", n.Host.ID(), announcement.ID)
+	}
+
+	expected := n.GetAddress().String()
+	found := false
+	for _, addr := range announcement.Addresses {
+		found = found || addr == expected
+	}
+	if !found {
+		t.Errorf("Expected announced addresses %v to include %s", announcement.Addresses, expected)
+	}
+}
+
+func TestReadyAnnouncement(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	testRPC := NewTestRPC(5)
+	config := options.NewConfig()
+	config.NodeOptions.AnnounceReady = true
+	config.NodeOptions.ReadyMinPeers = 1
+
+	n, err := node.NewKoinosP2PNode(ctx, "/ip4/127.0.0.1/tcp/8767", testRPC, nil, "test1", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close(context.Background())
+	n.Start(ctx)
+
+	readyEvents := func() []*rpc.ReadyAnnouncement {
+		testRPC.Mutex.Lock()
+		defer testRPC.Mutex.Unlock()
+		return testRPC.ReadyEvents
+	}
+
+	// Without any peers, the node must not report ready
+	time.Sleep(time.Second * 2)
+	if len(readyEvents()) != 0 {
+		t.Fatal("Node reported ready before reaching the minimum number of peers")
+	}
+
+	peerNode, err := node.NewKoinosP2PNode(ctx, "/ip4/127.0.0.1/tcp/8768", NewTestRPC(5), nil, "test2", options.NewConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peerNode.Close(context.Background())
+	peerNode.Start(ctx)
+
+	p, _ := peer.AddrInfoFromP2pAddr(n.GetAddress())
+	if err := peerNode.ConnectToPeerAddress(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+
+	for start := time.Now(); len(readyEvents()) == 0 && time.Since(start) < time.Second*3; time.Sleep(time.Millisecond * 50) {
+	}
+
+	events := readyEvents()
+	if len(events) != 1 {
+		t.Fatalf("Expected one ready event, was %v", len(events))
+	}
+	if events[0].ID != n.Host.ID().Pretty() || events[0].Peers < 1 {
+		t.Errorf("Incorrect ready event %+v", events[0])
+	}
+}
+
+func TestIsolatedOnStartup(t *testing.T) {
+	listenNode, err := node.NewKoinosP2PNode(context.Background(), "/ip4/127.0.0.1/tcp/0", NewTestRPC(128), nil, "test1", options.NewConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	listenAddr := listenNode.GetAddress().String()
+	listenNode.Close(context.Background())
+
+	// The only initial peer is unreachable, so the node never loses a peer to become isolated
+	sendConfig := options.NewConfig()
+	sendConfig.NodeOptions.InitialPeers = []string{listenAddr}
+	sendNode, err := node.NewKoinosP2PNode(context.Background(), "/ip4/127.0.0.1/tcp/0", NewTestRPC(5), nil, "test2", sendConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendNode.Start(context.Background())
+	defer sendNode.Close(context.Background())
+
+	deadline := time.Now().Add(time.Second * 5)
+	for !sendNode.ConnectionManager.IsIsolated() {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected node without reachable initial peers to be isolated")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
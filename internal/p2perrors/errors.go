@@ -8,6 +8,9 @@ var (
 	// ErrDeserialization represents any sort of error deserializing a type using Koinos types
 	ErrDeserialization = errors.New("error during deserialization")
 
+	// ErrMessageTooLarge represents a gossip message larger than its topic allows
+	ErrMessageTooLarge = errors.New("gossip message exceeds topic size limit")
+
 	// ErrSerialization represents any sort of error deserializing a type using Koinos types
 	ErrSerialization = errors.New("error during serialization")
 
@@ -41,6 +44,42 @@ var (
 	// ErrPeerRPCTimeout represents a peer rpc timed out
 	ErrPeerRPCTimeout = errors.New("peer RPC request timed out")
 
+	// ErrUnexpectedBlockCount represents a peer returned a different number of blocks than requested
+	ErrUnexpectedBlockCount = errors.New("unexpected number of blocks returned")
+
+	// ErrBlockTooLarge represents a block larger than the maximum block size
+	ErrBlockTooLarge = errors.New("block exceeds maximum block size")
+
+	// ErrBlockMismatch represents a peer returned blocks that do not match what was requested
+	ErrBlockMismatch = errors.New("peer returned block that does not match request")
+
+	// ErrClockSkew represents a peer returned blocks timestamped too far in the future
+	ErrClockSkew = errors.New("peer block timestamp is too far in the future")
+
+	// ErrHeadRegression represents a peer whose reported head repeatedly moved backward beyond reorg depth
+	ErrHeadRegression = errors.New("peer head block repeatedly regressed")
+
+	// ErrSlowPeer represents a peer whose block requests repeatedly time out at the longest allowed timeout
+	ErrSlowPeer = errors.New("peer repeatedly exceeded maximum block request timeout")
+
+	// ErrPeerNotReady represents a peer that has not finished initializing and can not serve requests yet
+	ErrPeerNotReady = errors.New("peer is not ready to serve requests")
+
+	// ErrRateLimited represents a peer making requests faster than allowed
+	ErrRateLimited = errors.New("peer exceeded request rate limit")
+
+	// ErrReciprocityRefused represents a block request refused because the requesting peer has not served blocks
+	ErrReciprocityRefused = errors.New("peer is limiting block requests from peers that have not served blocks")
+
+	// ErrMalformedRequest represents a peer request with invalid arguments
+	ErrMalformedRequest = errors.New("peer sent a malformed request")
+
+	// ErrHeightNotServable represents a request for blocks outside of the servable height range
+	ErrHeightNotServable = errors.New("requested block height is outside of servable range")
+
+	// ErrPeerNotConnected represents a request for a peer that is not currently connected
+	ErrPeerNotConnected = errors.New("peer is not connected")
+
 	// ErrProcessRequestTimeout represents an in process asynchronous request time out
 	ErrProcessRequestTimeout = errors.New("in process request timed out")
 )
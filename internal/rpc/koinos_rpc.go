@@ -2,6 +2,7 @@ package rpc
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 
@@ -24,6 +25,25 @@ const (
 	BlockStoreRPC = "block_store"
 )
 
+// AddressTopic is the broadcast topic on which the node announces its addresses
+const AddressTopic = "koinos.p2p.address"
+
+// ReadyTopic is the broadcast topic on which the node announces it has finished starting
+const ReadyTopic = "koinos.p2p.ready"
+
+// ReadyAnnouncement is the state of the node when it finished starting
+type ReadyAnnouncement struct {
+	ID        string   `json:"id"`
+	Addresses []string `json:"addresses"`
+	Peers     int      `json:"peers"`
+}
+
+// AddressAnnouncement is the node's peer ID and the multiaddresses at which peers can reach it
+type AddressAnnouncement struct {
+	ID        string   `json:"id"`
+	Addresses []string `json:"addresses"`
+}
+
 // KoinosRPC implements LocalRPC implementation by communicating with a local Koinos node via AMQP
 type KoinosRPC struct {
 	mq *koinosmq.Client
@@ -360,6 +380,26 @@ func (k *KoinosRPC) BroadcastGossipStatus(enabled bool) error {
 	return k.mq.Broadcast("application/octet-stream", "koinos.gossip.status", data)
 }
 
+// BroadcastAddresses broadcasts the node's peer ID and addresses
+func (k *KoinosRPC) BroadcastAddresses(announcement *AddressAnnouncement) error {
+	data, err := json.Marshal(announcement)
+	if err != nil {
+		return fmt.Errorf("%w BroadcastAddresses, %s", p2perrors.ErrSerialization, err)
+	}
+
+	return k.mq.Broadcast("application/json", AddressTopic, data)
+}
+
+// BroadcastReady broadcasts that the node has finished starting
+func (k *KoinosRPC) BroadcastReady(announcement *ReadyAnnouncement) error {
+	data, err := json.Marshal(announcement)
+	if err != nil {
+		return fmt.Errorf("%w BroadcastReady, %s", p2perrors.ErrSerialization, err)
+	}
+
+	return k.mq.Broadcast("application/json", ReadyTopic, data)
+}
+
 // IsConnectedToBlockStore returns if the AMQP connection can currently communicate
 // with the block store microservice.
 func (k *KoinosRPC) IsConnectedToBlockStore(ctx context.Context) (bool, error) {
@@ -19,6 +19,8 @@ type LocalRPC interface {
 	GetForkHeads(ctx context.Context) (*chain.GetForkHeadsResponse, error)
 	GetBlocksByID(ctx context.Context, blockIDs []multihash.Multihash) (*block_store.GetBlocksByIdResponse, error)
 	BroadcastGossipStatus(enabled bool) error
+	BroadcastAddresses(announcement *AddressAnnouncement) error
+	BroadcastReady(announcement *ReadyAnnouncement) error
 
 	IsConnectedToBlockStore(ctx context.Context) (bool, error)
 	IsConnectedToChain(ctx context.Context) (bool, error)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/koinos/koinos-p2p/internal/p2perrors"
 	"github.com/koinos/koinos-proto-golang/koinos/protocol"
@@ -15,13 +16,31 @@ import (
 
 // PeerRPC implements RemoteRPC interface by communicating via libp2p's gorpc
 type PeerRPC struct {
-	client *gorpc.Client
-	peerID peer.ID
+	client       *gorpc.Client
+	peerID       peer.ID
+	maxBlockSize int
 }
 
-// NewPeerRPC creates a PeerRPC
-func NewPeerRPC(client *gorpc.Client, peerID peer.ID) *PeerRPC {
-	return &PeerRPC{client: client, peerID: peerID}
+// NewPeerRPC creates a PeerRPC. Blocks larger than maxBlockSize bytes are rejected, a maxBlockSize of zero accepts any size.
+func NewPeerRPC(client *gorpc.Client, peerID peer.ID, maxBlockSize int) *PeerRPC {
+	return &PeerRPC{client: client, peerID: peerID, maxBlockSize: maxBlockSize}
+}
+
+// wrapPeerRPCError wraps an error returned by a peer rpc call with the p2perrors error it represents.
+// Errors returned by the peer's service arrive only as strings, so refusals are recognized by message.
+func wrapPeerRPCError(err error) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("%w, %s", p2perrors.ErrPeerRPCTimeout, err)
+	case strings.Contains(err.Error(), p2perrors.ErrPeerNotReady.Error()):
+		return fmt.Errorf("%w, %s", p2perrors.ErrPeerNotReady, err)
+	case strings.Contains(err.Error(), p2perrors.ErrHeightNotServable.Error()):
+		return fmt.Errorf("%w, %s", p2perrors.ErrHeightNotServable, err)
+	case strings.Contains(err.Error(), p2perrors.ErrReciprocityRefused.Error()):
+		return fmt.Errorf("%w, %s", p2perrors.ErrReciprocityRefused, err)
+	default:
+		return fmt.Errorf("%w, %s", p2perrors.ErrPeerRPC, err)
+	}
 }
 
 // GetChainID rpc call
@@ -30,10 +49,7 @@ func (p *PeerRPC) GetChainID(ctx context.Context) (id multihash.Multihash, err e
 	rpcResp := &GetChainIDResponse{}
 	err = p.client.CallContext(ctx, p.peerID, "PeerRPCService", "GetChainID", rpcReq, rpcResp)
 	if err != nil {
-		if errors.Is(err, context.DeadlineExceeded) {
-			err = fmt.Errorf("%w, %s", p2perrors.ErrPeerRPCTimeout, err)
-		}
-		err = fmt.Errorf("%w, %s", p2perrors.ErrPeerRPC, err)
+		err = wrapPeerRPCError(err)
 	}
 	return rpcResp.ID, err
 }
@@ -44,10 +60,7 @@ func (p *PeerRPC) GetHeadBlock(ctx context.Context) (id multihash.Multihash, hei
 	rpcResp := &GetHeadBlockResponse{}
 	err = p.client.CallContext(ctx, p.peerID, "PeerRPCService", "GetHeadBlock", rpcReq, rpcResp)
 	if err != nil {
-		if errors.Is(err, context.DeadlineExceeded) {
-			err = fmt.Errorf("%w, %s", p2perrors.ErrPeerRPCTimeout, err)
-		}
-		err = fmt.Errorf("%w, %s", p2perrors.ErrPeerRPC, err)
+		err = wrapPeerRPCError(err)
 	}
 	return rpcResp.ID, rpcResp.Height, err
 }
@@ -61,15 +74,27 @@ func (p *PeerRPC) GetAncestorBlockID(ctx context.Context, parentID multihash.Mul
 	rpcResp := &GetAncestorBlockIDResponse{}
 	err = p.client.CallContext(ctx, p.peerID, "PeerRPCService", "GetAncestorBlockID", rpcReq, rpcResp)
 	if err != nil {
-		if errors.Is(err, context.DeadlineExceeded) {
-			err = fmt.Errorf("%w, %s", p2perrors.ErrPeerRPCTimeout, err)
-		}
-		err = fmt.Errorf("%w, %s", p2perrors.ErrPeerRPC, err)
+		err = wrapPeerRPCError(err)
 	}
 	return rpcResp.ID, err
 }
 
-// GetBlocks rpc call
+// GetServableHeightRange rpc call. A peer without the rpc serves all heights, which is reported as an unbounded range.
+func (p *PeerRPC) GetServableHeightRange(ctx context.Context) (low uint64, high uint64, err error) {
+	rpcReq := &GetServableHeightRangeRequest{}
+	rpcResp := &GetServableHeightRangeResponse{}
+	err = p.client.CallContext(ctx, p.peerID, "PeerRPCService", "GetServableHeightRange", rpcReq, rpcResp)
+	if err != nil {
+		if strings.Contains(err.Error(), "can't find method") {
+			return 0, 0, nil
+		}
+
+		err = wrapPeerRPCError(err)
+	}
+	return rpcResp.Low, rpcResp.High, err
+}
+
+// GetBlocks rpc call. The peer may return fewer blocks than requested.
 func (p *PeerRPC) GetBlocks(ctx context.Context, headBlockID multihash.Multihash, startBlockHeight uint64, numBlocks uint32) (blocks []protocol.Block, err error) {
 	rpcReq := &GetBlocksRequest{
 		HeadBlockID:      headBlockID,
@@ -79,19 +104,21 @@ func (p *PeerRPC) GetBlocks(ctx context.Context, headBlockID multihash.Multihash
 	rpcResp := &GetBlocksResponse{}
 	err = p.client.CallContext(ctx, p.peerID, "PeerRPCService", "GetBlocks", rpcReq, rpcResp)
 	if err != nil {
-		if errors.Is(err, context.DeadlineExceeded) {
-			return nil, fmt.Errorf("%w, %s", p2perrors.ErrPeerRPCTimeout, err)
-		}
-		return nil, fmt.Errorf("%w, %s", p2perrors.ErrPeerRPC, err)
+		return nil, wrapPeerRPCError(err)
 	}
 
-	if uint32(len(rpcResp.Blocks)) != numBlocks {
-		return nil, fmt.Errorf("%w, peer returned unexpected number of blocks", p2perrors.ErrPeerRPC)
+	// A peer may return fewer blocks than requested, such as when it does not serve a large block
+	if uint32(len(rpcResp.Blocks)) > numBlocks {
+		return nil, fmt.Errorf("%w, requested %v, peer returned %v", p2perrors.ErrUnexpectedBlockCount, numBlocks, len(rpcResp.Blocks))
 	}
 
 	blocks = make([]protocol.Block, len(rpcResp.Blocks))
 
 	for i, blockBytes := range rpcResp.Blocks {
+		if p.maxBlockSize > 0 && len(blockBytes) > p.maxBlockSize {
+			return nil, fmt.Errorf("%w, peer returned %v byte block, limit is %v bytes", p2perrors.ErrBlockTooLarge, len(blockBytes), p.maxBlockSize)
+		}
+
 		err = proto.Unmarshal(blockBytes, &blocks[i])
 		if err != nil {
 			return nil, fmt.Errorf("%w, %s", p2perrors.ErrDeserialization, err)
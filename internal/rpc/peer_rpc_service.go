@@ -3,7 +3,12 @@ package rpc
 import (
 	"context"
 	"errors"
+	"fmt"
 
+	"github.com/koinos/koinos-p2p/internal/options"
+	"github.com/koinos/koinos-p2p/internal/p2perrors"
+	"github.com/libp2p/go-libp2p-core/peer"
+	gorpc "github.com/libp2p/go-libp2p-gorpc"
 	"github.com/multiformats/go-multihash"
 	"google.golang.org/protobuf/proto"
 )
@@ -53,23 +58,163 @@ type GetBlocksResponse struct {
 	Blocks [][]byte
 }
 
+// GetServableHeightRangeRequest args
+type GetServableHeightRangeRequest struct {
+}
+
+// GetServableHeightRangeResponse return
+type GetServableHeightRangeResponse struct {
+	Low  uint64
+	High uint64
+}
+
 // PeerRPCService implements a libp2p_rpc service
 type PeerRPCService struct {
 	local LocalRPC
+	opts  *options.PeerRPCServiceOptions
+
+	// isReady, reportPeerError and hasServed are kept out of the service's method set, which gorpc registers as RPCs
+	isReady         func() bool
+	reportPeerError func(context.Context, peer.ID, error)
+	hasServed       func(context.Context, peer.ID) bool
+	limiter         *rateLimiter
+	leecherLimiter  *rateLimiter
+}
+
+// NewPeerRPCService creates a PeerRPCService. The service rejects requests with
+// ErrPeerNotReady while isReady returns false. Requests from peers over the rate limit
+// are rejected with ErrRateLimited, which is also passed to reportPeerError. If Reciprocity
+// is enabled, block requests from peers for which hasServed returns false are limited to
+// LeecherRequestRate and rejected with ErrReciprocityRefused over it. A ClientOnly service
+// answers every request except GetBlocks, which is rejected with ErrHeightNotServable.
+func NewPeerRPCService(local LocalRPC, opts *options.PeerRPCServiceOptions, isReady func() bool, reportPeerError func(context.Context, peer.ID, error), hasServed func(context.Context, peer.ID) bool) *PeerRPCService {
+	service := &PeerRPCService{
+		local:           local,
+		opts:            opts,
+		isReady:         isReady,
+		reportPeerError: reportPeerError,
+		hasServed:       hasServed,
+	}
+
+	if opts.RequestRate > 0 {
+		service.limiter = newRateLimiter(opts.RequestRate, opts.RequestBurst)
+	}
+
+	if opts.Reciprocity && opts.LeecherRequestRate > 0 {
+		service.leecherLimiter = newRateLimiter(opts.LeecherRequestRate, opts.LeecherRequestBurst)
+	}
+
+	return service
+}
+
+func (p *PeerRPCService) checkRequest(ctx context.Context) error {
+	if !p.isReady() {
+		return p2perrors.ErrPeerNotReady
+	}
+
+	if p.limiter == nil {
+		return nil
+	}
+
+	// Requests without a sender did not come from a peer
+	id, err := gorpc.GetRequestSender(ctx)
+	if err != nil {
+		return nil
+	}
+
+	if !p.limiter.allow(id) {
+		err := fmt.Errorf("%w, limit is %v requests per second", p2perrors.ErrRateLimited, p.opts.RequestRate)
+		if p.reportPeerError != nil {
+			p.reportPeerError(ctx, id, err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// checkReciprocity limits block requests from peers for which hasServed returns false. Refusals are
+// not reported as peer errors. They are returned as ErrReciprocityRefused, which the requesting peer
+// does not score as an error either.
+func (p *PeerRPCService) checkReciprocity(ctx context.Context) error {
+	if !p.opts.Reciprocity || p.hasServed == nil {
+		return nil
+	}
+
+	// Requests without a sender did not come from a peer
+	id, err := gorpc.GetRequestSender(ctx)
+	if err != nil {
+		return nil
+	}
+
+	if p.hasServed(ctx, id) {
+		return nil
+	}
+
+	if p.leecherLimiter == nil || !p.leecherLimiter.allow(id) {
+		return fmt.Errorf("%w, limit is %v block requests per second", p2perrors.ErrReciprocityRefused, p.opts.LeecherRequestRate)
+	}
+
+	return nil
+}
+
+// validateGetBlocks rejects requests for no blocks or for more than MaxBlocksPerRequest blocks
+func (p *PeerRPCService) validateGetBlocks(request *GetBlocksRequest) error {
+	if request.NumBlocks == 0 {
+		return fmt.Errorf("%w, requested no blocks", p2perrors.ErrMalformedRequest)
+	}
+
+	if p.opts.MaxBlocksPerRequest > 0 && request.NumBlocks > p.opts.MaxBlocksPerRequest {
+		return fmt.Errorf("%w, requested %v blocks, limit is %v", p2perrors.ErrMalformedRequest, request.NumBlocks, p.opts.MaxBlocksPerRequest)
+	}
+
+	return nil
+}
+
+// reportSender passes an error caused by a request to reportPeerError, if the request came from a peer
+func (p *PeerRPCService) reportSender(ctx context.Context, err error) {
+	if p.reportPeerError == nil {
+		return
+	}
+
+	id, senderErr := gorpc.GetRequestSender(ctx)
+	if senderErr != nil {
+		return
+	}
+
+	p.reportPeerError(ctx, id, err)
+}
+
+// serveContext limits a local request to ServeTimeout. A zero ServeTimeout does not limit the request.
+func (p *PeerRPCService) serveContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.opts.ServeTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, p.opts.ServeTimeout)
 }
 
-// NewPeerRPCService creates a PeerRPCService
-func NewPeerRPCService(local LocalRPC) *PeerRPCService {
-	return &PeerRPCService{
-		local: local,
+// wrapServeError reports a local request aborted after ServeTimeout as a local rpc timeout
+func wrapServeError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w, %s", p2perrors.ErrLocalRPCTimeout, err)
 	}
+
+	return err
 }
 
 // GetChainID peer rpc implementation
 func (p *PeerRPCService) GetChainID(ctx context.Context, request *GetChainIDRequest, response *GetChainIDResponse) error {
+	if err := p.checkRequest(ctx); err != nil {
+		return err
+	}
+
+	ctx, cancel := p.serveContext(ctx)
+	defer cancel()
+
 	rpcResult, err := p.local.GetChainID(ctx)
 	if err != nil {
-		return err
+		return wrapServeError(err)
 	}
 
 	response.ID = rpcResult.ChainId
@@ -78,9 +223,16 @@ func (p *PeerRPCService) GetChainID(ctx context.Context, request *GetChainIDRequ
 
 // GetHeadBlock peer rpc implementation
 func (p *PeerRPCService) GetHeadBlock(ctx context.Context, request *GetHeadBlockRequest, response *GetHeadBlockResponse) error {
+	if err := p.checkRequest(ctx); err != nil {
+		return err
+	}
+
+	ctx, cancel := p.serveContext(ctx)
+	defer cancel()
+
 	rpcResult, err := p.local.GetHeadBlock(ctx)
 	if err != nil {
-		return err
+		return wrapServeError(err)
 	}
 
 	response.ID = rpcResult.HeadTopology.Id
@@ -90,33 +242,85 @@ func (p *PeerRPCService) GetHeadBlock(ctx context.Context, request *GetHeadBlock
 
 // GetAncestorBlockID peer rpc implementation
 func (p *PeerRPCService) GetAncestorBlockID(ctx context.Context, request *GetAncestorBlockIDRequest, response *GetAncestorBlockIDResponse) error {
+	if err := p.checkRequest(ctx); err != nil {
+		return err
+	}
+
+	ctx, cancel := p.serveContext(ctx)
+	defer cancel()
+
 	rpcResult, err := p.local.GetBlocksByHeight(ctx, request.ParentID, request.ChildHeight, 1)
 	if err != nil {
-		return err
+		return wrapServeError(err)
 	}
 
 	if len(rpcResult.BlockItems) != 1 {
-		return errors.New("unexpected number of blocks returned")
+		return fmt.Errorf("%w, expected 1, was %v", p2perrors.ErrUnexpectedBlockCount, len(rpcResult.BlockItems))
 	}
 
 	response.ID = rpcResult.BlockItems[0].BlockId
 	return nil
 }
 
-// GetBlocks peer rpc implementation
+// GetBlocks peer rpc implementation. Blocks are served from the fork ending at the requested
+// head block, so a local reorg can not mix blocks from different forks into one response.
 func (p *PeerRPCService) GetBlocks(ctx context.Context, request *GetBlocksRequest, response *GetBlocksResponse) error {
+	if err := p.checkRequest(ctx); err != nil {
+		return err
+	}
+
+	if p.opts.ClientOnly {
+		return fmt.Errorf("%w, node is client only and does not serve blocks", p2perrors.ErrHeightNotServable)
+	}
+
+	if err := p.checkReciprocity(ctx); err != nil {
+		return err
+	}
+
+	if err := p.validateGetBlocks(request); err != nil {
+		p.reportSender(ctx, err)
+		return err
+	}
+
+	servable := p.opts.ServableHeightRange
+	lastHeight := request.StartBlockHeight + uint64(request.NumBlocks) - 1
+	if !servable.Contains(request.StartBlockHeight) || !servable.Contains(lastHeight) {
+		return fmt.Errorf("%w, requested heights %v-%v, servable heights %v-%v", p2perrors.ErrHeightNotServable, request.StartBlockHeight, lastHeight, servable.Low, servable.High)
+	}
+
+	ctx, cancel := p.serveContext(ctx)
+	defer cancel()
+
 	rpcResult, err := p.local.GetBlocksByHeight(ctx, request.HeadBlockID, request.StartBlockHeight, request.NumBlocks)
 	if err != nil {
-		return err
+		return wrapServeError(err)
 	}
 
-	response.Blocks = make([][]byte, len(rpcResult.BlockItems))
-	for i, block := range rpcResult.BlockItems {
-		response.Blocks[i], err = proto.Marshal(block.Block)
+	response.Blocks = make([][]byte, 0, len(rpcResult.BlockItems))
+	for _, block := range rpcResult.BlockItems {
+		blockBytes, err := proto.Marshal(block.Block)
 		if err != nil {
 			return err
 		}
+
+		// Later blocks can not be applied without this one, so the response ends before it
+		if p.opts.MaxBlockSize > 0 && len(blockBytes) > p.opts.MaxBlockSize {
+			break
+		}
+
+		response.Blocks = append(response.Blocks, blockBytes)
+	}
+
+	return nil
+}
+
+// GetServableHeightRange peer rpc implementation
+func (p *PeerRPCService) GetServableHeightRange(ctx context.Context, request *GetServableHeightRangeRequest, response *GetServableHeightRangeResponse) error {
+	if err := p.checkRequest(ctx); err != nil {
+		return err
 	}
 
+	response.Low = p.opts.ServableHeightRange.Low
+	response.High = p.opts.ServableHeightRange.High
 	return nil
 }
@@ -0,0 +1,351 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/koinos/koinos-p2p/internal/options"
+	"github.com/koinos/koinos-p2p/internal/p2perrors"
+	"github.com/koinos/koinos-proto-golang/koinos/protocol"
+	"github.com/koinos/koinos-proto-golang/koinos/rpc/block_store"
+	"github.com/libp2p/go-libp2p-core/peer"
+	gorpc "github.com/libp2p/go-libp2p-gorpc"
+	"github.com/multiformats/go-multihash"
+	"google.golang.org/protobuf/proto"
+)
+
+// testLocalRPC serves empty blocks at any height and leaves the rest of LocalRPC unimplemented
+type testLocalRPC struct {
+	LocalRPC
+}
+
+func (t *testLocalRPC) GetBlocksByHeight(ctx context.Context, blockID multihash.Multihash, height uint64, numBlocks uint32) (*block_store.GetBlocksByHeightResponse, error) {
+	resp := &block_store.GetBlocksByHeightResponse{}
+	for i := uint64(0); i < uint64(numBlocks); i++ {
+		resp.BlockItems = append(resp.BlockItems, &block_store.BlockItem{
+			BlockHeight: height + i,
+			Block:       &protocol.Block{Header: &protocol.BlockHeader{Height: height + i}},
+		})
+	}
+
+	return resp, nil
+}
+
+func isReady() bool {
+	return true
+}
+
+func TestServableHeightRange(t *testing.T) {
+	opts := options.NewPeerRPCServiceOptions()
+	opts.ServableHeightRange = options.HeightRange{Low: 100, High: 200}
+	service := NewPeerRPCService(&testLocalRPC{}, opts, isReady, nil, nil)
+
+	rangeResp := &GetServableHeightRangeResponse{}
+	if err := service.GetServableHeightRange(context.Background(), &GetServableHeightRangeRequest{}, rangeResp); err != nil {
+		t.Fatal(err)
+	}
+	if rangeResp.Low != 100 || rangeResp.High != 200 {
+		t.Errorf("Incorrect servable height range advertised. Expected 100-200, was %v-%v", rangeResp.Low, rangeResp.High)
+	}
+
+	tests := []struct {
+		name      string
+		start     uint64
+		numBlocks uint32
+		servable  bool
+	}{
+		{"inside window", 100, 101, true},
+		{"below window", 99, 10, false},
+		{"above window", 201, 10, false},
+		{"overlapping upper bound", 195, 10, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &GetBlocksResponse{}
+			err := service.GetBlocks(context.Background(), &GetBlocksRequest{StartBlockHeight: tt.start, NumBlocks: tt.numBlocks}, resp)
+
+			if tt.servable {
+				if err != nil {
+					t.Fatalf("Unexpected error: %s", err)
+				}
+				if len(resp.Blocks) != int(tt.numBlocks) {
+					t.Errorf("Incorrect number of blocks served. Expected %v, was %v", tt.numBlocks, len(resp.Blocks))
+				}
+			} else if !errors.Is(err, p2perrors.ErrHeightNotServable) {
+				t.Errorf("Expected ErrHeightNotServable, was %v", err)
+			}
+		})
+	}
+}
+
+// slowBlockStoreRPC waits for its context to be done before returning blocks
+type slowBlockStoreRPC struct {
+	testLocalRPC
+}
+
+func (t *slowBlockStoreRPC) GetBlocksByHeight(ctx context.Context, blockID multihash.Multihash, height uint64, numBlocks uint32) (*block_store.GetBlocksByHeightResponse, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(time.Second * 10):
+		return t.testLocalRPC.GetBlocksByHeight(ctx, blockID, height, numBlocks)
+	}
+}
+
+func TestServeTimeout(t *testing.T) {
+	opts := options.NewPeerRPCServiceOptions()
+	opts.ServeTimeout = time.Millisecond * 50
+	service := NewPeerRPCService(&slowBlockStoreRPC{}, opts, isReady, nil, nil)
+
+	start := time.Now()
+	err := service.GetBlocks(context.Background(), &GetBlocksRequest{StartBlockHeight: 1, NumBlocks: 10}, &GetBlocksResponse{})
+	if !errors.Is(err, p2perrors.ErrLocalRPCTimeout) {
+		t.Errorf("Expected ErrLocalRPCTimeout, was %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected request to be aborted after the serve timeout, took %v", elapsed)
+	}
+
+	opts.ServeTimeout = 0
+	service = NewPeerRPCService(&noDeadlineRPC{}, opts, isReady, nil, nil)
+	if err := service.GetBlocks(context.Background(), &GetBlocksRequest{StartBlockHeight: 1, NumBlocks: 10}, &GetBlocksResponse{}); err != nil {
+		t.Errorf("Expected a zero serve timeout not to limit the request, was %v", err)
+	}
+}
+
+// noDeadlineRPC fails requests made with a context that has a deadline
+type noDeadlineRPC struct {
+	testLocalRPC
+}
+
+func (t *noDeadlineRPC) GetBlocksByHeight(ctx context.Context, blockID multihash.Multihash, height uint64, numBlocks uint32) (*block_store.GetBlocksByHeightResponse, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		return nil, fmt.Errorf("request has a deadline of %v", deadline)
+	}
+
+	return t.testLocalRPC.GetBlocksByHeight(ctx, blockID, height, numBlocks)
+}
+
+func TestRequestRateLimit(t *testing.T) {
+	opts := options.NewPeerRPCServiceOptions()
+	opts.RequestRate = 20
+	opts.RequestBurst = 3
+
+	var reported []peer.ID
+	service := NewPeerRPCService(&testLocalRPC{}, opts, isReady, func(_ context.Context, id peer.ID, err error) {
+		if !errors.Is(err, p2perrors.ErrRateLimited) {
+			t.Errorf("Expected ErrRateLimited to be reported, was %v", err)
+		}
+		reported = append(reported, id)
+	}, nil)
+
+	getHeightRange := func(ctx context.Context) error {
+		return service.GetServableHeightRange(ctx, &GetServableHeightRangeRequest{}, &GetServableHeightRangeResponse{})
+	}
+
+	peerACtx := context.WithValue(context.Background(), gorpc.ContextKeyRequestSender, peer.ID("peerA"))
+	peerBCtx := context.WithValue(context.Background(), gorpc.ContextKeyRequestSender, peer.ID("peerB"))
+
+	for i := 0; i < opts.RequestBurst; i++ {
+		if err := getHeightRange(peerACtx); err != nil {
+			t.Fatalf("Unexpected error within burst: %s", err)
+		}
+	}
+
+	if err := getHeightRange(peerACtx); !errors.Is(err, p2perrors.ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited, was %v", err)
+	}
+	if len(reported) != 1 || reported[0] != "peerA" {
+		t.Errorf("Expected peerA to be reported once, was %v", reported)
+	}
+
+	// Each peer has its own limit
+	if err := getHeightRange(peerBCtx); err != nil {
+		t.Errorf("Unexpected error for peerB: %s", err)
+	}
+
+	// Requests without a sender are not limited
+	for i := 0; i < opts.RequestBurst*2; i++ {
+		if err := getHeightRange(context.Background()); err != nil {
+			t.Fatalf("Unexpected error without a sender: %s", err)
+		}
+	}
+
+	// Tokens refill over time
+	time.Sleep(time.Millisecond * 100)
+	if err := getHeightRange(peerACtx); err != nil {
+		t.Errorf("Expected request to be allowed after refilling, was %s", err)
+	}
+}
+
+func TestReciprocity(t *testing.T) {
+	opts := options.NewPeerRPCServiceOptions()
+	opts.Reciprocity = true
+	opts.LeecherRequestRate = 1
+	opts.LeecherRequestBurst = 2
+
+	// peerA is a leecher, peerB has served blocks to this node
+	hasServed := func(ctx context.Context, id peer.ID) bool {
+		return id == "peerB"
+	}
+	service := NewPeerRPCService(&testLocalRPC{}, opts, isReady, func(_ context.Context, id peer.ID, err error) {
+		t.Errorf("Unexpected peer error reported for %s: %s", id, err)
+	}, hasServed)
+
+	getBlocks := func(ctx context.Context) error {
+		return service.GetBlocks(ctx, &GetBlocksRequest{StartBlockHeight: 1, NumBlocks: 1}, &GetBlocksResponse{})
+	}
+
+	leecherCtx := context.WithValue(context.Background(), gorpc.ContextKeyRequestSender, peer.ID("peerA"))
+	servingCtx := context.WithValue(context.Background(), gorpc.ContextKeyRequestSender, peer.ID("peerB"))
+
+	for i := 0; i < opts.LeecherRequestBurst; i++ {
+		if err := getBlocks(leecherCtx); err != nil {
+			t.Fatalf("Unexpected error within leecher burst: %s", err)
+		}
+	}
+
+	if err := getBlocks(leecherCtx); !errors.Is(err, p2perrors.ErrReciprocityRefused) {
+		t.Errorf("Expected ErrReciprocityRefused for leecher, was %v", err)
+	}
+
+	// Other requests from the leecher are not limited by reciprocity
+	if err := service.GetServableHeightRange(leecherCtx, &GetServableHeightRangeRequest{}, &GetServableHeightRangeResponse{}); err != nil {
+		t.Errorf("Unexpected error for leecher height range request: %s", err)
+	}
+
+	// The reciprocating peer is served at the normal rate
+	for i := 0; i < opts.LeecherRequestBurst*5; i++ {
+		if err := getBlocks(servingCtx); err != nil {
+			t.Fatalf("Unexpected error for reciprocating peer: %s", err)
+		}
+	}
+
+	// A zero leecher rate refuses leechers entirely
+	opts.LeecherRequestRate = 0
+	service = NewPeerRPCService(&testLocalRPC{}, opts, isReady, nil, hasServed)
+	if err := getBlocks(leecherCtx); !errors.Is(err, p2perrors.ErrReciprocityRefused) {
+		t.Errorf("Expected leecher to be refused, was %v", err)
+	}
+	if err := getBlocks(servingCtx); err != nil {
+		t.Errorf("Unexpected error for reciprocating peer: %s", err)
+	}
+}
+
+func TestServeMaxBlockSize(t *testing.T) {
+	opts := options.NewPeerRPCServiceOptions()
+	service := NewPeerRPCService(&testLocalRPC{}, opts, isReady, nil, nil)
+
+	response := &GetBlocksResponse{}
+	if err := service.GetBlocks(context.Background(), &GetBlocksRequest{StartBlockHeight: 120, NumBlocks: 10}, response); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(response.Blocks) != 10 {
+		t.Errorf("Expected all blocks to be served without a limit, was %v", len(response.Blocks))
+	}
+
+	// Heights from 128 take an extra byte to encode, so the response ends before the block at height 128
+	opts.MaxBlockSize = proto.Size(&protocol.Block{Header: &protocol.BlockHeader{Height: 127}})
+	response = &GetBlocksResponse{}
+	if err := service.GetBlocks(context.Background(), &GetBlocksRequest{StartBlockHeight: 120, NumBlocks: 10}, response); err != nil {
+		t.Fatalf("Expected oversized blocks to be skipped, was %s", err)
+	}
+	if len(response.Blocks) != 8 {
+		t.Errorf("Expected blocks 120-127 to be served, was %v blocks", len(response.Blocks))
+	}
+}
+
+func TestMalformedGetBlocks(t *testing.T) {
+	opts := options.NewPeerRPCServiceOptions()
+	opts.MaxBlocksPerRequest = 10
+
+	var reported []error
+	service := NewPeerRPCService(&testLocalRPC{}, opts, isReady, func(_ context.Context, id peer.ID, err error) {
+		if id != "peerA" {
+			t.Errorf("Incorrect peer reported. Expected peerA, was %s", id)
+		}
+		reported = append(reported, err)
+	}, nil)
+
+	peerCtx := context.WithValue(context.Background(), gorpc.ContextKeyRequestSender, peer.ID("peerA"))
+
+	for _, numBlocks := range []uint32{0, opts.MaxBlocksPerRequest + 1} {
+		err := service.GetBlocks(peerCtx, &GetBlocksRequest{StartBlockHeight: 1, NumBlocks: numBlocks}, &GetBlocksResponse{})
+		if !errors.Is(err, p2perrors.ErrMalformedRequest) {
+			t.Errorf("Expected ErrMalformedRequest requesting %v blocks, was %v", numBlocks, err)
+		}
+	}
+
+	if len(reported) != 2 {
+		t.Fatalf("Expected both malformed requests to be reported, was %v", reported)
+	}
+	for _, err := range reported {
+		if !errors.Is(err, p2perrors.ErrMalformedRequest) {
+			t.Errorf("Expected ErrMalformedRequest to be reported, was %v", err)
+		}
+	}
+
+	// A request within the limit is served
+	resp := &GetBlocksResponse{}
+	if err := service.GetBlocks(peerCtx, &GetBlocksRequest{StartBlockHeight: 1, NumBlocks: opts.MaxBlocksPerRequest}, resp); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(resp.Blocks) != int(opts.MaxBlocksPerRequest) {
+		t.Errorf("Incorrect number of blocks served. Expected %v, was %v", opts.MaxBlocksPerRequest, len(resp.Blocks))
+	}
+}
+
+// forkLocalRPC serves blocks from the fork ending at the requested block, ignoring its own best fork
+type forkLocalRPC struct {
+	testLocalRPC
+	bestFork atomic.Value
+}
+
+func (f *forkLocalRPC) GetBlocksByHeight(ctx context.Context, blockID multihash.Multihash, height uint64, numBlocks uint32) (*block_store.GetBlocksByHeightResponse, error) {
+	resp := &block_store.GetBlocksByHeightResponse{}
+	for i := uint64(0); i < uint64(numBlocks); i++ {
+		resp.BlockItems = append(resp.BlockItems, &block_store.BlockItem{
+			BlockHeight: height + i,
+			Block:       &protocol.Block{Id: blockID, Header: &protocol.BlockHeader{Height: height + i}},
+		})
+	}
+
+	return resp, nil
+}
+
+func TestServeDuringReorg(t *testing.T) {
+	local := &forkLocalRPC{}
+	local.bestFork.Store("forkA")
+	service := NewPeerRPCService(local, options.NewPeerRPCServiceOptions(), isReady, nil, nil)
+
+	forkAHead := multihash.Multihash("forkA")
+
+	for i := 0; i < 10; i++ {
+		// Reorganize to the other fork between requests
+		if i%2 == 0 {
+			local.bestFork.Store("forkB")
+		} else {
+			local.bestFork.Store("forkA")
+		}
+
+		resp := &GetBlocksResponse{}
+		if err := service.GetBlocks(context.Background(), &GetBlocksRequest{HeadBlockID: forkAHead, StartBlockHeight: 1, NumBlocks: 5}, resp); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, blockBytes := range resp.Blocks {
+			block := &protocol.Block{}
+			if err := proto.Unmarshal(blockBytes, block); err != nil {
+				t.Fatal(err)
+			}
+			if string(block.Id) != string(forkAHead) {
+				t.Errorf("Expected blocks from the requested fork forkA, was %s", block.Id)
+			}
+		}
+	}
+}
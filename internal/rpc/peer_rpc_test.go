@@ -0,0 +1,274 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/koinos/koinos-p2p/internal/options"
+	"github.com/koinos/koinos-p2p/internal/p2perrors"
+	"github.com/koinos/koinos-proto-golang/koinos/rpc/chain"
+	libp2p "github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	gorpc "github.com/libp2p/go-libp2p-gorpc"
+)
+
+// slowLocalRPC takes longer than any client timeout to return a chain ID and fails to return a head block
+type slowLocalRPC struct {
+	testLocalRPC
+}
+
+func (t *slowLocalRPC) GetChainID(ctx context.Context) (*chain.GetChainIdResponse, error) {
+	time.Sleep(time.Millisecond * 500)
+	return &chain.GetChainIdResponse{}, nil
+}
+
+func (t *slowLocalRPC) GetHeadBlock(ctx context.Context) (*chain.GetHeadInfoResponse, error) {
+	return nil, errors.New("no head block")
+}
+
+func newTestHost(t *testing.T) host.Host {
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return h
+}
+
+func TestPeerRPCErrors(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	client := newTestHost(t)
+	defer client.Close()
+
+	server := newTestHost(t)
+	defer server.Close()
+
+	err := gorpc.NewServer(server, PeerRPCID).Register(NewPeerRPCService(&slowLocalRPC{}, options.NewPeerRPCServiceOptions(), isReady, nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Connect(ctx, peer.AddrInfo{ID: server.ID(), Addrs: server.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	peerRPC := NewPeerRPC(gorpc.NewClient(client, PeerRPCID), server.ID(), 0)
+
+	timeoutCtx, timeoutCancel := context.WithTimeout(ctx, time.Millisecond*100)
+	defer timeoutCancel()
+	_, err = peerRPC.GetChainID(timeoutCtx)
+	if !errors.Is(err, p2perrors.ErrPeerRPCTimeout) {
+		t.Errorf("Expected ErrPeerRPCTimeout, was %v", err)
+	}
+
+	_, _, err = peerRPC.GetHeadBlock(ctx)
+	if !errors.Is(err, p2perrors.ErrPeerRPC) {
+		t.Errorf("Expected ErrPeerRPC, was %v", err)
+	}
+	if errors.Is(err, p2perrors.ErrPeerRPCTimeout) {
+		t.Errorf("Did not expect ErrPeerRPCTimeout, was %v", err)
+	}
+}
+
+func TestPeerRPCHeightNotServable(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	client := newTestHost(t)
+	defer client.Close()
+
+	server := newTestHost(t)
+	defer server.Close()
+
+	opts := options.NewPeerRPCServiceOptions()
+	opts.ServableHeightRange = options.HeightRange{Low: 100, High: 200}
+	err := gorpc.NewServer(server, PeerRPCID).Register(NewPeerRPCService(&testLocalRPC{}, opts, isReady, nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Connect(ctx, peer.AddrInfo{ID: server.ID(), Addrs: server.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	peerRPC := NewPeerRPC(gorpc.NewClient(client, PeerRPCID), server.ID(), 0)
+
+	low, high, err := peerRPC.GetServableHeightRange(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if low != 100 || high != 200 {
+		t.Errorf("Incorrect servable height range. Expected 100-200, was %v-%v", low, high)
+	}
+
+	// Refusing heights outside of the range is not a peer RPC error
+	_, err = peerRPC.GetBlocks(ctx, nil, 1, 10)
+	if !errors.Is(err, p2perrors.ErrHeightNotServable) {
+		t.Errorf("Expected ErrHeightNotServable, was %v", err)
+	}
+	if errors.Is(err, p2perrors.ErrPeerRPC) {
+		t.Errorf("Did not expect ErrPeerRPC, was %v", err)
+	}
+}
+
+func TestPeerRPCNotReady(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	client := newTestHost(t)
+	defer client.Close()
+
+	server := newTestHost(t)
+	defer server.Close()
+
+	var ready atomic.Value
+	ready.Store(false)
+	service := NewPeerRPCService(&testLocalRPC{}, options.NewPeerRPCServiceOptions(), func() bool { return ready.Load().(bool) }, nil, nil)
+	err := gorpc.NewServer(server, PeerRPCID).Register(service)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Connect(ctx, peer.AddrInfo{ID: server.ID(), Addrs: server.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	peerRPC := NewPeerRPC(gorpc.NewClient(client, PeerRPCID), server.ID(), 0)
+
+	_, err = peerRPC.GetBlocks(ctx, nil, 1, 10)
+	if !errors.Is(err, p2perrors.ErrPeerNotReady) {
+		t.Errorf("Expected ErrPeerNotReady before the service is ready, was %v", err)
+	}
+
+	ready.Store(true)
+
+	blocks, err := peerRPC.GetBlocks(ctx, nil, 1, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error after the service is ready: %s", err)
+	}
+	if len(blocks) != 10 {
+		t.Errorf("Incorrect number of blocks served. Expected 10, was %v", len(blocks))
+	}
+}
+
+// corruptPeerRPCService returns undecodable blobs in place of blocks
+type corruptPeerRPCService struct{}
+
+func (c *corruptPeerRPCService) GetBlocks(ctx context.Context, request *GetBlocksRequest, response *GetBlocksResponse) error {
+	response.Blocks = make([][]byte, request.NumBlocks)
+	for i := range response.Blocks {
+		// A truncated length delimited field
+		response.Blocks[i] = []byte{0x0a, 0xff, 0x01}
+	}
+
+	return nil
+}
+
+func TestPeerRPCCorruptBlocks(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	client := newTestHost(t)
+	defer client.Close()
+
+	server := newTestHost(t)
+	defer server.Close()
+
+	err := gorpc.NewServer(server, PeerRPCID).RegisterName("PeerRPCService", &corruptPeerRPCService{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Connect(ctx, peer.AddrInfo{ID: server.ID(), Addrs: server.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, err := NewPeerRPC(gorpc.NewClient(client, PeerRPCID), server.ID(), 0).GetBlocks(ctx, nil, 1, 2)
+	if !errors.Is(err, p2perrors.ErrDeserialization) {
+		t.Errorf("Expected ErrDeserialization, was %v", err)
+	}
+	if blocks != nil {
+		t.Errorf("Expected no blocks from a corrupt response, was %v", len(blocks))
+	}
+}
+
+// largePeerRPCService serves zeroed blocks of a fixed size
+type largePeerRPCService struct {
+	size int
+}
+
+func (l *largePeerRPCService) GetBlocks(ctx context.Context, request *GetBlocksRequest, response *GetBlocksResponse) error {
+	response.Blocks = make([][]byte, request.NumBlocks)
+	for i := range response.Blocks {
+		response.Blocks[i] = make([]byte, l.size)
+	}
+
+	return nil
+}
+
+func TestPeerRPCMaxBlockSize(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	client := newTestHost(t)
+	defer client.Close()
+
+	server := newTestHost(t)
+	defer server.Close()
+
+	err := gorpc.NewServer(server, PeerRPCID).RegisterName("PeerRPCService", &largePeerRPCService{size: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Connect(ctx, peer.AddrInfo{ID: server.ID(), Addrs: server.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, err := NewPeerRPC(gorpc.NewClient(client, PeerRPCID), server.ID(), 512).GetBlocks(ctx, nil, 1, 2)
+	if !errors.Is(err, p2perrors.ErrBlockTooLarge) {
+		t.Errorf("Expected ErrBlockTooLarge, was %v", err)
+	}
+	if blocks != nil {
+		t.Errorf("Expected no blocks from an oversized response, was %v", len(blocks))
+	}
+}
+
+func TestPeerRPCReciprocityRefused(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	client := newTestHost(t)
+	defer client.Close()
+
+	server := newTestHost(t)
+	defer server.Close()
+
+	opts := options.NewPeerRPCServiceOptions()
+	opts.Reciprocity = true
+	opts.LeecherRequestRate = 0
+	hasServed := func(context.Context, peer.ID) bool { return false }
+	err := gorpc.NewServer(server, PeerRPCID).Register(NewPeerRPCService(&testLocalRPC{}, opts, isReady, nil, hasServed))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Connect(ctx, peer.AddrInfo{ID: server.ID(), Addrs: server.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A reciprocity refusal is not a peer RPC error, so the refusing peer is not penalized
+	_, err = NewPeerRPC(gorpc.NewClient(client, PeerRPCID), server.ID(), 0).GetBlocks(ctx, nil, 1, 10)
+	if !errors.Is(err, p2perrors.ErrReciprocityRefused) {
+		t.Errorf("Expected ErrReciprocityRefused, was %v", err)
+	}
+	if errors.Is(err, p2perrors.ErrPeerRPC) {
+		t.Errorf("Did not expect ErrPeerRPC, was %v", err)
+	}
+}
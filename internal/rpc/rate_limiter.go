@@ -0,0 +1,83 @@
+package rpc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+const rateLimiterPruneInterval = time.Minute
+
+type tokenBucket struct {
+	tokens     float64
+	lastUpdate time.Time
+}
+
+// rateLimiter is a per-peer token bucket rate limiter
+type rateLimiter struct {
+	rate      float64
+	burst     float64
+	buckets   map[peer.ID]*tokenBucket
+	lastPrune time.Time
+	mutex     sync.Mutex
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &rateLimiter{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   make(map[peer.ID]*tokenBucket),
+		lastPrune: time.Now(),
+	}
+}
+
+// allow takes a token from the peer's bucket, returning false if the bucket is empty
+func (r *rateLimiter) allow(id peer.ID) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	r.prune(now)
+
+	bucket, ok := r.buckets[id]
+	if !ok {
+		bucket = &tokenBucket{tokens: r.burst, lastUpdate: now}
+		r.buckets[id] = bucket
+	}
+
+	r.refill(bucket, now)
+	if bucket.tokens < 1 {
+		return false
+	}
+
+	bucket.tokens--
+	return true
+}
+
+func (r *rateLimiter) refill(bucket *tokenBucket, now time.Time) {
+	bucket.tokens += now.Sub(bucket.lastUpdate).Seconds() * r.rate
+	if bucket.tokens > r.burst {
+		bucket.tokens = r.burst
+	}
+	bucket.lastUpdate = now
+}
+
+// prune periodically removes full buckets, which are equivalent to having no bucket
+func (r *rateLimiter) prune(now time.Time) {
+	if now.Sub(r.lastPrune) < rateLimiterPruneInterval {
+		return
+	}
+
+	for id, bucket := range r.buckets {
+		r.refill(bucket, now)
+		if bucket.tokens >= r.burst {
+			delete(r.buckets, id)
+		}
+	}
+	r.lastPrune = now
+}
@@ -13,4 +13,5 @@ type RemoteRPC interface {
 	GetHeadBlock(ctx context.Context) (id multihash.Multihash, height uint64, err error)
 	GetAncestorBlockID(ctx context.Context, parentID multihash.Multihash, childHeight uint64) (id multihash.Multihash, err error)
 	GetBlocks(ctx context.Context, headBlockID multihash.Multihash, startBlockHeight uint64, batchSize uint32) (blocks []protocol.Block, err error)
+	GetServableHeightRange(ctx context.Context) (low uint64, high uint64, err error)
 }